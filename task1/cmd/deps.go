@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/memory"
+	"github.com/pozedorum/WB_project_3/task1/internal/notifier"
+	queue "github.com/pozedorum/WB_project_3/task1/internal/rabbitmq"
+	"github.com/pozedorum/WB_project_3/task1/internal/repository/postgres"
+	"github.com/pozedorum/WB_project_3/task1/internal/repository/redis"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/dbpg"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// repository объединяет хранилища, которые PostgreSQL и dev-режим реализуют одним типом
+type repository interface {
+	service.Repository
+	service.TemplateRepository
+	service.PreferencesRepository
+	service.TelegramRepository
+}
+
+// deps - внешние зависимости сервиса, общие для всех ролей.
+type deps struct {
+	repo      repository
+	cache     service.Cache
+	queue     service.Queue
+	events    service.StatusEvents
+	notifiers []service.Notifier
+	// closers закрываются в обратном порядке
+	closers []func()
+}
+
+func (d *deps) Close() {
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		d.closers[i]()
+	}
+}
+
+// connectPostgres подключается к PostgreSQL с общими для всех ролей настройками пула.
+func connectPostgres(cfg *config.Config) (*postgres.NotificationRepository, error) {
+	opts := &dbpg.Options{
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Hour,
+	}
+
+	pgRepo, err := postgres.NewNotificationRepositoryWithDB(cfg.Database.GetDSN(), []string{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	return pgRepo, nil
+}
+
+// newConnectedDeps подключается к PostgreSQL, Redis и очереди и создает нотификаторы.
+func newConnectedDeps(ctx context.Context, cfg *config.Config) (*deps, error) {
+	d := &deps{}
+
+	// 1. Подключение к БД
+	pgRepo, err := connectPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d.repo = pgRepo
+	d.closers = append(d.closers, func() {
+		pgRepo.Close()
+		zlog.Logger.Info().Msg("PostgreSQL connection closed")
+	})
+
+	// 2. Подключение к Redis, без REDIS_HOST кэш отключен, а события
+	// о смене статусов доходят только до подписчиков этого же процесса
+	if cfg.Redis.Host == "" {
+		zlog.Logger.Info().Msg("Redis is not configured, notification cache disabled, status stream is local to the process")
+		d.cache = memory.NopCache{}
+		eventBus := memory.NewEventBus()
+		d.events = eventBus
+		d.closers = append(d.closers, func() { eventBus.Close() })
+	} else {
+		redisCache := redis.NewNotificationRepository(cfg.Redis.Host+":"+cfg.Redis.Port, cfg.Redis.Password, cfg.Redis.DB,
+			cfg.Redis.CacheTTL, cfg.Redis.TombstoneTTL)
+		if _, err = redisCache.Ping(ctx); err != nil {
+			zlog.Logger.Warn().Err(err).Msg("Redis connection warning")
+		} else {
+			zlog.Logger.Info().Msg("Connected to Redis")
+		}
+		d.cache = redisCache
+		d.closers = append(d.closers, func() {
+			if err := redisCache.Close(); err != nil {
+				zlog.Logger.Error().Err(err).Msg("Error closing Redis connection")
+			}
+		})
+
+		// Подписки закрываются раньше общего с кэшем подключения
+		redisEvents := redisCache.Events()
+		d.events = redisEvents
+		d.closers = append(d.closers, func() { redisEvents.Close() })
+	}
+
+	// 3. Очередь: RabbitMQ или таблица в PostgreSQL
+	if err := d.connectQueue(cfg, pgRepo); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	// 4. Создание нотификаторов
+	if enot, err := notifier.NewEmailNotifier(cfg.Email); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Error with creating Email notifier")
+	} else {
+		d.notifiers = append(d.notifiers, enot)
+	}
+	if tnot, err := notifier.NewTelegramNotifier(cfg.Telegram); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Error with creating Telegram notifier")
+	} else {
+		d.notifiers = append(d.notifiers, tnot)
+	}
+	if wnot, err := notifier.NewWebhookNotifier(cfg.Webhook); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Error with creating Webhook notifier")
+	} else {
+		d.notifiers = append(d.notifiers, wnot)
+	}
+
+	zlog.Logger.Info().Int("count", len(d.notifiers)).Msg("Notifiers initialized")
+	return d, nil
+}
+
+// connectQueue создает очередь бэкенда cfg.Queue.Backend. Очередь postgres использует
+// подключение репозитория и закрывается раньше него.
+func (d *deps) connectQueue(cfg *config.Config, pgRepo *postgres.NotificationRepository) error {
+	switch cfg.Queue.Backend {
+	case config.QueueBackendPostgres:
+		pgQueue := pgRepo.Queue(cfg.Queue.PollInterval, cfg.Queue.VisibilityTimeout, cfg.Retry.WorkerCount)
+		d.queue = pgQueue
+		d.closers = append(d.closers, func() {
+			if err := pgQueue.Close(); err != nil {
+				zlog.Logger.Error().Err(err).Msg("Error closing PostgreSQL queue")
+			}
+		})
+		zlog.Logger.Info().Msg("Using PostgreSQL queue")
+		return nil
+
+	case config.QueueBackendRabbitMQ:
+		rabbitMQ, err := queue.NewRabbitMQAdapter(cfg.RabbitMQ.GetURL(), cfg.Retry.WorkerCount)
+		if err != nil {
+			return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		}
+		d.queue = rabbitMQ
+		d.closers = append(d.closers, func() {
+			if err := rabbitMQ.Close(); err != nil {
+				zlog.Logger.Error().Err(err).Msg("Error closing RabbitMQ connection")
+			} else {
+				zlog.Logger.Info().Msg("RabbitMQ connection closed")
+			}
+		})
+		return nil
+
+	default:
+		return fmt.Errorf("unknown queue backend %q", cfg.Queue.Backend)
+	}
+}
+
+// newInMemoryDeps создает зависимости dev-режима: хранилище, кэш и очередь в памяти
+// и нотификаторы, которые только записывают отправки в лог. Данные теряются при остановке.
+func newInMemoryDeps(cfg *config.Config) *deps {
+	memQueue := memory.NewQueue(memory.RealClock{})
+	eventBus := memory.NewEventBus()
+	return &deps{
+		repo:   memory.NewRepository(),
+		cache:  memory.NewCache(memory.RealClock{}, cfg.Redis.CacheTTL, cfg.Redis.TombstoneTTL),
+		queue:  memQueue,
+		events: eventBus,
+		notifiers: []service.Notifier{
+			memory.NewRecordingNotifier(notifier.EmailType).WithAttachments(),
+			memory.NewRecordingNotifier(notifier.TelegramType),
+			memory.NewRecordingNotifier(notifier.WebhookType),
+		},
+		closers: []func(){
+			func() {
+				if err := memQueue.Close(); err != nil {
+					zlog.Logger.Error().Err(err).Msg("Error closing in-memory queue")
+				}
+			},
+			func() { eventBus.Close() },
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/server"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/WB_project_3/task1/internal/telegram"
+	"github.com/pozedorum/WB_project_3/task1/internal/worker"
+	"github.com/pozedorum/wbf/ginext"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+const (
+	serverShutdownTimeout = 30 * time.Second
+	workerShutdownTimeout = 10 * time.Second
+)
+
+// roles - компоненты, которые запускает процесс.
+type roles struct {
+	api    bool
+	worker bool
+}
+
+// runConnected запускает роли с подключением к PostgreSQL, Redis и очереди.
+func runConnected(ctx context.Context, cfg *config.Config, r roles) error {
+	d, err := newConnectedDeps(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	return run(ctx, cfg, d, r)
+}
+
+// run запускает HTTP-сервер и, для роли worker, обработку outbox и очереди,
+// а после отмены ctx останавливает их и закрывает зависимости.
+func run(ctx context.Context, cfg *config.Config, d *deps, r roles) error {
+	defer d.Close()
+
+	// 1. Создание сервисов
+	notificationService := service.NewNotificationService(d.repo, d.cache, d.queue, d.notifiers, d.events)
+	templateService := service.NewTemplateService(d.repo)
+	preferencesService := service.NewPreferencesService(d.repo, d.notifiers)
+	telegramService := service.NewTelegramService(d.repo, cfg.Telegram.LinkTTL, cfg.Telegram.BotUsername)
+
+	var notificationWorker *worker.Worker
+	var workerStatus server.WorkerStatus
+	if r.worker {
+		limiter := worker.NewRateLimiter(cfg.RateLimit)
+		notificationWorker = worker.NewWorker(notificationService, cfg.Retry.WorkerCount, limiter)
+		workerStatus = notificationWorker
+	}
+
+	// 2. HTTP-сервер: API или только проверки готовности и метрики для роли worker
+	server := server.New(notificationService, templateService, preferencesService, telegramService, workerStatus)
+	router := ginext.New()
+	apiGroup := router.Group("")
+	if r.api {
+		router.LoadHTMLGlob("internal/frontend/templates/*.html")
+		server.SetupRoutes(apiGroup)
+	} else {
+		server.SetupProbeRoutes(apiGroup)
+	}
+
+	serverAddr := ":" + cfg.Server.Port
+	httpServer := &http.Server{
+		Addr:    serverAddr,
+		Handler: router,
+	}
+	httpServer.RegisterOnShutdown(server.CloseStreams)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		zlog.Logger.Info().Str("address", serverAddr).Msg("Starting HTTP server")
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Команды боту обрабатывает процесс с API: getUpdates допускает только одного получателя,
+	// поэтому TELEGRAM_COMMANDS включается на одном экземпляре
+	if r.api && cfg.Telegram.Commands {
+		if bot, err := telegram.NewBot(cfg.Telegram, telegramService, notificationService); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Telegram bot commands disabled")
+		} else {
+			bot.Start()
+			defer bot.Stop()
+		}
+	}
+
+	// 3. Запуск relay для outbox, поиска зависших отправок и воркера
+	var stopWorker func()
+	if r.worker {
+		relay := worker.NewOutboxRelay(notificationService, cfg.Outbox.PollInterval, cfg.Outbox.ScheduleWindow, cfg.Outbox.BatchSize)
+		relay.Start(context.Background())
+
+		reaper := worker.NewLeaseReaper(notificationService, cfg.Retry.LeaseCheckInterval)
+		reaper.Start(context.Background())
+
+		stopWorker = func() {
+			relay.Stop()
+			reaper.Stop()
+			notificationWorker.Stop()
+		}
+
+		if err := notificationWorker.Start(context.Background(), "notifications_queue"); err != nil {
+			shutdown(httpServer, stopWorker)
+			return err
+		}
+		zlog.Logger.Info().Msg("Worker started")
+	}
+
+	// 4. Graceful Shutdown
+	var err error
+	select {
+	case <-ctx.Done():
+		zlog.Logger.Info().Msg("Shutting down...")
+	case err = <-serverErr:
+		zlog.Logger.Error().Err(err).Msg("HTTP server failed, shutting down")
+	}
+
+	shutdown(httpServer, stopWorker)
+	return err
+}
+
+// shutdown останавливает HTTP-сервер, а затем воркер, если stopWorker задан.
+func shutdown(httpServer *http.Server, stopWorker func()) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		zlog.Logger.Error().Err(err).Msg("HTTP server shutdown error")
+	} else {
+		zlog.Logger.Info().Msg("HTTP server stopped gracefully")
+	}
+
+	if stopWorker == nil {
+		return
+	}
+
+	workerStopChan := make(chan struct{})
+	go func() {
+		stopWorker()
+		close(workerStopChan)
+	}()
+
+	select {
+	case <-workerStopChan:
+		zlog.Logger.Info().Msg("Worker stopped gracefully")
+	case <-time.After(workerShutdownTimeout):
+		zlog.Logger.Info().Msg("Worker shutdown timeout")
+	}
+}
+
+// migrate применяет миграции из dir к PostgreSQL из конфигурации.
+func migrate(ctx context.Context, cfg *config.Config, dir string) error {
+	pgRepo, err := connectPostgres(cfg)
+	if err != nil {
+		return err
+	}
+	defer pgRepo.Close()
+
+	applied, err := pgRepo.Migrate(ctx, dir)
+	if err != nil {
+		return err
+	}
+	zlog.Logger.Info().Int("applied", len(applied)).Str("dir", dir).Msg("Migrations complete")
+	return nil
+}
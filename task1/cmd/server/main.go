@@ -1,8 +0,0 @@
-package server
-
-import "github.com/pozedorum/WB_project_3/task1/internal/config"
-
-func main() {
-	conf := config.Load()
-
-}
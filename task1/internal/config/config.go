@@ -12,13 +12,17 @@ import (
 
 // Config объединяет конфигурацию всех компонентов приложения.
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	RabbitMQ RabbitMQConfig
-	Email    EmailConfig
-	Telegram TelegramConfig
-	Retry    RetryConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Redis     RedisConfig
+	RabbitMQ  RabbitMQConfig
+	Queue     QueueConfig
+	Email     EmailConfig
+	Telegram  TelegramConfig
+	Webhook   WebhookConfig
+	Retry     RetryConfig
+	Outbox    OutboxConfig
+	RateLimit RateLimitConfig
 }
 
 // ServerConfig содержит параметры HTTP-сервера.
@@ -47,6 +51,9 @@ type RedisConfig struct {
 	Port     string
 	Password string
 	DB       int
+	// Время жизни закэшированного уведомления и надгробия удаленного
+	CacheTTL     time.Duration
+	TombstoneTTL time.Duration
 }
 
 // RabbitMQConfig содержит параметры подключения к RabbitMQ.
@@ -61,25 +68,99 @@ func (r RabbitMQConfig) GetURL() string {
 	return fmt.Sprintf("amqp://%s:%s@%s:%s/", r.User, r.Password, r.Host, r.Port)
 }
 
-// EmailConfig содержит настройки SMTP-сервера.
+// Бэкенды очереди отложенных сообщений.
+const (
+	QueueBackendRabbitMQ = "rabbitmq" // отложенная очередь RabbitMQ с DLX
+	QueueBackendPostgres = "postgres" // таблица notification_queue, для развертываний без RabbitMQ
+)
+
+// QueueConfig выбирает бэкенд очереди. PollInterval и VisibilityTimeout используются
+// бэкендом postgres: как часто потребитель ищет готовые сообщения и через сколько
+// неподтвержденное сообщение снова становится доступным.
+type QueueConfig struct {
+	Backend           string
+	PollInterval      time.Duration
+	VisibilityTimeout time.Duration
+}
+
+// Режимы шифрования соединения с SMTP-сервером.
+const (
+	SMTPTLSImplicit = "tls"      // TLS с самого начала соединения, обычно порт 465
+	SMTPTLSStartTLS = "starttls" // переход на TLS командой STARTTLS, обычно порт 587
+	SMTPTLSNone     = "none"     // без шифрования, только для локальных серверов
+)
+
+// EmailConfig содержит настройки SMTP-сервера. Без SMTPUser письма отправляются без авторизации,
+// без SMTPFrom отправителем считается SMTPUser. Timeout ограничивает отправку одного письма
+// вместе со скачиванием вложений.
 type EmailConfig struct {
 	SMTPHost     string
 	SMTPPort     int
 	SMTPUser     string
 	SMTPPassword string
 	SMTPFrom     string
+	TLSMode      string
+	Timeout      time.Duration
 }
 
-// TelegramConfig содержит настройки Telegram Bot API.
+// TelegramAPIEndpoint - адрес Telegram Bot API, первый %s - токен бота, второй - метод
+const TelegramAPIEndpoint = "https://api.telegram.org/bot%s/%s"
+
+// TelegramConfig содержит настройки Telegram Bot API. Commands включает обработку команд
+// бота через long polling: Telegram отдает обновления только одному получателю, поэтому
+// команды включаются на одном экземпляре сервиса.
 type TelegramConfig struct {
-	BotToken string
+	BotToken    string
+	BotUsername string // для ссылки t.me/<bot>?start=<token>
+	APIEndpoint string
+	Commands    bool
+	PollTimeout time.Duration
+	LinkTTL     time.Duration // время жизни токена привязки чата
+}
+
+// WebhookConfig содержит секрет для подписи webhook-запросов и таймаут одного запроса.
+type WebhookConfig struct {
+	Secret  string
+	Timeout time.Duration
 }
 
 // RetryConfig определяет параметры повторных попыток обработки уведомлений.
 type RetryConfig struct {
 	MaxRetries  int
 	BaseDelay   time.Duration
-	WorkerCount int
+	WorkerCount int // максимальное число одновременно обрабатываемых сообщений
+	// LeaseCheckInterval - как часто искать уведомления, зависшие в статусе sending
+	LeaseCheckInterval time.Duration
+}
+
+// DelayedQueueTTL - x-message-ttl отложенной очереди RabbitMQ. Более длинная задержка
+// сообщения обрезается брокером до этого значения, и уведомление пришло бы раньше send_at.
+const DelayedQueueTTL = 24 * time.Hour
+
+// maxScheduleWindow - наибольшее окно планирования, задержки в котором заведомо меньше DelayedQueueTTL
+const maxScheduleWindow = DelayedQueueTTL - time.Hour
+
+// OutboxConfig определяет параметры relay, публикующего записи outbox в очередь.
+// ScheduleWindow - насколько заранее уведомление публикуется в отложенную очередь,
+// не больше maxScheduleWindow.
+type OutboxConfig struct {
+	PollInterval   time.Duration
+	ScheduleWindow time.Duration
+	BatchSize      int
+}
+
+// RateLimit - token bucket: PerSecond отправок в секунду с запасом Burst.
+// Нулевой PerSecond отключает ограничение.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// RateLimitConfig задает ограничения отправки для каждого канала в целом
+// и для одного получателя внутри канала.
+type RateLimitConfig struct {
+	Channels     map[string]RateLimit
+	PerRecipient map[string]RateLimit
 }
 
 func Load() *Config {
@@ -105,6 +186,9 @@ func Load() *Config {
 			Port:     getEnv("REDIS_PORT", "6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
+
+			CacheTTL:     getEnvAsDuration("CACHE_TTL", time.Hour),
+			TombstoneTTL: getEnvAsDuration("CACHE_TOMBSTONE_TTL", 24*time.Hour),
 		},
 		RabbitMQ: RabbitMQConfig{
 			Host:     getEnv("RABBITMQ_HOST", "localhost"),
@@ -112,20 +196,57 @@ func Load() *Config {
 			User:     getEnv("RABBITMQ_USER", "guest"),
 			Password: getEnv("RABBITMQ_PASSWORD", "guest"),
 		},
+		Queue: QueueConfig{
+			Backend:           getEnv("QUEUE_BACKEND", QueueBackendRabbitMQ),
+			PollInterval:      getEnvAsDuration("QUEUE_POLL_INTERVAL", 500*time.Millisecond),
+			VisibilityTimeout: getEnvAsDuration("QUEUE_VISIBILITY_TIMEOUT", 5*time.Minute),
+		},
 		Email: EmailConfig{
 			SMTPHost:     getEnv("SMTP_HOST", ""),
 			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
 			SMTPUser:     getEnv("SMTP_USER", ""),
 			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 			SMTPFrom:     getEnv("SMTP_FROM", ""),
+			TLSMode:      getEnv("SMTP_TLS", ""),
+			Timeout:      getEnvAsDuration("SMTP_TIMEOUT", 30*time.Second),
 		},
 		Telegram: TelegramConfig{
-			BotToken: getEnv("TELEGRAM_BOT_TOKEN", ""),
+			BotToken:    getEnv("TELEGRAM_BOT_TOKEN", ""),
+			BotUsername: getEnv("TELEGRAM_BOT_USERNAME", ""),
+			APIEndpoint: getEnv("TELEGRAM_API_ENDPOINT", TelegramAPIEndpoint),
+			Commands:    getEnvAsBool("TELEGRAM_COMMANDS", false),
+			PollTimeout: getEnvAsDuration("TELEGRAM_POLL_TIMEOUT", 30*time.Second),
+			LinkTTL:     getEnvAsDuration("TELEGRAM_LINK_TTL", 15*time.Minute),
+		},
+		Webhook: WebhookConfig{
+			Secret:  getEnv("WEBHOOK_SECRET", ""),
+			Timeout: getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
 		},
 		Retry: RetryConfig{
 			MaxRetries:  getEnvAsInt("MAX_RETRIES", 3),
 			BaseDelay:   getEnvAsDuration("BASE_DELAY", 1*time.Second),
 			WorkerCount: getEnvAsInt("WORKER_COUNT", 5),
+
+			LeaseCheckInterval: getEnvAsDuration("LEASE_CHECK_INTERVAL", 30*time.Second),
+		},
+		Outbox: OutboxConfig{
+			PollInterval:   getEnvAsDuration("OUTBOX_POLL_INTERVAL", 1*time.Second),
+			ScheduleWindow: scheduleWindow(getEnvAsDuration("SCHEDULE_WINDOW", 10*time.Second)),
+			BatchSize:      getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+		},
+		// Значения по умолчанию соответствуют лимитам Telegram Bot API (30 сообщений в секунду,
+		// 1 сообщение в секунду в один чат) и типичным лимитам SMTP-провайдеров
+		RateLimit: RateLimitConfig{
+			Channels: map[string]RateLimit{
+				"telegram": getEnvAsRateLimit("RATE_LIMIT_TELEGRAM", 30, 30),
+				"email":    getEnvAsRateLimit("RATE_LIMIT_EMAIL", 5, 10),
+				"webhook":  getEnvAsRateLimit("RATE_LIMIT_WEBHOOK", 50, 50),
+			},
+			PerRecipient: map[string]RateLimit{
+				"telegram": getEnvAsRateLimit("RATE_LIMIT_TELEGRAM_RECIPIENT", 1, 1),
+				"email":    getEnvAsRateLimit("RATE_LIMIT_EMAIL_RECIPIENT", 1, 5),
+				"webhook":  getEnvAsRateLimit("RATE_LIMIT_WEBHOOK_RECIPIENT", 10, 20),
+			},
 		},
 	}
 }
@@ -153,3 +274,39 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// scheduleWindow ограничивает окно планирования сверху maxScheduleWindow
+func scheduleWindow(window time.Duration) time.Duration {
+	if window > maxScheduleWindow {
+		zlog.Logger.Warn().
+			Dur("schedule_window", window).
+			Dur("max_schedule_window", maxScheduleWindow).
+			Msg("SCHEDULE_WINDOW exceeds delayed queue TTL, clamping")
+		return maxScheduleWindow
+	}
+	return window
+}
+
+// getEnvAsRateLimit читает ограничение из переменных KEY (отправок в секунду) и KEY_BURST
+func getEnvAsRateLimit(key string, perSecond float64, burst int) RateLimit {
+	return RateLimit{
+		PerSecond: getEnvAsFloat(key, perSecond),
+		Burst:     getEnvAsInt(key+"_BURST", burst),
+	}
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// CreateBatch сохраняет рассылку и все ее уведомления целиком или не сохраняет ничего.
+func (r *Repository) CreateBatch(ctx context.Context, b *models.Batch, notifications []*models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, n := range notifications {
+		if n.IdempotencyKey != "" && r.findByIdempotencyKey(n.UserID, n.IdempotencyKey) != nil {
+			return models.ErrDuplicateIdempotencyKey
+		}
+	}
+
+	for _, n := range notifications {
+		if err := r.insertNotification(n); err != nil {
+			// Откатываем уже добавленные уведомления рассылки
+			for _, added := range notifications {
+				r.deleteNotification(added.ID)
+			}
+			return err
+		}
+	}
+	r.batches[b.ID] = models.Batch{ID: b.ID, Total: b.Total, CreatedAt: b.CreatedAt}
+	return nil
+}
+
+// GetBatch возвращает рассылку с числом уведомлений по статусам или ErrBatchNotFound.
+func (r *Repository) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.batches[id]
+	if !ok {
+		return nil, models.ErrBatchNotFound
+	}
+	b.Counts = make(map[string]int)
+	for _, rec := range r.notifications {
+		if rec.n.BatchID == id {
+			b.Counts[rec.n.Status]++
+		}
+	}
+	return &b, nil
+}
+
+// RecordAttempt сохраняет попытку отправки и увеличивает счетчик попыток уведомления.
+// Ошибка неудачной попытки становится last_error уведомления.
+func (r *Repository) RecordAttempt(ctx context.Context, a *models.Attempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[a.NotificationID]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	r.nextAttemptID++
+	a.ID = r.nextAttemptID
+	r.attempts[a.NotificationID] = append(r.attempts[a.NotificationID], *a)
+
+	rec.n.Attempts++
+	rec.n.Revision++
+	if a.Error != "" {
+		rec.n.LastError = a.Error
+	}
+	return nil
+}
+
+// ListAttempts возвращает попытки отправки уведомления в хронологическом порядке.
+func (r *Repository) ListAttempts(ctx context.Context, notificationID string) ([]*models.Attempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []*models.Attempt
+	for _, a := range r.attempts[notificationID] {
+		a := a
+		res = append(res, &a)
+	}
+	return res, nil
+}
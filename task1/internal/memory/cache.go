@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+)
+
+// Cache - кэш уведомлений в памяти с теми же правилами, что у NotificationCache в Redis:
+// записи хранятся в JSON и истекают через ttl, Set не заменяет более новую ревизию и надгробие.
+type Cache struct {
+	clock        Clock
+	ttl          time.Duration
+	tombstoneTTL time.Duration
+
+	mu    sync.Mutex
+	items map[string]cacheItem
+}
+
+type cacheItem struct {
+	data      []byte
+	revision  int64
+	deleted   bool
+	expiresAt time.Time
+}
+
+// NewCache создает кэш, время жизни записей которого отсчитывается по clock. nil - системное время.
+func NewCache(clock Clock, ttl, tombstoneTTL time.Duration) *Cache {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	return &Cache{clock: clock, ttl: ttl, tombstoneTTL: tombstoneTTL, items: make(map[string]cacheItem)}
+}
+
+func (c *Cache) Set(ctx context.Context, id string, n *models.Notification) error {
+	if n == nil {
+		return errors.New("cannot cache nil notification, use Tombstone")
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur, ok := c.lookup(id); ok && (cur.deleted || cur.revision > n.Revision) {
+		return nil
+	}
+	c.items[id] = cacheItem{data: data, revision: n.Revision, expiresAt: c.clock.Now().Add(c.ttl)}
+	return nil
+}
+
+func (c *Cache) Get(ctx context.Context, id string) (*models.Notification, error) {
+	c.mu.Lock()
+	item, ok := c.lookup(id)
+	c.mu.Unlock()
+	if !ok {
+		return nil, models.ErrCacheMiss
+	}
+	if item.deleted {
+		return nil, models.ErrNotFound
+	}
+
+	var n models.Notification
+	if err := json.Unmarshal(item.data, &n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (c *Cache) Tombstone(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[id] = cacheItem{deleted: true, expiresAt: c.clock.Now().Add(c.tombstoneTTL)}
+	return nil
+}
+
+func (c *Cache) Delete(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, id)
+	return nil
+}
+
+func (c *Cache) Ping(ctx context.Context) (string, error) {
+	return "PONG", nil
+}
+
+func (c *Cache) Close() error {
+	return nil
+}
+
+// lookup возвращает неистекшую запись, истекшая удаляется. Вызывается под блокировкой.
+func (c *Cache) lookup(id string) (cacheItem, bool) {
+	item, ok := c.items[id]
+	if !ok {
+		return cacheItem{}, false
+	}
+	if !c.clock.Now().Before(item.expiresAt) {
+		delete(c.items, id)
+		return cacheItem{}, false
+	}
+	return item, true
+}
+
+var _ service.Cache = (*Cache)(nil)
+
+// NopCache - кэш, который ничего не хранит: каждое чтение идет в репозиторий.
+// Используется, когда Redis не настроен, - кэш в памяти процесса разошелся бы между репликами.
+type NopCache struct{}
+
+func (NopCache) Set(ctx context.Context, id string, n *models.Notification) error {
+	return nil
+}
+
+func (NopCache) Get(ctx context.Context, id string) (*models.Notification, error) {
+	return nil, models.ErrCacheMiss
+}
+
+func (NopCache) Tombstone(ctx context.Context, id string) error {
+	return nil
+}
+
+func (NopCache) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (NopCache) Ping(ctx context.Context) (string, error) {
+	return "PONG", nil
+}
+
+func (NopCache) Close() error {
+	return nil
+}
+
+var _ service.Cache = NopCache{}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_IgnoresStaleRevision(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(NewFakeClock(time.Now()), time.Hour, time.Hour)
+
+	sending := &models.Notification{ID: "n-1", Status: models.StatusSending, Revision: 3}
+	require.NoError(t, cache.Set(ctx, "n-1", sending))
+
+	// Прочитанное до захвата состояние pending не должно вернуться в кэш
+	require.NoError(t, cache.Set(ctx, "n-1", &models.Notification{ID: "n-1", Status: models.StatusPending, Revision: 2}))
+	got, err := cache.Get(ctx, "n-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSending, got.Status)
+
+	require.NoError(t, cache.Set(ctx, "n-1", &models.Notification{ID: "n-1", Status: models.StatusSent, Revision: 4}))
+	got, err = cache.Get(ctx, "n-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSent, got.Status)
+}
+
+func TestCache_TombstoneAndTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(clock, time.Minute, time.Hour)
+
+	_, err := cache.Get(ctx, "n-1")
+	assert.ErrorIs(t, err, models.ErrCacheMiss)
+
+	require.NoError(t, cache.Set(ctx, "n-1", &models.Notification{ID: "n-1", Revision: 1}))
+	require.NoError(t, cache.Tombstone(ctx, "n-1"))
+	require.NoError(t, cache.Set(ctx, "n-1", &models.Notification{ID: "n-1", Revision: 9}))
+	_, err = cache.Get(ctx, "n-1")
+	assert.ErrorIs(t, err, models.ErrNotFound, "tombstone must win over any revision")
+
+	clock.Advance(time.Hour)
+	_, err = cache.Get(ctx, "n-1")
+	assert.ErrorIs(t, err, models.ErrCacheMiss)
+
+	require.NoError(t, cache.Set(ctx, "n-2", &models.Notification{ID: "n-2", Revision: 1}))
+	clock.Advance(time.Minute)
+	_, err = cache.Get(ctx, "n-2")
+	assert.ErrorIs(t, err, models.ErrCacheMiss)
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - источник времени для Queue. В тестах вместо реального времени
+// используется FakeClock, который продвигается вручную.
+type Clock interface {
+	Now() time.Time
+	// WaitUntil возвращает канал, в который придет текущее время, когда часы дойдут до t
+	WaitUntil(t time.Time) <-chan time.Time
+}
+
+// RealClock - системное время.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) WaitUntil(t time.Time) <-chan time.Time {
+	return time.After(time.Until(t))
+}
+
+// FakeClock - часы, которые идут только при вызове Advance или Set.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) WaitUntil(t time.Time) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if !t.After(c.now) {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: t, ch: ch})
+	return ch
+}
+
+// Advance переводит часы вперед на d и будит ожидания, время которых наступило.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set устанавливает текущее время. Часы не идут назад: более раннее время игнорируется.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(now)
+}
+
+func (c *FakeClock) set(now time.Time) {
+	if now.Before(c.now) {
+		return
+	}
+	c.now = now
+
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- now
+	}
+	c.waiters = remaining
+}
+
+var (
+	_ Clock = RealClock{}
+	_ Clock = (*FakeClock)(nil)
+)
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// subscriberBuffer - сколько событий подписчик может не прочитать, прежде чем новые начнут теряться
+const subscriberBuffer = 64
+
+// EventBus рассылает события о смене статусов подписчикам внутри одного процесса.
+// Подходит для dev-режима и запуска одной репликой: события других процессов не видны.
+// Медленный подписчик не задерживает публикацию, не поместившиеся в его буфер события теряются.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan models.StatusEvent]struct{}
+	closed      bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan models.StatusEvent]struct{})}
+}
+
+func (b *EventBus) Publish(ctx context.Context, event models.StatusEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			zlog.Logger.Warn().Str("notification_id", event.NotificationID).Msg("Status event dropped for slow subscriber")
+		}
+	}
+	return nil
+}
+
+func (b *EventBus) Subscribe(ctx context.Context) (<-chan models.StatusEvent, error) {
+	ch := make(chan models.StatusEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, nil
+	}
+	b.subscribers[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(ch)
+	}()
+	return ch, nil
+}
+
+// Close закрывает каналы всех подписчиков
+func (b *EventBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	return nil
+}
+
+func (b *EventBus) unsubscribe(ch chan models.StatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+var _ service.StatusEvents = (*EventBus)(nil)
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus_FansOutAndUnsubscribes(t *testing.T) {
+	bus := NewEventBus()
+	ctx := context.Background()
+
+	first, err := bus.Subscribe(ctx)
+	require.NoError(t, err)
+	secondCtx, cancelSecond := context.WithCancel(ctx)
+	second, err := bus.Subscribe(secondCtx)
+	require.NoError(t, err)
+
+	event := models.StatusEvent{NotificationID: "id-1", Status: models.StatusSent}
+	require.NoError(t, bus.Publish(ctx, event))
+	assert.Equal(t, event, <-first)
+	assert.Equal(t, event, <-second)
+
+	// Отмена контекста закрывает канал подписчика
+	cancelSecond()
+	_, open := <-second
+	assert.False(t, open)
+
+	require.NoError(t, bus.Close())
+	_, open = <-first
+	assert.False(t, open)
+}
+
+func TestEventBus_DropsEventsForSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	events, err := bus.Subscribe(context.Background())
+	require.NoError(t, err)
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		require.NoError(t, bus.Publish(context.Background(), models.StatusEvent{NotificationID: "id-1"}))
+	}
+	assert.Len(t, events, subscriberBuffer)
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// RecordingNotifier запоминает отправленные уведомления вместо доставки. Ошибки,
+// заданные через FailNext, возвращаются следующими отправками по очереди.
+type RecordingNotifier struct {
+	channel     string
+	attachments bool
+
+	mu       sync.Mutex
+	sent     []models.Notification
+	failures []error
+	// changed закрывается и заменяется после каждой отправки, чтобы разбудить WaitSent
+	changed chan struct{}
+}
+
+func NewRecordingNotifier(channel string) *RecordingNotifier {
+	return &RecordingNotifier{channel: channel, changed: make(chan struct{})}
+}
+
+func (n *RecordingNotifier) Send(notification *models.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.failures) > 0 {
+		err := n.failures[0]
+		n.failures = n.failures[1:]
+		return err
+	}
+
+	n.sent = append(n.sent, *notification)
+	close(n.changed)
+	n.changed = make(chan struct{})
+
+	zlog.Logger.Info().
+		Str("channel", n.channel).
+		Str("notification_id", notification.ID).
+		Str("recipient", notification.UserID).
+		Str("message", notification.Message).
+		Msg("Notification recorded")
+	return nil
+}
+
+func (n *RecordingNotifier) GetChannel() string {
+	return n.channel
+}
+
+// WithAttachments разрешает уведомления с вложениями, как у настоящего канала email.
+func (n *RecordingNotifier) WithAttachments() *RecordingNotifier {
+	n.attachments = true
+	return n
+}
+
+func (n *RecordingNotifier) SendsAttachments() bool {
+	return n.attachments
+}
+
+// FailNext задает ошибки, которые вернут следующие вызовы Send.
+func (n *RecordingNotifier) FailNext(errs ...error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, errs...)
+}
+
+// Sent возвращает копию списка отправленных уведомлений в порядке отправки.
+func (n *RecordingNotifier) Sent() []models.Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]models.Notification(nil), n.sent...)
+}
+
+// WaitSent ждет, пока будет отправлено не меньше count уведомлений, и возвращает их.
+func (n *RecordingNotifier) WaitSent(ctx context.Context, count int) ([]models.Notification, error) {
+	for {
+		n.mu.Lock()
+		if len(n.sent) >= count {
+			sent := append([]models.Notification(nil), n.sent...)
+			n.mu.Unlock()
+			return sent, nil
+		}
+		changed := n.changed
+		n.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return n.Sent(), ctx.Err()
+		}
+	}
+}
+
+var (
+	_ service.Notifier         = (*RecordingNotifier)(nil)
+	_ service.AttachmentSender = (*RecordingNotifier)(nil)
+)
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// ClaimOutboxBatch захватывает до limit неотправленных записей outbox со временем отправки
+// не позже dueBefore на время lease, в порядке времени отправки.
+func (r *Repository) ClaimOutboxBatch(ctx context.Context, limit int, dueBefore time.Time, lease time.Duration) ([]models.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var due []*outboxRecord
+	for _, o := range r.outbox {
+		if o.dispatched || o.msg.SendAt.After(dueBefore) || o.lockedUntil.After(now) {
+			continue
+		}
+		due = append(due, o)
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].msg.SendAt.Before(due[j].msg.SendAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	messages := make([]models.OutboxMessage, 0, len(due))
+	for _, o := range due {
+		o.lockedUntil = now.Add(lease)
+		msg := o.msg
+		msg.Payload = append([]byte(nil), o.msg.Payload...)
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// MarkOutboxDispatched помечает запись outbox как опубликованную в очередь.
+func (r *Repository) MarkOutboxDispatched(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, o := range r.outbox {
+		if o.msg.ID == id {
+			o.dispatched = true
+			o.lockedUntil = time.Time{}
+			break
+		}
+	}
+	return nil
+}
+
+// OutboxLen возвращает число записей outbox, еще не опубликованных в очередь.
+func (r *Repository) OutboxLen() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := 0
+	for _, o := range r.outbox {
+		if !o.dispatched {
+			pending++
+		}
+	}
+	return pending
+}
+
+// insertOutbox добавляет запись outbox, вызывается под блокировкой репозитория.
+func (r *Repository) insertOutbox(n *models.Notification, sendAt time.Time) error {
+	payload, err := marshalPayload(n)
+	if err != nil {
+		return err
+	}
+
+	r.nextOutboxID++
+	r.outbox = append(r.outbox, &outboxRecord{msg: models.OutboxMessage{
+		ID:             r.nextOutboxID,
+		NotificationID: n.ID,
+		Payload:        payload,
+		SendAt:         sendAt,
+		CreatedAt:      time.Now(),
+	}})
+	return nil
+}
+
+// dropOutbox удаляет записи outbox, для которых match возвращает true.
+func (r *Repository) dropOutbox(match func(o *outboxRecord) bool) {
+	kept := r.outbox[:0]
+	for _, o := range r.outbox {
+		if !match(o) {
+			kept = append(kept, o)
+		}
+	}
+	for i := len(kept); i < len(r.outbox); i++ {
+		r.outbox[i] = nil
+	}
+	r.outbox = kept
+}
@@ -0,0 +1,297 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+var (
+	ErrQueueClosed    = errors.New("queue is closed")
+	errAlreadySettled = errors.New("delivery already acknowledged")
+)
+
+// Queue - очередь в памяти с отложенной доставкой. Как и RabbitMQAdapter, она содержит одну
+// основную очередь: имя очереди в PublishWithDelay и Consume используется только в логах.
+// Сообщение становится доступным потребителям, когда часы clock дойдут до времени публикации
+// плюс задержка. Неподтвержденные сообщения, отклоненные с requeue, возвращаются в очередь.
+type Queue struct {
+	clock Clock
+
+	mu          sync.Mutex
+	pending     delayHeap
+	seq         uint64
+	unacked     int
+	deadLetters []models.DeadLetter
+	// changed закрывается и заменяется при каждом добавлении сообщения, чтобы разбудить потребителей
+	changed chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewQueue создает очередь, задержки которой отсчитываются по clock. nil - системное время.
+func NewQueue(clock Clock) *Queue {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	return &Queue{
+		clock:   clock,
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (q *Queue) PublishWithDelay(ctx context.Context, queueName string, message interface{}, delay time.Duration) error {
+	body, err := encodeMessage(message)
+	if err != nil {
+		return err
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.isClosed() {
+		return ErrQueueClosed
+	}
+	q.push(body, q.clock.Now().Add(delay))
+
+	zlog.Logger.Debug().Str("queue", queueName).Dur("delay", delay).Msg("Published message to in-memory queue")
+	return nil
+}
+
+// PublishDeadLetter сохраняет сообщение в списке недоставленных, его можно получить через DeadLetters.
+func (q *Queue) PublishDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.isClosed() {
+		return ErrQueueClosed
+	}
+	q.deadLetters = append(q.deadLetters, dl)
+	return nil
+}
+
+// AckDeadLetters убирает из списка недоставленных сообщения уведомлений notificationIDs.
+func (q *Queue) AckDeadLetters(ctx context.Context, notificationIDs []string) error {
+	ids := make(map[string]bool, len(notificationIDs))
+	for _, id := range notificationIDs {
+		ids[id] = true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kept := q.deadLetters[:0]
+	for _, dl := range q.deadLetters {
+		if !ids[dl.Notification.ID] {
+			kept = append(kept, dl)
+		}
+	}
+	q.deadLetters = kept
+	return nil
+}
+
+// Consume возвращает канал сообщений, время доставки которых наступило. Канал небуферизованный:
+// следующее сообщение извлекается из очереди, только когда потребитель готов его принять.
+// Канал закрывается при отмене ctx или закрытии очереди.
+func (q *Queue) Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error) {
+	if q.isClosed() {
+		return nil, ErrQueueClosed
+	}
+
+	messages := make(chan models.Delivery)
+	go func() {
+		defer close(messages)
+		zlog.Logger.Info().Str("queue", queueName).Msg("In-memory consumer started")
+
+		for {
+			q.mu.Lock()
+			item, readyAt, ok := q.popDue()
+			changed := q.changed
+			q.mu.Unlock()
+
+			if ok {
+				select {
+				case messages <- q.delivery(item):
+					continue
+				case <-ctx.Done():
+				case <-q.closed:
+				}
+				q.requeue(item)
+				return
+			}
+
+			// Ждем наступления ближайшей задержки или нового сообщения
+			var due <-chan time.Time
+			if !readyAt.IsZero() {
+				due = q.clock.WaitUntil(readyAt)
+			}
+			select {
+			case <-due:
+			case <-changed:
+			case <-ctx.Done():
+				return
+			case <-q.closed:
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// Close останавливает потребителей. Повторный вызов ничего не делает.
+func (q *Queue) Close() error {
+	q.closeOnce.Do(func() { close(q.closed) })
+	return nil
+}
+
+// Len возвращает число сообщений в очереди, включая те, время доставки которых еще не наступило.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending.Len()
+}
+
+// Unacked возвращает число выданных потребителям, но еще не подтвержденных сообщений.
+func (q *Queue) Unacked() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.unacked
+}
+
+// DeadLetters возвращает сообщения, которые находятся в очереди недоставленных.
+func (q *Queue) DeadLetters() []models.DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]models.DeadLetter(nil), q.deadLetters...)
+}
+
+// delivery оборачивает извлеченное сообщение: до Ack или Nack оно считается неподтвержденным.
+// Счетчик неподтвержденных увеличивает popDue.
+func (q *Queue) delivery(item *delayedMessage) models.Delivery {
+	var settled atomic.Bool
+	return models.Delivery{
+		Body: item.body,
+		Ack: func() error {
+			if !settled.CompareAndSwap(false, true) {
+				return errAlreadySettled
+			}
+			q.mu.Lock()
+			q.unacked--
+			q.mu.Unlock()
+			return nil
+		},
+		Nack: func(requeue bool) error {
+			if !settled.CompareAndSwap(false, true) {
+				return errAlreadySettled
+			}
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.unacked--
+			if requeue {
+				q.push(item.body, q.clock.Now())
+			}
+			return nil
+		},
+	}
+}
+
+// requeue возвращает сообщение, которое не удалось передать потребителю
+func (q *Queue) requeue(item *delayedMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.unacked--
+	q.pushItem(item)
+}
+
+func (q *Queue) push(body []byte, readyAt time.Time) {
+	q.seq++
+	q.pushItem(&delayedMessage{body: body, readyAt: readyAt, seq: q.seq})
+}
+
+func (q *Queue) pushItem(item *delayedMessage) {
+	heap.Push(&q.pending, item)
+
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// popDue извлекает сообщение, время доставки которого наступило, и учитывает его как
+// неподтвержденное. Иначе возвращает время ближайшей доставки или нулевое время, если очередь пуста.
+func (q *Queue) popDue() (*delayedMessage, time.Time, bool) {
+	if q.pending.Len() == 0 {
+		return nil, time.Time{}, false
+	}
+	next := q.pending[0]
+	if next.readyAt.After(q.clock.Now()) {
+		return nil, next.readyAt, false
+	}
+	q.unacked++
+	return heap.Pop(&q.pending).(*delayedMessage), time.Time{}, true
+}
+
+func (q *Queue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeMessage сериализует сообщение так же, как RabbitMQAdapter: []byte превращается
+// в JSON-строку base64, кавычки которой снимаются при получении.
+func encodeMessage(message interface{}) ([]byte, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return []byte(s), nil
+	}
+	return data, nil
+}
+
+type delayedMessage struct {
+	body    []byte
+	readyAt time.Time
+	seq     uint64 // сохраняет порядок публикации сообщений с одинаковым временем
+}
+
+// delayHeap - min-куча сообщений по времени доставки
+type delayHeap []*delayedMessage
+
+func (h delayHeap) Len() int { return len(h) }
+
+func (h delayHeap) Less(i, j int) bool {
+	if h[i].readyAt.Equal(h[j].readyAt) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].readyAt.Before(h[j].readyAt)
+}
+
+func (h delayHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(*delayedMessage)) }
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+var _ service.Queue = (*Queue)(nil)
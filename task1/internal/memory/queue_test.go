@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, messages <-chan models.Delivery) models.Delivery {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("message was not delivered")
+		return models.Delivery{}
+	}
+}
+
+func assertNoDelivery(t *testing.T, messages <-chan models.Delivery) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected delivery: %s", msg.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestQueue_DelayFollowsClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	q := NewQueue(clock)
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages, err := q.Consume(ctx, "notifications_queue")
+	require.NoError(t, err)
+
+	require.NoError(t, q.PublishWithDelay(ctx, "notifications", "late", 2*time.Minute))
+	require.NoError(t, q.PublishWithDelay(ctx, "notifications", "early", time.Minute))
+
+	assertNoDelivery(t, messages)
+
+	clock.Advance(time.Minute)
+	msg := receive(t, messages)
+	assert.Equal(t, "early", string(msg.Body))
+	require.NoError(t, msg.Ack())
+	assertNoDelivery(t, messages)
+
+	clock.Advance(time.Minute)
+	msg = receive(t, messages)
+	assert.Equal(t, "late", string(msg.Body))
+	require.NoError(t, msg.Ack())
+
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, 0, q.Unacked())
+}
+
+func TestQueue_NackRequeues(t *testing.T) {
+	q := NewQueue(NewFakeClock(time.Now()))
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages, err := q.Consume(ctx, "notifications_queue")
+	require.NoError(t, err)
+
+	require.NoError(t, q.PublishWithDelay(ctx, "notifications", []byte(`{"id":"1"}`), 0))
+
+	msg := receive(t, messages)
+	assert.Equal(t, 1, q.Unacked())
+	require.NoError(t, msg.Nack(true))
+	assert.ErrorIs(t, msg.Ack(), errAlreadySettled)
+
+	redelivered := receive(t, messages)
+	assert.Equal(t, msg.Body, redelivered.Body)
+	require.NoError(t, redelivered.Nack(false))
+
+	assertNoDelivery(t, messages)
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, 0, q.Unacked())
+}
+
+func TestQueue_PublishAfterClose(t *testing.T) {
+	q := NewQueue(nil)
+	require.NoError(t, q.Close())
+
+	err := q.PublishWithDelay(context.Background(), "notifications", "msg", 0)
+	assert.ErrorIs(t, err, ErrQueueClosed)
+}
+
+func TestQueue_AckDeadLettersAfterReplay(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(nil)
+	defer q.Close()
+
+	for _, id := range []string{"id-1", "id-2", "id-1"} {
+		require.NoError(t, q.PublishDeadLetter(ctx, models.DeadLetter{
+			Notification: models.Notification{ID: id}, Attempts: 5, Error: "smtp down"}))
+	}
+
+	require.NoError(t, q.AckDeadLetters(ctx, []string{"id-1"}))
+	deadLetters := q.DeadLetters()
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "id-2", deadLetters[0].Notification.ID)
+	assert.Equal(t, "smtp down", deadLetters[0].Error)
+}
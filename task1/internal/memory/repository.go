@@ -0,0 +1,577 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+)
+
+// Repository хранит уведомления, содержимое вложений, outbox, попытки, рассылки, шаблоны, предпочтения
+// и привязки чатов Telegram в памяти.
+// Поведение повторяет postgres.NotificationRepository: каждый метод выполняется атомарно
+// под одной блокировкой, как транзакция, и возвращает те же ошибки модели. Каждое изменение
+// уведомления увеличивает его ревизию, как триггер notifications_revision.
+type Repository struct {
+	mu sync.Mutex
+
+	notifications map[string]*notificationRecord
+	attachments   map[string]attachmentRecord
+	outbox        []*outboxRecord
+	nextOutboxID  int64
+	attempts      map[string][]models.Attempt
+	nextAttemptID int64
+	batches       map[string]models.Batch
+	templates     map[string]*templateRecord
+	preferences   map[string]models.UserPreferences
+	telegramLinks map[string]models.TelegramLink
+	telegramChats map[int64]string
+	// canceledSeries - отмененные серии, как таблица notification_canceled_series
+	canceledSeries map[string]bool
+}
+
+type notificationRecord struct {
+	n            models.Notification
+	claimedUntil time.Time
+}
+
+// attachmentRecord - содержимое вложения, как строка notification_attachments
+type attachmentRecord struct {
+	notificationID string
+	content        []byte
+}
+
+type outboxRecord struct {
+	msg         models.OutboxMessage
+	lockedUntil time.Time
+	dispatched  bool
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		notifications:  make(map[string]*notificationRecord),
+		attachments:    make(map[string]attachmentRecord),
+		attempts:       make(map[string][]models.Attempt),
+		batches:        make(map[string]models.Batch),
+		templates:      make(map[string]*templateRecord),
+		preferences:    make(map[string]models.UserPreferences),
+		telegramLinks:  make(map[string]models.TelegramLink),
+		telegramChats:  make(map[int64]string),
+		canceledSeries: make(map[string]bool),
+	}
+}
+
+// CreateNotification сохраняет уведомление вместе с записью outbox.
+func (r *Repository) CreateNotification(ctx context.Context, n *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n.IdempotencyKey != "" && r.findByIdempotencyKey(n.UserID, n.IdempotencyKey) != nil {
+		return models.ErrDuplicateIdempotencyKey
+	}
+	return r.insertNotification(n)
+}
+
+func (r *Repository) GetByID(ctx context.Context, id string) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[id]
+	if !ok {
+		return nil, nil
+	}
+	return cloneNotification(&rec.n), nil
+}
+
+func (r *Repository) GetByIdempotencyKey(ctx context.Context, userID, key string) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rec := r.findByIdempotencyKey(userID, key); rec != nil {
+		return cloneNotification(&rec.n), nil
+	}
+	return nil, nil
+}
+
+// UpdateNotificationStatus меняет статус уведомления и сохраняет следующий повтор серии, построенный next.
+func (r *Repository) UpdateNotificationStatus(ctx context.Context, id, status string, next models.NextOccurrenceFunc) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	updated := rec.n
+	updated.Status = status
+	updated.UpdatedAt = time.Now()
+	updated.Revision++
+	if err := r.insertNextOccurrence(&updated, next); err != nil {
+		return nil, err
+	}
+	rec.n = updated
+	return cloneNotification(&rec.n), nil
+}
+
+// ClaimNotification переводит ожидающее уведомление в sending до now+lease. Если захват
+// не удался, возвращает ErrStaleVersion для сообщения устаревшей версии, иначе ErrNotPending.
+func (r *Repository) ClaimNotification(ctx context.Context, id string, version int, lease time.Duration) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[id]
+	if !ok || rec.n.Status != models.StatusPending {
+		return nil, models.ErrNotPending
+	}
+	if version != 0 && rec.n.Version != version {
+		return nil, models.ErrStaleVersion
+	}
+
+	now := time.Now()
+	rec.n.Status = models.StatusSending
+	rec.n.UpdatedAt = now
+	rec.n.Revision++
+	rec.claimedUntil = now.Add(lease)
+	return cloneNotification(&rec.n), nil
+}
+
+// ReleaseNotification возвращает захваченное уведомление в pending. Если уведомление
+// уже не в sending, возвращает nil.
+func (r *Repository) ReleaseNotification(ctx context.Context, id string) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[id]
+	if !ok || rec.n.Status != models.StatusSending {
+		return nil, nil
+	}
+	rec.n.Status = models.StatusPending
+	rec.n.UpdatedAt = time.Now()
+	rec.n.Revision++
+	rec.claimedUntil = time.Time{}
+	return cloneNotification(&rec.n), nil
+}
+
+// RecoverStuckNotifications переводит в failed уведомления, аренда которых истекла,
+// и сохраняет следующие повторы их серий.
+func (r *Repository) RecoverStuckNotifications(ctx context.Context, lastErr string, next models.NextOccurrenceFunc) ([]*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var res []*models.Notification
+	for _, rec := range r.notifications {
+		if rec.n.Status != models.StatusSending || !rec.claimedUntil.Before(now) {
+			continue
+		}
+		updated := rec.n
+		updated.Status = models.StatusFailed
+		updated.LastError = lastErr
+		updated.UpdatedAt = now
+		updated.Revision++
+		if err := r.insertNextOccurrence(&updated, next); err != nil {
+			return nil, err
+		}
+		rec.n = updated
+		rec.claimedUntil = time.Time{}
+		res = append(res, cloneNotification(&rec.n))
+	}
+	return res, nil
+}
+
+// UpdateNotification сохраняет изменения ожидающего уведомления, если его версия равна
+// expectedVersion, и заменяет неопубликованные записи outbox записью новой версии.
+func (r *Repository) UpdateNotification(ctx context.Context, n *models.Notification, expectedVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[n.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if rec.n.Status != models.StatusPending {
+		return models.ErrNotPending
+	}
+	if rec.n.Version != expectedVersion {
+		return models.ErrVersionConflict
+	}
+
+	rec.n.Message = n.Message
+	rec.n.Channel = n.Channel
+	rec.n.Channels = cloneStrings(n.Channels)
+	rec.n.SendAt = n.SendAt
+	rec.n.Version = n.Version
+	rec.n.UpdatedAt = n.UpdatedAt
+	rec.n.Revision++
+	n.Revision = rec.n.Revision
+
+	r.dropOutbox(func(o *outboxRecord) bool { return o.msg.NotificationID == n.ID && !o.dispatched })
+	return r.insertOutbox(n, n.SendAt)
+}
+
+func (r *Repository) DeleteNotification(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleteNotification(id)
+	return nil
+}
+
+// DeleteSeries отменяет серию и удаляет ее ожидающие уведомления, возвращая их идентификаторы.
+// Отправляемый повтор завершается как обычно, но следующий после него не создается.
+// Если у серии нет ни ожидающих, ни отправляемых повторов, возвращает ErrNotPending.
+func (r *Repository) DeleteSeries(ctx context.Context, seriesID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	live := false
+	for id, rec := range r.notifications {
+		if rec.n.SeriesID != seriesID {
+			continue
+		}
+		switch rec.n.Status {
+		case models.StatusPending:
+			ids = append(ids, id)
+			live = true
+		case models.StatusSending:
+			live = true
+		}
+	}
+	if !live {
+		return nil, models.ErrNotPending
+	}
+
+	r.canceledSeries[seriesID] = true
+	for _, id := range ids {
+		r.deleteNotification(id)
+	}
+	return ids, nil
+}
+
+// MarkNotificationFailed переводит ожидающее или отправляемое уведомление в failed и сохраняет
+// следующий повтор серии, построенный next. Для остальных статусов возвращает ErrNotPending.
+func (r *Repository) MarkNotificationFailed(ctx context.Context, id string, lastErr string, next models.NextOccurrenceFunc) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[id]
+	if !ok || (rec.n.Status != models.StatusPending && rec.n.Status != models.StatusSending) {
+		return nil, models.ErrNotPending
+	}
+	updated := rec.n
+	updated.Status = models.StatusFailed
+	updated.LastError = lastErr
+	updated.UpdatedAt = time.Now()
+	updated.Revision++
+	if err := r.insertNextOccurrence(&updated, next); err != nil {
+		return nil, err
+	}
+	rec.n = updated
+	return cloneNotification(&rec.n), nil
+}
+
+// ListNotifications возвращает уведомления по фильтру с keyset-пагинацией по (колонка сортировки, id).
+func (r *Repository) ListNotifications(ctx context.Context, filter models.NotificationFilter) ([]*models.Notification, error) {
+	var sortKey func(n *models.Notification) time.Time
+	switch filter.SortBy {
+	case models.SortBySendAt:
+		sortKey = func(n *models.Notification) time.Time { return n.SendAt }
+	case models.SortByCreatedAt:
+		sortKey = func(n *models.Notification) time.Time { return n.CreatedAt }
+	default:
+		return nil, fmt.Errorf("%w: unsupported sort %q", models.ErrBadFilter, filter.SortBy)
+	}
+
+	// before сообщает, что a идет раньше b в порядке сортировки
+	before := func(aKey time.Time, aID string, bKey time.Time, bID string) bool {
+		if !aKey.Equal(bKey) {
+			return aKey.Before(bKey) != filter.Desc
+		}
+		return (aID < bID) != filter.Desc
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []*models.Notification
+	for _, rec := range r.notifications {
+		n := &rec.n
+		if !matchesFilter(n, filter) {
+			continue
+		}
+		if filter.After != nil && !before(filter.After.Value, filter.After.ID, sortKey(n), n.ID) {
+			continue
+		}
+		res = append(res, cloneNotification(n))
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return before(sortKey(res[i]), res[i].ID, sortKey(res[j]), res[j].ID)
+	})
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+	return res, nil
+}
+
+// GetFailedNotifications возвращает до limit уведомлений в статусе failed, начиная с последних.
+func (r *Repository) GetFailedNotifications(ctx context.Context, limit int) ([]*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []*models.Notification
+	for _, rec := range r.notifications {
+		if rec.n.Status == models.StatusFailed {
+			res = append(res, cloneNotification(&rec.n))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].UpdatedAt.After(res[j].UpdatedAt) })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// RequeueNotification возвращает уведомление из failed в pending с первым каналом цепочки
+// и добавляет запись outbox.
+func (r *Repository) RequeueNotification(ctx context.Context, id string) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[id]
+	if !ok || rec.n.Status != models.StatusFailed {
+		return nil, models.ErrNotFailed
+	}
+	rec.n.Status = models.StatusPending
+	rec.n.UpdatedAt = time.Now()
+	rec.n.Revision++
+	if len(rec.n.Channels) > 0 {
+		rec.n.Channel = rec.n.Channels[0]
+	}
+
+	if err := r.insertOutbox(&rec.n, rec.n.SendAt); err != nil {
+		return nil, err
+	}
+	return cloneNotification(&rec.n), nil
+}
+
+// RescheduleNotification переносит ожидающее уведомление на n.SendAt и добавляет запись outbox.
+func (r *Repository) RescheduleNotification(ctx context.Context, n *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[n.ID]
+	if !ok || rec.n.Status != models.StatusPending {
+		return models.ErrNotPending
+	}
+	rec.n.SendAt = n.SendAt
+	rec.n.UpdatedAt = n.UpdatedAt
+	rec.n.Revision++
+	n.Revision = rec.n.Revision
+	return r.insertOutbox(n, n.SendAt)
+}
+
+// SwitchChannel переключает ожидающее уведомление на n.Channel и ставит его в outbox
+// для немедленной отправки.
+func (r *Repository) SwitchChannel(ctx context.Context, n *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.notifications[n.ID]
+	if !ok || rec.n.Status != models.StatusPending {
+		return models.ErrNotPending
+	}
+	rec.n.Channel = n.Channel
+	rec.n.Channels = cloneStrings(n.Channels)
+	rec.n.LastError = n.LastError
+	rec.n.UpdatedAt = n.UpdatedAt
+	rec.n.Revision++
+	n.Revision = rec.n.Revision
+	return r.insertOutbox(n, time.Now())
+}
+
+// insertNotification сохраняет копию уведомления, содержимое его вложений и запись outbox для него.
+// Вложения уведомления заменяются ссылками, версия по умолчанию выставляется до сериализации,
+// чтобы попасть в payload.
+func (r *Repository) insertNotification(n *models.Notification) error {
+	r.detachAttachments(n)
+	if n.Version == 0 {
+		n.Version = 1
+	}
+	if n.Revision == 0 {
+		n.Revision = 1
+	}
+	stored := cloneNotification(n)
+	if stored.Occurrence == 0 {
+		stored.Occurrence = 1
+	}
+
+	if err := r.insertOutbox(n, n.SendAt); err != nil {
+		return err
+	}
+	r.notifications[n.ID] = &notificationRecord{n: *stored}
+	return nil
+}
+
+// insertNextOccurrence сохраняет следующий повтор серии finished, если next его построит
+// и серия не отменена. Повтор, который уже есть, не создается заново, как при уникальном
+// индексе (series_id, occurrence).
+func (r *Repository) insertNextOccurrence(finished *models.Notification, next models.NextOccurrenceFunc) error {
+	if next == nil || finished.SeriesID == "" || r.canceledSeries[finished.SeriesID] {
+		return nil
+	}
+	for _, rec := range r.notifications {
+		if rec.n.SeriesID == finished.SeriesID && rec.n.Occurrence == finished.Occurrence+1 {
+			return nil
+		}
+	}
+	n := next(cloneNotification(finished))
+	if n == nil {
+		return nil
+	}
+	return r.insertNotification(n)
+}
+
+// detachAttachments сохраняет содержимое вложений n и заменяет их ссылками с новыми идентификаторами.
+// Повтор серии получает копию содержимого предыдущего повтора, как в postgres-репозитории.
+func (r *Repository) detachAttachments(n *models.Notification) {
+	if len(n.Attachments) == 0 {
+		return
+	}
+	refs := make([]models.Attachment, len(n.Attachments))
+	for i, a := range n.Attachments {
+		switch {
+		case len(a.Content) > 0:
+			a.ID = uuid.New().String()
+			r.attachments[a.ID] = attachmentRecord{notificationID: n.ID, content: append([]byte(nil), a.Content...)}
+			a.Content = nil
+		case a.ID != "" && a.URL == "":
+			source, ok := r.attachments[a.ID]
+			a.ID = uuid.New().String()
+			if ok {
+				r.attachments[a.ID] = attachmentRecord{notificationID: n.ID, content: source.content}
+			}
+		default:
+			a.ID = ""
+		}
+		refs[i] = a
+	}
+	n.Attachments = refs
+}
+
+// GetAttachmentContents возвращает содержимое вложений уведомления по их идентификаторам.
+func (r *Repository) GetAttachmentContents(ctx context.Context, notificationID string) (map[string][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	contents := make(map[string][]byte)
+	for id, a := range r.attachments {
+		if a.notificationID == notificationID {
+			contents[id] = append([]byte(nil), a.content...)
+		}
+	}
+	return contents, nil
+}
+
+func (r *Repository) deleteNotification(id string) {
+	delete(r.notifications, id)
+	for attachmentID, a := range r.attachments {
+		if a.notificationID == id {
+			delete(r.attachments, attachmentID)
+		}
+	}
+	delete(r.attempts, id)
+	r.dropOutbox(func(o *outboxRecord) bool { return o.msg.NotificationID == id })
+}
+
+func (r *Repository) findByIdempotencyKey(userID, key string) *notificationRecord {
+	for _, rec := range r.notifications {
+		if rec.n.UserID == userID && rec.n.IdempotencyKey == key {
+			return rec
+		}
+	}
+	return nil
+}
+
+func matchesFilter(n *models.Notification, filter models.NotificationFilter) bool {
+	if filter.UserID != "" && n.UserID != filter.UserID {
+		return false
+	}
+	if filter.Channel != "" && n.Channel != filter.Channel {
+		return false
+	}
+	if len(filter.Statuses) > 0 {
+		found := false
+		for _, status := range filter.Statuses {
+			if n.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.SendFrom != nil && n.SendAt.Before(*filter.SendFrom) {
+		return false
+	}
+	if filter.SendTo != nil && !n.SendAt.Before(*filter.SendTo) {
+		return false
+	}
+	return true
+}
+
+// cloneNotification копирует уведомление вместе со срезами и картами,
+// чтобы вызывающий код не мог изменить хранимое состояние.
+func cloneNotification(n *models.Notification) *models.Notification {
+	c := *n
+	c.Channels = cloneStrings(n.Channels)
+	if n.Variables != nil {
+		c.Variables = make(map[string]string, len(n.Variables))
+		for k, v := range n.Variables {
+			c.Variables[k] = v
+		}
+	}
+	if n.Recurrence != nil {
+		recurrence := *n.Recurrence
+		c.Recurrence = &recurrence
+	}
+	if n.Attachments != nil {
+		c.Attachments = make([]models.Attachment, len(n.Attachments))
+		for i, a := range n.Attachments {
+			a.Content = append([]byte(nil), a.Content...)
+			c.Attachments[i] = a
+		}
+	}
+	return &c
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
+
+// marshalPayload сериализует уведомление для записи outbox так же, как postgres-репозиторий
+func marshalPayload(n *models.Notification) ([]byte, error) {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+	return payload, nil
+}
+
+var (
+	_ service.Repository            = (*Repository)(nil)
+	_ service.TemplateRepository    = (*Repository)(nil)
+	_ service.PreferencesRepository = (*Repository)(nil)
+	_ service.TelegramRepository    = (*Repository)(nil)
+)
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_ClaimAndUpdateVersions(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	n := &models.Notification{ID: "n-1", UserID: "u", Message: "hi", Channel: "email",
+		Status: models.StatusPending, SendAt: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.CreateNotification(ctx, n))
+	assert.Equal(t, 1, n.Version)
+	assert.Equal(t, int64(1), n.Revision)
+	assert.Equal(t, 1, repo.OutboxLen())
+
+	// Изменение вызывающим кодом не затрагивает хранимую копию
+	n.Message = "changed"
+	stored, err := repo.GetByID(ctx, "n-1")
+	require.NoError(t, err)
+	assert.Equal(t, "hi", stored.Message)
+
+	stored.Message = "updated"
+	stored.Version = 2
+	assert.ErrorIs(t, repo.UpdateNotification(ctx, stored, 5), models.ErrVersionConflict)
+	require.NoError(t, repo.UpdateNotification(ctx, stored, 1))
+	assert.Equal(t, 1, repo.OutboxLen(), "undispatched outbox row must be replaced")
+
+	_, err = repo.ClaimNotification(ctx, "n-1", 1, time.Minute)
+	assert.ErrorIs(t, err, models.ErrStaleVersion)
+
+	claimed, err := repo.ClaimNotification(ctx, "n-1", 2, -time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSending, claimed.Status)
+	assert.Greater(t, claimed.Revision, stored.Revision, "every write must bump the revision")
+
+	_, err = repo.ClaimNotification(ctx, "n-1", 2, time.Minute)
+	assert.ErrorIs(t, err, models.ErrNotPending)
+
+	stuck, err := repo.RecoverStuckNotifications(ctx, "lease expired", nil)
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	assert.Equal(t, models.StatusFailed, stuck[0].Status)
+}
+
+func TestRepository_FinishCreatesNextOccurrenceOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	first := &models.Notification{ID: "s-1", UserID: "u", Message: "digest", Channel: "email",
+		Status: models.StatusPending, SendAt: time.Now(), SeriesID: "s-1", Occurrence: 1}
+	require.NoError(t, repo.CreateNotification(ctx, first))
+
+	calls := 0
+	next := func(finished *models.Notification) *models.Notification {
+		calls++
+		return &models.Notification{ID: "s-2", UserID: finished.UserID, Message: finished.Message,
+			Channel: finished.Channel, Status: models.StatusPending, SendAt: finished.SendAt.Add(time.Hour),
+			SeriesID: finished.SeriesID, Occurrence: finished.Occurrence + 1}
+	}
+
+	failed, err := repo.MarkNotificationFailed(ctx, "s-1", "smtp down", next)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, failed.Status)
+	stored, err := repo.GetByID(ctx, "s-2")
+	require.NoError(t, err)
+	require.NotNil(t, stored, "failed occurrence must schedule the next one")
+	assert.Equal(t, 2, repo.OutboxLen())
+
+	// После replay и успешной отправки повтор уже существует
+	_, err = repo.UpdateNotificationStatus(ctx, "s-1", models.StatusSent, next)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, repo.OutboxLen())
+}
+
+func TestRepository_DeleteSeriesStopsSendingOccurrence(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	first := &models.Notification{ID: "s-1", UserID: "u", Message: "digest", Channel: "email",
+		Status: models.StatusPending, SendAt: time.Now(), SeriesID: "s-1", Occurrence: 1}
+	require.NoError(t, repo.CreateNotification(ctx, first))
+	_, err := repo.ClaimNotification(ctx, "s-1", first.Version, time.Minute)
+	require.NoError(t, err)
+
+	// Единственный живой повтор отправляется: удалять нечего, но серия отменяется
+	ids, err := repo.DeleteSeries(ctx, "s-1")
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	next := func(finished *models.Notification) *models.Notification {
+		return &models.Notification{ID: "s-2", UserID: finished.UserID, Message: finished.Message,
+			Channel: finished.Channel, Status: models.StatusPending, SendAt: finished.SendAt.Add(time.Hour),
+			SeriesID: finished.SeriesID, Occurrence: finished.Occurrence + 1}
+	}
+	_, err = repo.UpdateNotificationStatus(ctx, "s-1", models.StatusSent, next)
+	require.NoError(t, err)
+
+	stored, err := repo.GetByID(ctx, "s-2")
+	require.NoError(t, err)
+	assert.Nil(t, stored, "canceled series must not schedule the next occurrence")
+
+	_, err = repo.DeleteSeries(ctx, "s-1")
+	assert.ErrorIs(t, err, models.ErrNotPending)
+}
+
+func TestRepository_MarkFailedKeepsFinishedNotification(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	require.NoError(t, repo.CreateNotification(ctx, &models.Notification{ID: "n-1", UserID: "u", Message: "hi",
+		Channel: "email", Status: models.StatusPending, SendAt: time.Now()}))
+	_, err := repo.UpdateNotificationStatus(ctx, "n-1", models.StatusSent, nil)
+	require.NoError(t, err)
+
+	_, err = repo.MarkNotificationFailed(ctx, "n-1", "lease expired", nil)
+	assert.ErrorIs(t, err, models.ErrNotPending)
+
+	stored, err := repo.GetByID(ctx, "n-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSent, stored.Status)
+	assert.Empty(t, stored.LastError)
+}
+
+func TestRepository_StoresAttachmentContentSeparately(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	first := &models.Notification{ID: "s-1", UserID: "u@example.com", Message: "report", Channel: "email",
+		Status: models.StatusPending, SendAt: time.Now(), SeriesID: "s-1", Occurrence: 1,
+		Attachments: []models.Attachment{
+			{Filename: "report.pdf", Content: []byte("%PDF-report")},
+			{Filename: "logo.png", URL: "https://files.example.com/logo.png"},
+		}}
+	require.NoError(t, repo.CreateNotification(ctx, first))
+
+	// В уведомлении и payload outbox остается только ссылка на содержимое
+	stored, err := repo.GetByID(ctx, "s-1")
+	require.NoError(t, err)
+	require.Len(t, stored.Attachments, 2)
+	reportID := stored.Attachments[0].ID
+	require.NotEmpty(t, reportID)
+	assert.Empty(t, stored.Attachments[0].Content)
+	assert.Empty(t, stored.Attachments[1].ID)
+
+	batch, err := repo.ClaimOutboxBatch(ctx, 10, time.Now().Add(time.Minute), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.NotContains(t, string(batch[0].Payload), `"content"`)
+
+	contents, err := repo.GetAttachmentContents(ctx, "s-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{reportID: []byte("%PDF-report")}, contents)
+
+	// Следующий повтор получает свою копию содержимого
+	next := func(finished *models.Notification) *models.Notification {
+		return &models.Notification{ID: "s-2", UserID: finished.UserID, Message: finished.Message,
+			Channel: finished.Channel, Status: models.StatusPending, SendAt: finished.SendAt.Add(time.Hour),
+			SeriesID: finished.SeriesID, Occurrence: finished.Occurrence + 1, Attachments: finished.Attachments}
+	}
+	_, err = repo.UpdateNotificationStatus(ctx, "s-1", models.StatusSent, next)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteNotification(ctx, "s-1"))
+
+	contents, err = repo.GetAttachmentContents(ctx, "s-1")
+	require.NoError(t, err)
+	assert.Empty(t, contents)
+
+	second, err := repo.GetByID(ctx, "s-2")
+	require.NoError(t, err)
+	require.Len(t, second.Attachments, 2)
+	assert.NotEqual(t, reportID, second.Attachments[0].ID)
+	contents, err = repo.GetAttachmentContents(ctx, "s-2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{second.Attachments[0].ID: []byte("%PDF-report")}, contents)
+}
+
+func TestRepository_ListNotificationsKeyset(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	base := time.Now().Add(time.Hour)
+	for i, id := range []string{"c", "a", "b"} {
+		require.NoError(t, repo.CreateNotification(ctx, &models.Notification{ID: id, UserID: "u",
+			Channel: "email", Status: models.StatusPending, SendAt: base.Add(time.Duration(i%2) * time.Minute)}))
+	}
+
+	page, err := repo.ListNotifications(ctx, models.NotificationFilter{SortBy: models.SortBySendAt, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "b", page[0].ID)
+	assert.Equal(t, "c", page[1].ID)
+
+	last := page[1]
+	page, err = repo.ListNotifications(ctx, models.NotificationFilter{SortBy: models.SortBySendAt, Limit: 2,
+		After: &models.NotificationCursor{Value: last.SendAt, ID: last.ID}})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "a", page[0].ID)
+
+	_, err = repo.ListNotifications(ctx, models.NotificationFilter{SortBy: "message"})
+	assert.ErrorIs(t, err, models.ErrBadFilter)
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// CreateTelegramLink сохраняет токен привязки чата.
+func (r *Repository) CreateTelegramLink(ctx context.Context, link *models.TelegramLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.telegramLinks[link.Token] = *link
+	return nil
+}
+
+// LinkTelegramChat погашает токен, привязывает чат к пользователю и добавляет чат в его контакты.
+// Прежние чаты пользователя отвязываются, а перенесенный чат удаляется из контактов прежнего владельца.
+func (r *Repository) LinkTelegramChat(ctx context.Context, token string, chatID int64, now time.Time) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link, ok := r.telegramLinks[token]
+	if !ok || !link.ExpiresAt.After(now) {
+		return "", models.ErrTelegramLinkInvalid
+	}
+	delete(r.telegramLinks, token)
+
+	if owner, ok := r.telegramChats[chatID]; ok && owner != link.UserID {
+		r.dropTelegramContact(owner, chatID, now)
+	}
+	for id, owner := range r.telegramChats {
+		if owner == link.UserID && id != chatID {
+			delete(r.telegramChats, id)
+		}
+	}
+	r.telegramChats[chatID] = link.UserID
+
+	p, ok := r.preferences[link.UserID]
+	if !ok {
+		p = models.UserPreferences{UserID: link.UserID}
+	}
+	stored := clonePreferences(&p)
+	if stored.Contacts == nil {
+		stored.Contacts = make(map[string]string)
+	}
+	stored.Contacts["telegram"] = strconv.FormatInt(chatID, 10)
+	stored.UpdatedAt = now
+	r.preferences[link.UserID] = *stored
+
+	return link.UserID, nil
+}
+
+// dropTelegramContact удаляет контакт telegram пользователя, если он все еще указывает на чат chatID.
+func (r *Repository) dropTelegramContact(userID string, chatID int64, now time.Time) {
+	p, ok := r.preferences[userID]
+	if !ok || p.Contacts["telegram"] != strconv.FormatInt(chatID, 10) {
+		return
+	}
+	stored := clonePreferences(&p)
+	delete(stored.Contacts, "telegram")
+	stored.UpdatedAt = now
+	r.preferences[userID] = *stored
+}
+
+// GetTelegramChatUser возвращает пользователя, к которому привязан чат.
+func (r *Repository) GetTelegramChatUser(ctx context.Context, chatID int64) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID, ok := r.telegramChats[chatID]
+	if !ok {
+		return "", models.ErrTelegramChatNotLinked
+	}
+	return userID, nil
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_LinkTelegramChat(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+	now := time.Now()
+
+	require.NoError(t, repo.SavePreferences(ctx, &models.UserPreferences{
+		UserID:   "user-1",
+		Contacts: map[string]string{"email": "user@example.com"},
+		Timezone: "Europe/Moscow",
+	}))
+	require.NoError(t, repo.CreateTelegramLink(ctx, &models.TelegramLink{Token: "valid", UserID: "user-1", ExpiresAt: now.Add(time.Minute)}))
+	require.NoError(t, repo.CreateTelegramLink(ctx, &models.TelegramLink{Token: "expired", UserID: "user-2", ExpiresAt: now.Add(-time.Second)}))
+
+	_, err := repo.LinkTelegramChat(ctx, "expired", 200, now)
+	assert.ErrorIs(t, err, models.ErrTelegramLinkInvalid)
+	_, err = repo.GetTelegramChatUser(ctx, 200)
+	assert.ErrorIs(t, err, models.ErrTelegramChatNotLinked)
+
+	userID, err := repo.LinkTelegramChat(ctx, "valid", 100, now)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+
+	// Токен погашен, остальные контакты и настройки сохранены
+	_, err = repo.LinkTelegramChat(ctx, "valid", 100, now)
+	assert.ErrorIs(t, err, models.ErrTelegramLinkInvalid)
+
+	prefs, err := repo.GetPreferences(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"email": "user@example.com", "telegram": "100"}, prefs.Contacts)
+	assert.Equal(t, "Europe/Moscow", prefs.Timezone)
+
+	chatUser, err := repo.GetTelegramChatUser(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", chatUser)
+}
+
+func TestRepository_LinkTelegramChat_Relink(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+	now := time.Now()
+	expires := now.Add(time.Minute)
+
+	for _, link := range []models.TelegramLink{
+		{Token: "first", UserID: "user-1", ExpiresAt: expires},
+		{Token: "second", UserID: "user-1", ExpiresAt: expires},
+		{Token: "moved", UserID: "user-2", ExpiresAt: expires},
+	} {
+		require.NoError(t, repo.CreateTelegramLink(ctx, &link))
+	}
+
+	_, err := repo.LinkTelegramChat(ctx, "first", 100, now)
+	require.NoError(t, err)
+
+	// Новый чат пользователя заменяет прежний
+	_, err = repo.LinkTelegramChat(ctx, "second", 200, now)
+	require.NoError(t, err)
+	_, err = repo.GetTelegramChatUser(ctx, 100)
+	assert.ErrorIs(t, err, models.ErrTelegramChatNotLinked)
+
+	// Чат переходит к другому пользователю и пропадает из контактов прежнего владельца
+	_, err = repo.LinkTelegramChat(ctx, "moved", 200, now)
+	require.NoError(t, err)
+	chatUser, err := repo.GetTelegramChatUser(ctx, 200)
+	require.NoError(t, err)
+	assert.Equal(t, "user-2", chatUser)
+
+	prefs, err := repo.GetPreferences(ctx, "user-1")
+	require.NoError(t, err)
+	assert.NotContains(t, prefs.Contacts, "telegram")
+	prefs, err = repo.GetPreferences(ctx, "user-2")
+	require.NoError(t, err)
+	assert.Equal(t, "200", prefs.Contacts["telegram"])
+}
@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// templateRecord хранит все версии шаблона по возрастанию номера.
+type templateRecord struct {
+	versions []models.Template
+	deleted  bool
+}
+
+// CreateTemplate сохраняет первую версию шаблона.
+func (r *Repository) CreateTemplate(ctx context.Context, t *models.Template) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.templates[t.ID] = &templateRecord{versions: []models.Template{*t}}
+	return nil
+}
+
+// CreateTemplateVersion сохраняет новую версию существующего шаблона и записывает ее номер в t.Version.
+func (r *Repository) CreateTemplateVersion(ctx context.Context, t *models.Template) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.templates[t.ID]
+	if !ok || rec.deleted {
+		return models.ErrTemplateNotFound
+	}
+	t.Version = rec.versions[len(rec.versions)-1].Version + 1
+	rec.versions = append(rec.versions, *t)
+	return nil
+}
+
+// GetTemplate возвращает указанную версию шаблона, при version = 0 - последнюю.
+// Как и в postgres-репозитории, конкретная версия удаленного шаблона остается доступна.
+func (r *Repository) GetTemplate(ctx context.Context, id string, version int) (*models.Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.templates[id]
+	if !ok {
+		return nil, models.ErrTemplateNotFound
+	}
+	if version <= 0 {
+		if rec.deleted {
+			return nil, models.ErrTemplateNotFound
+		}
+		t := rec.versions[len(rec.versions)-1]
+		return &t, nil
+	}
+	for _, t := range rec.versions {
+		if t.Version == version {
+			return &t, nil
+		}
+	}
+	return nil, models.ErrTemplateNotFound
+}
+
+// ListTemplates возвращает последние версии всех неудаленных шаблонов, упорядоченные по id.
+func (r *Repository) ListTemplates(ctx context.Context) ([]*models.Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []*models.Template
+	for _, rec := range r.templates {
+		if rec.deleted {
+			continue
+		}
+		t := rec.versions[len(rec.versions)-1]
+		res = append(res, &t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// DeleteTemplate помечает все версии шаблона удаленными.
+func (r *Repository) DeleteTemplate(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.templates[id]
+	if !ok || rec.deleted {
+		return models.ErrTemplateNotFound
+	}
+	rec.deleted = true
+	return nil
+}
+
+// GetPreferences возвращает предпочтения пользователя или ErrPreferencesNotFound.
+func (r *Repository) GetPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.preferences[userID]
+	if !ok {
+		return nil, models.ErrPreferencesNotFound
+	}
+	return clonePreferences(&p), nil
+}
+
+// SavePreferences создает или полностью заменяет предпочтения пользователя.
+func (r *Repository) SavePreferences(ctx context.Context, p *models.UserPreferences) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := clonePreferences(p)
+	if stored.UpdatedAt.IsZero() {
+		stored.UpdatedAt = time.Now()
+	}
+	r.preferences[p.UserID] = *stored
+	return nil
+}
+
+// DeletePreferences удаляет предпочтения пользователя или возвращает ErrPreferencesNotFound.
+func (r *Repository) DeletePreferences(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.preferences[userID]; !ok {
+		return models.ErrPreferencesNotFound
+	}
+	delete(r.preferences, userID)
+	return nil
+}
+
+func clonePreferences(p *models.UserPreferences) *models.UserPreferences {
+	c := *p
+	c.Channels = cloneStrings(p.Channels)
+	if p.Contacts != nil {
+		c.Contacts = make(map[string]string, len(p.Contacts))
+		for k, v := range p.Contacts {
+			c.Contacts[k] = v
+		}
+	}
+	if p.QuietHours != nil {
+		quiet := *p.QuietHours
+		c.QuietHours = &quiet
+	}
+	return &c
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "notifier"
+
+// Результат попытки отправки для метки result
+const (
+	ResultSuccess     = "success"
+	ResultError       = "error"
+	ResultRateLimited = "rate_limited"
+)
+
+var (
+	// NotificationsCreated - уведомления, сохраненные в базе, включая рассылки и повторы серий.
+	NotificationsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_created_total",
+		Help:      "Number of notifications created.",
+	}, []string{"channel"})
+
+	// NotificationsQueued - уведомления, опубликованные relay из outbox в очередь.
+	NotificationsQueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_queued_total",
+		Help:      "Number of notifications published from the outbox to the queue.",
+	}, []string{"channel"})
+
+	NotificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Number of notifications delivered.",
+	}, []string{"channel"})
+
+	// NotificationsFailed - уведомления, окончательно помеченные failed: попытки исчерпаны
+	// на последнем канале цепочки или истекла аренда отправки.
+	NotificationsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_failed_total",
+		Help:      "Number of notifications marked as failed.",
+	}, []string{"channel"})
+
+	// SendRetries - повторные попытки отправки после ошибки, ожидание из-за ограничения не учитывается.
+	SendRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "send_retries_total",
+		Help:      "Number of send retries after a failed attempt.",
+	}, []string{"channel"})
+
+	SendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_duration_seconds",
+		Help:      "Duration of a single send attempt.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"channel", "result"})
+
+	// QueueLag - насколько доставка отстала от запланированного send_at.
+	QueueLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_lag_seconds",
+		Help:      "Delay between the scheduled send time and actual delivery.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"channel"})
+
+	WorkerInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_in_flight",
+		Help:      "Number of queue messages currently being processed.",
+	})
+)
+
+// Handler отдает метрики в формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
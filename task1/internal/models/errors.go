@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotPending = errors.New("notification is no longer pending")
+	ErrNotFailed  = errors.New("notification is not failed")
+	ErrNotFound   = errors.New("notification not found")
+	// ErrCacheMiss - уведомления нет в кэше, его нужно прочитать из репозитория
+	ErrCacheMiss = errors.New("notification not cached")
+	// ErrStaleVersion - сообщение из очереди относится к версии уведомления до изменения
+	ErrStaleVersion    = errors.New("notification version is stale")
+	ErrVersionConflict = errors.New("notification was modified concurrently")
+
+	ErrDuplicateIdempotencyKey = errors.New("notification with this idempotency key already exists")
+	ErrBadFilter               = errors.New("invalid notification filter")
+	ErrInvalidBatch            = errors.New("invalid batch")
+	ErrBatchNotFound           = errors.New("batch not found")
+
+	// ErrStreamUnavailable - события о смене статусов не настроены
+	ErrStreamUnavailable = errors.New("status stream is not available")
+
+	ErrTemplateNotFound    = errors.New("template not found")
+	ErrPreferencesNotFound = errors.New("user preferences not found")
+
+	ErrTelegramLinkInvalid   = errors.New("telegram link token is invalid or expired")
+	ErrTelegramChatNotLinked = errors.New("telegram chat is not linked to a user")
+)
+
+// RateLimitError означает, что провайдер канала временно ограничил отправку.
+// Такая попытка не считается неудачной: отправка повторяется через RetryAfter.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s: %v", e.RetryAfter, e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
@@ -8,45 +8,353 @@ import (
 
 // Notification представляет сущность уведомления, хранящуюся в системе.
 type Notification struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Message   string    `json:"message"`
-	Channel   string    `json:"channel"` // email, telegram
-	SendAt    time.Time `json:"send_at"`
-	Status    string    `json:"status"` // pending, sent, failed, canceled
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID      string    `json:"id"`
+	UserID  string    `json:"user_id"`
+	Message string    `json:"message"`
+	Channel string    `json:"channel"` // текущий канал, после отправки - канал, которым доставлено
+	SendAt  time.Time `json:"send_at"`
+	Status  string    `json:"status"`  // pending, sent, failed, canceled
+	Version int       `json:"version"` // увеличивается при каждом изменении, сообщения старых версий игнорируются
+	// Ревизия увеличивается при любой записи в базу, включая смену статуса.
+	// По ней кэш отличает актуальное состояние от устаревшего
+	Revision int64 `json:"revision"`
+	// Ключ из заголовка Idempotency-Key, уникален в пределах пользователя
+	IdempotencyKey string    `json:"idempotency_key,omitempty"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Цепочка каналов: после исчерпания попыток на Channel отправка переходит к следующему
+	Channels []string `json:"channels,omitempty"`
+
+	// Массовая рассылка, в составе которой создано уведомление
+	BatchID string `json:"batch_id,omitempty"`
+
+	// Поля повторяющихся уведомлений: серия идентифицируется ID первого уведомления
+	SeriesID   string      `json:"series_id,omitempty"`
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	Occurrence int         `json:"occurrence,omitempty"`
+
+	// Шаблон сообщения, который рендерится в момент отправки
+	TemplateID      string            `json:"template_id,omitempty"`
+	TemplateVersion int               `json:"template_version,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+
+	// Тема и разметка задаются при создании, шаблон переопределяет их при отправке
+	Subject   string `json:"subject,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+
+	// Вложения поддерживает только канал email
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// CacheEntry - запись кэша уведомлений. Надгробие (Deleted) остается после удаления уведомления,
+// чтобы устаревшая запись не вернула его в кэш.
+type CacheEntry struct {
+	Revision     int64         `json:"revision"`
+	Deleted      bool          `json:"deleted,omitempty"`
+	Notification *Notification `json:"notification,omitempty"`
+}
+
+// Ограничения вложений одного уведомления: число и суммарный размер, в том числе скачанных по URL
+const (
+	MaxAttachments     = 10
+	MaxAttachmentsSize = 10 << 20
+)
+
+// Attachment - вложение письма. Содержимое передается при создании (в JSON - base64)
+// или скачивается по URL в момент отправки. Репозиторий хранит содержимое отдельно от уведомления:
+// в сохраненном уведомлении, outbox, очереди и кэше остается ссылка ID, а Content пуст.
+type Attachment struct {
+	ID          string `json:"id,omitempty"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Content     []byte `json:"content,omitempty"`
+}
+
+// Recurrence описывает расписание повторяющегося уведомления: cron-выражение или iCal RRULE.
+// Until и Count ограничивают серию по дате последней отправки и по общему числу отправок.
+type Recurrence struct {
+	Cron  string     `json:"cron,omitempty"`
+	RRule string     `json:"rrule,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	Count int        `json:"count,omitempty"`
+	Start time.Time  `json:"start"` // время первой отправки, опорная точка для RRULE
 }
 
+// NextOccurrenceFunc строит следующее уведомление серии по завершенному повтору или возвращает nil,
+// если уведомление не повторяется или серия закончилась. Репозиторий вызывает ее в транзакции,
+// которая меняет статус повтора, и сохраняет результат в той же транзакции.
+type NextOccurrenceFunc func(finished *Notification) *Notification
+
 // CreateNotificationRequest содержит параметры для создания нового уведомления.
+// Вместо Message можно передать TemplateID и переменные для подстановки,
+// вместо Channel - упорядоченный список каналов Channels для резервной отправки.
 type CreateNotificationRequest struct {
-	UserID  string    `json:"user_id" binding:"required"`
-	Message string    `json:"message" binding:"required"`
-	Channel string    `json:"channel" binding:"required"`
-	SendAt  time.Time `json:"send_at" binding:"required"`
+	UserID   string    `json:"user_id" binding:"required"`
+	Message  string    `json:"message"`
+	Channel  string    `json:"channel"`
+	Channels []string  `json:"channels,omitempty"`
+	SendAt   time.Time `json:"send_at" binding:"required"`
+
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"` // 0 - последняя версия
+
+	// Заполняется из заголовка Idempotency-Key
+	IdempotencyKey string            `json:"-"`
+	Variables      map[string]string `json:"variables,omitempty"`
+
+	Subject     string       `json:"subject,omitempty"`
+	ParseMode   string       `json:"parse_mode,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// UpdateNotificationRequest содержит изменения ожидающего уведомления, пустые поля не меняются.
+// Смена канала заменяет цепочку резервных каналов одним каналом.
+type UpdateNotificationRequest struct {
+	Message *string    `json:"message"`
+	Channel *string    `json:"channel"`
+	SendAt  *time.Time `json:"send_at"`
+	Version int        `json:"version"` // ожидаемая версия, 0 - без проверки
+}
+
+// BatchRecipient - получатель массовой рассылки. Variables дополняют и переопределяют
+// общие переменные шаблона рассылки.
+type BatchRecipient struct {
+	UserID    string            `json:"user_id"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// CreateBatchRequest содержит общие для всех получателей текст или шаблон, каналы и время отправки.
+type CreateBatchRequest struct {
+	Recipients []BatchRecipient `json:"recipients"`
+	Message    string           `json:"message"`
+	Channel    string           `json:"channel"`
+	Channels   []string         `json:"channels,omitempty"`
+	SendAt     time.Time        `json:"send_at" binding:"required"`
+
+	TemplateID      string            `json:"template_id,omitempty"`
+	TemplateVersion int               `json:"template_version,omitempty"` // 0 - последняя версия
+	Variables       map[string]string `json:"variables,omitempty"`
+}
+
+// Batch - массовая рассылка. Counts содержит число уведомлений рассылки по статусам.
+type Batch struct {
+	ID        string         `json:"id"`
+	Total     int            `json:"total"`
+	Counts    map[string]int `json:"counts"`
+	CreatedAt time.Time      `json:"created_at"`
 }
 
 // NotificationResponse используется для возврата информации об уведомлении клиенту API.
 type NotificationResponse struct {
-	ID      string    `json:"id"`
-	Status  string    `json:"status"`
-	Channel string    `json:"channel"` // email, telegram
-	Message string    `json:"message"`
-	SendAt  time.Time `json:"send_at"`
+	ID       string    `json:"id"`
+	Status   string    `json:"status"`
+	Channel  string    `json:"channel"` // email, telegram, webhook
+	Channels []string  `json:"channels,omitempty"`
+	Message  string    `json:"message"`
+	Subject  string    `json:"subject,omitempty"`
+	SendAt   time.Time `json:"send_at"`
+	SeriesID string    `json:"series_id,omitempty"`
+	Version  int       `json:"version"`
+	// Вложения без содержимого: имя, тип и URL
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Число попыток отправки и ошибка последней неудачной попытки
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Attempt - одна попытка отправки уведомления. Пустой Error означает успешную отправку.
+type Attempt struct {
+	ID             int64     `json:"id"`
+	NotificationID string    `json:"notification_id"`
+	Channel        string    `json:"channel"`
+	StartedAt      time.Time `json:"started_at"`
+	DurationMS     int64     `json:"duration_ms"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// ListNotificationsRequest - параметры запроса GET /notify. Status можно передать несколько раз
+// или через запятую, Cursor - значение next_cursor предыдущей страницы.
+type ListNotificationsRequest struct {
+	UserID   string     `form:"user_id"`
+	Channel  string     `form:"channel"`
+	Status   []string   `form:"status"`
+	SendFrom *time.Time `form:"send_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	SendTo   *time.Time `form:"send_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort     string     `form:"sort"`  // send_at (по умолчанию) или created_at
+	Order    string     `form:"order"` // asc (по умолчанию) или desc
+	Limit    int        `form:"limit"`
+	Cursor   string     `form:"cursor"`
+}
+
+// NotificationFilter - условия выборки уведомлений для репозитория. Результат упорядочен
+// по SortBy и ID, After задает позицию, после которой начинается страница.
+type NotificationFilter struct {
+	UserID   string
+	Channel  string
+	Statuses []string
+	SendFrom *time.Time
+	SendTo   *time.Time
+	SortBy   string
+	Desc     bool
+	Limit    int
+	After    *NotificationCursor
+}
+
+// NotificationCursor - позиция последнего уведомления страницы при keyset-пагинации.
+type NotificationCursor struct {
+	SortBy string    `json:"s"`
+	Desc   bool      `json:"d,omitempty"`
+	Value  time.Time `json:"v"`
+	ID     string    `json:"id"`
+}
+
+// NotificationPage - страница списка уведомлений.
+type NotificationPage struct {
+	Notifications []*Notification `json:"notifications"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+}
+
+// StatusEvent - смена статуса уведомления, которую получают подписчики GET /notify/stream.
+type StatusEvent struct {
+	NotificationID string    `json:"notification_id"`
+	UserID         string    `json:"user_id"`
+	Status         string    `json:"status"`
+	Channel        string    `json:"channel,omitempty"`
+	Revision       int64     `json:"revision,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+// StatusStreamRequest - параметры запроса GET /notify/stream. ID можно передать несколько раз
+// или через запятую. Пустой запрос подписывает на все уведомления.
+type StatusStreamRequest struct {
+	UserID string   `form:"user_id"`
+	IDs    []string `form:"id"`
+}
+
+// Template - версия шаблона сообщения для канала. Subject используется только для email,
+// ParseMode определяет разметку тела (Markdown, MarkdownV2 или HTML).
+type Template struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Channel   string    `json:"channel"`
+	Subject   string    `json:"subject,omitempty"`
+	Body      string    `json:"body"`
+	ParseMode string    `json:"parse_mode,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TemplateRequest содержит параметры для создания шаблона или его новой версии.
+type TemplateRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Channel   string `json:"channel" binding:"required"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body" binding:"required"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// PreviewTemplateRequest содержит переменные для предпросмотра шаблона.
+type PreviewTemplateRequest struct {
+	Version   int               `json:"version"` // 0 - последняя версия
+	Variables map[string]string `json:"variables"`
+}
+
+// RenderedMessage - результат подстановки переменных в шаблон.
+type RenderedMessage struct {
+	Subject   string `json:"subject,omitempty"`
+	Body      string `json:"body"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// UserPreferences - профиль получателя: адреса по каналам, порядок каналов для
+// резервной отправки, часовой пояс и тихие часы, на время которых отправка откладывается.
+type UserPreferences struct {
+	UserID     string            `json:"user_id"`
+	Contacts   map[string]string `json:"contacts"`           // канал -> email, chat ID или URL
+	Channels   []string          `json:"channels,omitempty"` // порядок каналов после основного
+	Timezone   string            `json:"timezone,omitempty"` // IANA, по умолчанию UTC
+	QuietHours *QuietHours       `json:"quiet_hours,omitempty"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// TelegramLink - одноразовый токен привязки чата Telegram к пользователю. Пользователь
+// отправляет боту /start <token>, и чат становится его адресом в канале telegram.
+type TelegramLink struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	URL       string    `json:"url,omitempty"` // https://t.me/<bot>?start=<token>, если известно имя бота
+}
+
+// QuietHours - интервал местного времени в формате "HH:MM", может переходить через полночь.
+type QuietHours struct {
+	Start string `json:"start" binding:"required"`
+	End   string `json:"end" binding:"required"`
+}
+
+// PreferencesRequest содержит параметры для сохранения предпочтений пользователя.
+type PreferencesRequest struct {
+	Contacts   map[string]string `json:"contacts" binding:"required"`
+	Channels   []string          `json:"channels"`
+	Timezone   string            `json:"timezone"`
+	QuietHours *QuietHours       `json:"quiet_hours"`
+}
+
+// OutboxMessage представляет запись outbox, которая должна быть опубликована в очередь.
+type OutboxMessage struct {
+	ID             int64     `json:"id"`
+	NotificationID string    `json:"notification_id"`
+	Payload        []byte    `json:"payload"`
+	SendAt         time.Time `json:"send_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DeadLetter - сообщение, которое попадает в очередь недоставленных после исчерпания попыток.
+type DeadLetter struct {
+	Notification Notification `json:"notification"`
+	Attempts     int          `json:"attempts"`
+	Error        string       `json:"error"`
+	FailedAt     time.Time    `json:"failed_at"`
+}
+
+// Delivery представляет сообщение, полученное из очереди. Ack и Nack
+// подтверждают или отклоняют сообщение у брокера после завершения обработки.
+type Delivery struct {
+	Body []byte
+	Ack  func() error
+	Nack func(requeue bool) error
 }
 
 var StandartStrategy = retry.Strategy{Attempts: 3, Delay: time.Second}
 var ConsumerStrategy = retry.Strategy{Attempts: 5, Delay: 2 * time.Second}
 
 const (
+	ParseModeMarkdown   = "Markdown"
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+
 	StatusPending  = "pending"
+	StatusSending  = "sending" // захвачено воркером на время отправки
 	StatusSent     = "sent"
 	StatusFailed   = "failed"
 	StatusCanceled = "canceled"
 
+	SortBySendAt    = "send_at"
+	SortByCreatedAt = "created_at"
+
 	StatusOK                  = 200
+	StatusCreated             = 201
 	StatusAccepted            = 202
 	StatusBadRequest          = 400
 	StatusNotFound            = 404
+	StatusConflict            = 409
 	StatusInternalServerError = 500
+	StatusServiceUnavailable  = 503
 )
@@ -0,0 +1,301 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/smtp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+const (
+	defaultEmailTimeout = 30 * time.Second
+)
+
+// sharedAddressSpace - диапазон CGNAT (RFC 6598), который net/netip не считает частным.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Dialer открывает TCP-соединение с SMTP-сервером. *net.Dialer подходит без обертки,
+// своя реализация позволяет ходить через прокси или подменить сервер в тестах.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// EmailNotifier отправляет письма через SMTP: тема и разметка берутся из уведомления,
+// HTML отправляется вместе с текстовой версией, вложения скачиваются по URL при отправке.
+type EmailNotifier struct {
+	host     string
+	port     int
+	user     string
+	password string
+	from     string
+	tlsMode  string
+	timeout  time.Duration
+
+	dialer    Dialer
+	tlsConfig *tls.Config
+	client    *http.Client
+}
+
+// NewEmailNotifier создает email нотификатор, который подключается к серверу напрямую.
+func NewEmailNotifier(config config.EmailConfig) (*EmailNotifier, error) {
+	return NewEmailNotifierWithDialer(config, &net.Dialer{})
+}
+
+// NewEmailNotifierWithDialer создает email нотификатор, который открывает соединения через dialer.
+func NewEmailNotifierWithDialer(cfg config.EmailConfig, dialer Dialer) (*EmailNotifier, error) {
+	from := cfg.SMTPFrom
+	if from == "" {
+		from = cfg.SMTPUser
+	}
+	if cfg.SMTPHost == "" || from == "" {
+		return nil, fmt.Errorf("email notifier configuration incomplete")
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+
+	tlsMode := cfg.TLSMode
+	if tlsMode == "" {
+		// Порт 465 по соглашению использует TLS с начала соединения
+		tlsMode = config.SMTPTLSStartTLS
+		if cfg.SMTPPort == 465 {
+			tlsMode = config.SMTPTLSImplicit
+		}
+	}
+	switch tlsMode {
+	case config.SMTPTLSImplicit, config.SMTPTLSStartTLS, config.SMTPTLSNone:
+	default:
+		return nil, fmt.Errorf("unsupported SMTP TLS mode: %s", tlsMode)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultEmailTimeout
+	}
+
+	zlog.Logger.Info().Str("host", cfg.SMTPHost).Int("port", cfg.SMTPPort).Str("tls", tlsMode).Msg("Email notifier initialized")
+	return &EmailNotifier{
+		host:      cfg.SMTPHost,
+		port:      cfg.SMTPPort,
+		user:      cfg.SMTPUser,
+		password:  cfg.SMTPPassword,
+		from:      from,
+		tlsMode:   tlsMode,
+		timeout:   timeout,
+		dialer:    dialer,
+		tlsConfig: &tls.Config{ServerName: cfg.SMTPHost, MinVersion: tls.VersionTLS12},
+		client:    newAttachmentClient(timeout),
+	}, nil
+}
+
+// newAttachmentClient создает HTTP-клиент для скачивания вложений, который не ходит во внутреннюю сеть.
+// Адрес проверяется при каждом подключении уже после разрешения имени, поэтому
+// ограничение действует и после редиректов, и при подмене DNS-записи.
+func newAttachmentClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: denyInternalAddress}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Прокси из окружения не используется: иначе проверялся бы адрес прокси, а не сервера с файлом
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// denyInternalAddress отклоняет подключение к loopback, частным, link-local и прочим
+// не публичным адресам, включая адрес метаданных облака 169.254.169.254.
+func denyInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("attachment host %s is not a public address", ip)
+	}
+	return nil
+}
+
+func (en *EmailNotifier) Send(notification *models.Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), en.timeout)
+	defer cancel()
+
+	if err := en.ValidateRecipient(notification.UserID); err != nil {
+		return err
+	}
+
+	attachments, err := en.loadAttachments(ctx, notification.Attachments)
+	if err != nil {
+		return err
+	}
+
+	msg, err := buildEmail(en.from, notification, attachments, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+
+	if err := en.deliver(ctx, notification.UserID, msg); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", notification.ID).Str("host", en.host).Msg("Failed to send email")
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	zlog.Logger.Info().
+		Str("notification_id", notification.ID).
+		Str("recipient", notification.UserID).
+		Int("attachments", len(attachments)).
+		Msg("Email sent successfully")
+	return nil
+}
+
+// deliver передает готовое письмо серверу в одной SMTP-сессии.
+func (en *EmailNotifier) deliver(ctx context.Context, to string, msg []byte) error {
+	addr := net.JoinHostPort(en.host, strconv.Itoa(en.port))
+	conn, err := en.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if en.tlsMode == config.SMTPTLSImplicit {
+		conn = tls.Client(conn, en.tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, en.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if en.tlsMode == config.SMTPTLSStartTLS {
+		// Не отправляем письмо открытым текстом, если сервер не предлагает STARTTLS
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server %s does not support STARTTLS", en.host)
+		}
+		if err := c.StartTLS(en.tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if en.user != "" {
+		// PlainAuth сам отказывается передавать пароль без TLS на нелокальный сервер
+		if err := c.Auth(smtp.PlainAuth("", en.user, en.password, en.host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(en.from); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("rcpt to: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	return c.Quit()
+}
+
+// loadAttachments возвращает вложения с содержимым, скачивая те, что заданы по URL.
+// Общий размер вложений, включая скачанные, не превышает models.MaxAttachmentsSize.
+func (en *EmailNotifier) loadAttachments(ctx context.Context, attachments []models.Attachment) ([]models.Attachment, error) {
+	loaded := make([]models.Attachment, 0, len(attachments))
+	var total int64
+	for _, a := range attachments {
+		if a.URL != "" && len(a.Content) == 0 {
+			content, contentType, err := en.download(ctx, a.URL, models.MaxAttachmentsSize-total)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download attachment %s: %w", a.Filename, err)
+			}
+			a.Content = content
+			if a.ContentType == "" {
+				a.ContentType = contentType
+			}
+		}
+		total += int64(len(a.Content))
+		if total > models.MaxAttachmentsSize {
+			return nil, fmt.Errorf("attachments exceed %d bytes in total", models.MaxAttachmentsSize)
+		}
+		loaded = append(loaded, a)
+	}
+	return loaded, nil
+}
+
+// download скачивает файл по URL, читая не больше limit байт.
+func (en *EmailNotifier) download(ctx context.Context, url string, limit int64) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := en.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > limit {
+		return nil, "", fmt.Errorf("attachment exceeds %d bytes", limit)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(content)) > limit {
+		return nil, "", fmt.Errorf("attachment exceeds %d bytes", limit)
+	}
+	return content, resp.Header.Get("Content-Type"), nil
+}
+
+// ValidateRecipient проверяет, что получатель - email-адрес.
+func (en *EmailNotifier) ValidateRecipient(recipient string) error {
+	addr, err := mail.ParseAddress(recipient)
+	if err != nil || addr.Address != recipient {
+		return fmt.Errorf("invalid email recipient %q", recipient)
+	}
+	return nil
+}
+
+// SendsAttachments сообщает сервису, что канал email доставляет вложения.
+func (en *EmailNotifier) SendsAttachments() bool {
+	return true
+}
+
+// GetChannel возвращает тип канала для Email
+func (en *EmailNotifier) GetChannel() string {
+	return EmailType
+}
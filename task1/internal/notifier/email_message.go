@@ -0,0 +1,204 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+const defaultEmailSubject = "Notification"
+
+// buildEmail собирает письмо в формате MIME. HTML-тело отправляется как multipart/alternative
+// вместе с текстовой версией для клиентов без HTML, вложения добавляются через multipart/mixed.
+func buildEmail(from string, n *models.Notification, attachments []models.Attachment, now time.Time) ([]byte, error) {
+	subject := n.Subject
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", from)
+	writeHeader(&buf, "To", n.UserID)
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader(&buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID(from))
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	header, body, err := renderBody(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attachments) == 0 {
+		writeMIMEHeader(&buf, header)
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}))
+	buf.WriteString("\r\n")
+
+	part, err := mixed.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		if err := writeAttachment(mixed, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderBody возвращает заголовки Content-* и тело письма. HTML дополняется текстовой версией.
+func renderBody(n *models.Notification) (textproto.MIMEHeader, []byte, error) {
+	var body bytes.Buffer
+	if n.ParseMode != models.ParseModeHTML {
+		if err := writeQuotedPrintable(&body, n.Message); err != nil {
+			return nil, nil, err
+		}
+		return textproto.MIMEHeader{
+			"Content-Type":              {`text/plain; charset="utf-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, body.Bytes(), nil
+	}
+
+	alt := multipart.NewWriter(&body)
+	for _, p := range []struct{ contentType, text string }{
+		{`text/plain; charset="utf-8"`, htmlToText(n.Message)},
+		{`text/html; charset="utf-8"`, n.Message},
+	} {
+		part, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(part, p.text); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := alt.Close(); err != nil {
+		return nil, nil, err
+	}
+	return textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alt.Boundary()})},
+	}, body.Bytes(), nil
+}
+
+func writeAttachment(mixed *multipart.Writer, a models.Attachment) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+	})
+	if err != nil {
+		return err
+	}
+
+	// RFC 2045 ограничивает строки base64 76 символами
+	encoded := base64.StdEncoding.EncodeToString(a.Content)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, text); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeHeader(w *bytes.Buffer, key, value string) {
+	// Перевод строки в значении позволил бы подставить свои заголовки
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	fmt.Fprintf(w, "%s: %s\r\n", key, value)
+}
+
+// writeMIMEHeader пишет заголовки в порядке ключей, чтобы письмо не зависело от обхода карты
+func writeMIMEHeader(w *bytes.Buffer, header textproto.MIMEHeader) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			writeHeader(w, key, value)
+		}
+	}
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if _, host, ok := strings.Cut(from, "@"); ok {
+		domain = strings.TrimSuffix(host, ">")
+	}
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return "<" + hex.EncodeToString(id[:]) + "@" + domain + ">"
+}
+
+var (
+	htmlSkipped   = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+	htmlLineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</(li|tr)>`)
+	htmlParagraph = regexp.MustCompile(`(?i)</(p|div|h[1-6]|table|ul|ol)>`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText строит текстовую версию HTML-письма: убирает теги, блоки разделяет пустой строкой,
+// а <br> и элементы списков - переводом строки.
+func htmlToText(s string) string {
+	s = htmlSkipped.ReplaceAllString(s, "")
+	s = htmlParagraph.ReplaceAllString(s, "\n\n")
+	s = htmlLineBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	s = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(s, "\n\n"))
+}
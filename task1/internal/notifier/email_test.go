@@ -0,0 +1,370 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpStub - минимальный SMTP-сервер, который запоминает принятые письма.
+type smtpStub struct {
+	ln net.Listener
+	// startTLS, если задан, предлагается клиенту командой STARTTLS
+	startTLS *tls.Config
+
+	mu       sync.Mutex
+	messages []stubMessage
+}
+
+type stubMessage struct {
+	from, to string
+	auth     string
+	tls      bool
+	data     string
+}
+
+func newSMTPStub(t *testing.T, startTLS *tls.Config, implicitTLS *tls.Config) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if implicitTLS != nil {
+		ln = tls.NewListener(ln, implicitTLS)
+	}
+	s := &smtpStub{ln: ln, startTLS: startTLS}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, implicitTLS != nil)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) received() []stubMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stubMessage(nil), s.messages...)
+}
+
+func (s *smtpStub) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var msg stubMessage
+	msg.tls = secure
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-stub")
+			if s.startTLS != nil && !msg.tls {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.startTLS)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, msg.tls = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			msg.auth = string(decoded)
+			reply("235 ok")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			msg.to = strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>")
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// redirectDialer подключается к заглушке, какой бы адрес ни запросил нотификатор
+type redirectDialer struct {
+	target string
+	dialed []string
+}
+
+func (d *redirectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, address)
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, d.target)
+}
+
+// testTLS возвращает конфигурацию сервера с сертификатом httptest и пул для его проверки
+func testTLS(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{Certificates: srv.TLS.Certificates}, pool
+}
+
+func TestEmailNotifier_Send_HTMLWithAttachments(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, "%PDF-report")
+	}))
+	defer files.Close()
+
+	stub := newSMTPStub(t, nil, nil)
+	dialer := &redirectDialer{target: stub.ln.Addr().String()}
+	en, err := NewEmailNotifierWithDialer(config.EmailConfig{
+		SMTPHost: "localhost", SMTPPort: 2525, SMTPUser: "bot@example.com", SMTPPassword: "secret",
+		TLSMode: config.SMTPTLSNone,
+	}, dialer)
+	require.NoError(t, err)
+	// Тестовый файловый сервер слушает loopback, который боевой клиент не пропускает
+	en.client = files.Client()
+
+	err = en.Send(&models.Notification{
+		ID:        "id-1",
+		UserID:    "user@example.com",
+		Subject:   "Отчет за неделю",
+		ParseMode: models.ParseModeHTML,
+		Message:   "<p>Привет!</p><p>Отчет во <b>вложении</b>.</p>",
+		Attachments: []models.Attachment{
+			{Filename: "notes.txt", Content: []byte("plain notes")},
+			{Filename: "report.pdf", URL: files.URL + "/report.pdf"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:2525"}, dialer.dialed)
+
+	received := stub.received()
+	require.Len(t, received, 1)
+	assert.Equal(t, "bot@example.com", received[0].from)
+	assert.Equal(t, "user@example.com", received[0].to)
+	assert.Equal(t, "\x00bot@example.com\x00secret", received[0].auth)
+
+	msg, err := mail.ReadMessage(strings.NewReader(received[0].data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Отчет за неделю", subject)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	parts := readParts(t, multipart.NewReader(msg.Body, params["boundary"]))
+	require.Len(t, parts, 3)
+
+	altType, altParams, err := mime.ParseMediaType(parts[0].header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", altType)
+	alternatives := readParts(t, multipart.NewReader(strings.NewReader(parts[0].body), altParams["boundary"]))
+	require.Len(t, alternatives, 2)
+	assert.Equal(t, "Привет!\r\n\r\nОтчет во вложении.", alternatives[0].body)
+	assert.Contains(t, alternatives[1].body, "<b>вложении</b>")
+
+	assert.Equal(t, "plain notes", parts[1].body)
+	assert.Contains(t, parts[1].header.Get("Content-Disposition"), `filename=notes.txt`)
+	assert.Equal(t, "application/pdf", parts[2].header.Get("Content-Type"))
+	assert.Equal(t, "%PDF-report", parts[2].body)
+}
+
+func TestEmailNotifier_Send_AttachmentLimits(t *testing.T) {
+	var requests int
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(make([]byte, models.MaxAttachmentsSize/2))
+	}))
+	defer files.Close()
+
+	stub := newSMTPStub(t, nil, nil)
+	en, err := NewEmailNotifierWithDialer(config.EmailConfig{
+		SMTPHost: "localhost", SMTPPort: 2525, SMTPUser: "bot@example.com", TLSMode: config.SMTPTLSNone,
+	}, &redirectDialer{target: stub.ln.Addr().String()})
+	require.NoError(t, err)
+
+	notification := &models.Notification{
+		ID:      "id-1",
+		UserID:  "user@example.com",
+		Message: "files",
+		Attachments: []models.Attachment{
+			{Filename: "a.bin", URL: files.URL + "/a"},
+		},
+	}
+
+	// Без подмены клиента скачивание с loopback запрещено
+	err = en.Send(notification)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a public address")
+	assert.Zero(t, requests)
+
+	// Каждый файл в пределах лимита, но вместе с inline-вложением сумма превышена
+	en.client = files.Client()
+	notification.Attachments = append(notification.Attachments,
+		models.Attachment{Filename: "b.bin", URL: files.URL + "/b"},
+		models.Attachment{Filename: "notes.txt", Content: []byte("notes")},
+	)
+	err = en.Send(notification)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceed")
+	assert.Empty(t, stub.received())
+}
+
+func TestDenyInternalAddress(t *testing.T) {
+	for _, addr := range []string{
+		"127.0.0.1:80", "[::1]:80", "10.0.0.5:443", "172.16.3.4:80", "192.168.1.1:80",
+		"169.254.169.254:80", "[fe80::1]:80", "0.0.0.0:80", "100.64.0.1:80", "[::ffff:127.0.0.1]:80",
+	} {
+		assert.Error(t, denyInternalAddress("tcp", addr, nil), addr)
+	}
+	for _, addr := range []string{"93.184.216.34:443", "[2606:2800:220:1:248:1893:25c8:1946]:443"} {
+		assert.NoError(t, denyInternalAddress("tcp", addr, nil), addr)
+	}
+}
+
+func TestEmailNotifier_Send_TLSModes(t *testing.T) {
+	serverTLS, pool := testTLS(t)
+
+	tests := []struct {
+		name     string
+		mode     string
+		startTLS *tls.Config
+		implicit *tls.Config
+		wantErr  string
+	}{
+		{name: "starttls", mode: config.SMTPTLSStartTLS, startTLS: serverTLS},
+		{name: "implicit tls", mode: config.SMTPTLSImplicit, implicit: serverTLS},
+		{name: "starttls not offered", mode: config.SMTPTLSStartTLS, wantErr: "does not support STARTTLS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSMTPStub(t, tt.startTLS, tt.implicit)
+			en, err := NewEmailNotifier(config.EmailConfig{
+				SMTPHost: "127.0.0.1", SMTPPort: stub.port(), SMTPUser: "bot@example.com", SMTPPassword: "secret",
+				TLSMode: tt.mode,
+			})
+			require.NoError(t, err)
+			en.tlsConfig.RootCAs = pool
+
+			err = en.Send(&models.Notification{ID: "id-1", UserID: "user@example.com", Message: "hello"})
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Empty(t, stub.received())
+				return
+			}
+			require.NoError(t, err)
+			received := stub.received()
+			require.Len(t, received, 1)
+			assert.True(t, received[0].tls)
+			assert.Contains(t, received[0].data, "Subject: Notification")
+			assert.Contains(t, received[0].data, "Content-Type: text/plain")
+		})
+	}
+}
+
+func TestNewEmailNotifier_Config(t *testing.T) {
+	en, err := NewEmailNotifier(config.EmailConfig{SMTPHost: "smtp.example.com", SMTPPort: 465, SMTPUser: "bot@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, config.SMTPTLSImplicit, en.tlsMode)
+
+	en, err = NewEmailNotifier(config.EmailConfig{SMTPHost: "smtp.example.com", SMTPPort: 587, SMTPFrom: "noreply@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, config.SMTPTLSStartTLS, en.tlsMode)
+	assert.Equal(t, "noreply@example.com", en.from)
+
+	_, err = NewEmailNotifier(config.EmailConfig{SMTPHost: "smtp.example.com", SMTPUser: "bot@example.com", TLSMode: "ssl"})
+	assert.Error(t, err)
+	_, err = NewEmailNotifier(config.EmailConfig{SMTPHost: "smtp.example.com"})
+	assert.Error(t, err)
+
+	assert.NoError(t, en.ValidateRecipient("user@example.com"))
+	assert.Error(t, en.ValidateRecipient("1105031510"))
+	assert.Error(t, en.ValidateRecipient("User <user@example.com>"))
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   string
+}
+
+// readParts читает части multipart, декодируя base64. Quoted-printable декодирует multipart.Reader.
+func readParts(t *testing.T, r *multipart.Reader) []mimePart {
+	t.Helper()
+	var parts []mimePart
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		require.NoError(t, err)
+
+		var body io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			body = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		parts = append(parts, mimePart{header: p.Header, body: strings.TrimRight(string(data), "\r\n")})
+	}
+}
@@ -1,9 +1,12 @@
 package notifier
 
 import (
+	"errors"
 	"fmt"
-	"net/smtp"
+	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pozedorum/WB_project_3/task1/internal/config"
@@ -16,27 +19,14 @@ const (
 	TelegramType = "telegram"
 )
 
-type EmailNotifier struct {
-	SMTPHost     string
-	SMTPPort     int
-	SMTPUser     string
-	SMTPPassword string
-}
-
+// TelegramNotifier отправляет сообщения через один долгоживущий клиент Bot API,
+// который создается при первой отправке.
 type TelegramNotifier struct {
-	BotToken string
-}
+	BotToken    string
+	APIEndpoint string
 
-func NewEmailNotifier(config config.EmailConfig) (*EmailNotifier, error) {
-	if config.SMTPHost == "" || config.SMTPUser == "" {
-		return nil, fmt.Errorf("email notifier configuration incomplete")
-	}
-	zlog.Logger.Info().Msgf("Email notifier initialized for %s:%d", config.SMTPHost, config.SMTPPort)
-	return &EmailNotifier{
-		SMTPHost:     config.SMTPHost,
-		SMTPPort:     config.SMTPPort,
-		SMTPUser:     config.SMTPUser,
-		SMTPPassword: config.SMTPPassword}, nil
+	mu  sync.Mutex
+	bot *tgbotapi.BotAPI
 }
 
 // NewTelegramNotifier создает новый Telegram нотификатор с конфигурацией
@@ -49,49 +39,7 @@ func NewTelegramNotifier(config config.TelegramConfig) (*TelegramNotifier, error
 	} else {
 		zlog.Logger.Info().Msg("Telegram notifier initialized with bot token")
 	}
-	return &TelegramNotifier{BotToken: config.BotToken}, nil
-}
-
-func (en *EmailNotifier) Send(notification *models.Notification) error {
-	if en.SMTPHost == "" || en.SMTPUser == "" {
-		zlog.Logger.Info().Msgf("Email not configured properly, using stub for user %s", notification.UserID)
-		return nil
-	}
-
-	// Реальная логика отправки для Яндекс
-	auth := smtp.PlainAuth("", en.SMTPUser, en.SMTPPassword, en.SMTPHost)
-	to := []string{notification.UserID}
-
-	// Используем SMTP_USER как отправителя (Яндекс требует совпадение)
-	from := en.SMTPUser
-
-	msg := []byte(fmt.Sprintf(
-		"From: %s\r\nTo: %s\r\nSubject: Notification\r\nContent-Type: text/plain; charset=\"UTF-8\"\r\n\r\n%s",
-		from,
-		notification.UserID,
-		notification.Message,
-	))
-
-	err := smtp.SendMail(
-		fmt.Sprintf("%s:%d", en.SMTPHost, en.SMTPPort),
-		auth,
-		from,
-		to,
-		msg,
-	)
-
-	if err != nil {
-		zlog.Logger.Error().Err(err).Msg("Failed to send email via Yandex")
-		return fmt.Errorf("failed to send email: %w", err)
-	}
-
-	zlog.Logger.Info().Msgf("✅ Email sent successfully via Yandex SMTP to %s", notification.UserID)
-	return nil
-}
-
-// GetChannel возвращает тип канала для Email
-func (en *EmailNotifier) GetChannel() string {
-	return EmailType
+	return &TelegramNotifier{BotToken: config.BotToken, APIEndpoint: config.APIEndpoint}, nil
 }
 
 // Send реализация для Telegram
@@ -104,15 +52,11 @@ func (tn *TelegramNotifier) Send(notification *models.Notification) error {
 		return nil
 	}
 
-	// Создаем бота
-	bot, err := tgbotapi.NewBotAPI(tn.BotToken)
+	bot, err := tn.client()
 	if err != nil {
-		return fmt.Errorf("failed to create telegram bot: %w", err)
+		return err
 	}
 
-	// Устанавливаем режим отладки (опционально)
-	bot.Debug = true
-
 	// Конвертируем user_id в int64 (chat ID)
 	chatID, err := strconv.ParseInt(notification.UserID, 10, 64)
 	if err != nil {
@@ -121,10 +65,19 @@ func (tn *TelegramNotifier) Send(notification *models.Notification) error {
 
 	// Создаем сообщение
 	msg := tgbotapi.NewMessage(chatID, notification.Message)
+	msg.ParseMode = notification.ParseMode
 
 	// Отправляем сообщение
 	_, err = bot.Send(msg)
 	if err != nil {
+		// Telegram сообщает о превышении лимита кодом 429 и временем ожидания
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests {
+			return &models.RateLimitError{
+				RetryAfter: time.Duration(apiErr.RetryAfter) * time.Second,
+				Err:        fmt.Errorf("failed to send telegram message: %w", err),
+			}
+		}
 		return fmt.Errorf("failed to send telegram message: %w", err)
 	}
 
@@ -132,6 +85,27 @@ func (tn *TelegramNotifier) Send(notification *models.Notification) error {
 	return nil
 }
 
+// client возвращает клиент Bot API, создавая его при первом вызове.
+// Если создать не удалось, следующая отправка попробует снова.
+func (tn *TelegramNotifier) client() (*tgbotapi.BotAPI, error) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	if tn.bot != nil {
+		return tn.bot, nil
+	}
+	endpoint := tn.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(tn.BotToken, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
+	}
+	tn.bot = bot
+	return bot, nil
+}
+
 // GetChannel возвращает тип канала для Telegram
 func (tn *TelegramNotifier) GetChannel() string {
 	return TelegramType
@@ -0,0 +1,169 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+const (
+	WebhookType = "webhook"
+
+	// SignatureHeader содержит HMAC-SHA256 тела запроса в виде "sha256=<hex>"
+	SignatureHeader = "X-Notification-Signature"
+	// TimestampHeader содержит unix-время отправки, чтобы получатель мог отбрасывать старые запросы
+	TimestampHeader = "X-Notification-Timestamp"
+	IDHeader        = "X-Notification-ID"
+
+	defaultWebhookTimeout = 10 * time.Second
+	maxWebhookErrorBody   = 512
+
+	// defaultRetryAfter - пауза после 429 без заголовка Retry-After
+	defaultRetryAfter = time.Second
+)
+
+// WebhookNotifier отправляет уведомление POST-запросом с JSON на URL получателя (user_id).
+type WebhookNotifier struct {
+	secret []byte
+	client *http.Client
+}
+
+// WebhookPayload - тело запроса, которое получает подписчик.
+type WebhookPayload struct {
+	ID         string    `json:"id"`
+	Message    string    `json:"message"`
+	Subject    string    `json:"subject,omitempty"`
+	ParseMode  string    `json:"parse_mode,omitempty"`
+	SendAt     time.Time `json:"send_at"`
+	SentAt     time.Time `json:"sent_at"`
+	SeriesID   string    `json:"series_id,omitempty"`
+	Occurrence int       `json:"occurrence,omitempty"`
+}
+
+// StatusError возвращается, когда получатель ответил кодом вне диапазона 2xx.
+// Такая ошибка считается временной и приводит к повторной попытке.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// NewWebhookNotifier создает webhook нотификатор. Без секрета подпись невозможна,
+// поэтому канал в этом случае не регистрируется.
+func NewWebhookNotifier(config config.WebhookConfig) (*WebhookNotifier, error) {
+	if config.Secret == "" {
+		return nil, fmt.Errorf("webhook notifier configuration incomplete")
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	zlog.Logger.Info().Dur("timeout", timeout).Msg("Webhook notifier initialized")
+	return &WebhookNotifier{
+		secret: []byte(config.Secret),
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Send реализация для Webhook
+func (wn *WebhookNotifier) Send(notification *models.Notification) error {
+	if err := wn.ValidateRecipient(notification.UserID); err != nil {
+		return err
+	}
+
+	sentAt := time.Now().UTC()
+	body, err := json.Marshal(WebhookPayload{
+		ID:         notification.ID,
+		Message:    notification.Message,
+		Subject:    notification.Subject,
+		ParseMode:  notification.ParseMode,
+		SendAt:     notification.SendAt,
+		SentAt:     sentAt,
+		SeriesID:   notification.SeriesID,
+		Occurrence: notification.Occurrence,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, notification.UserID, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, notification.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(sentAt.Unix(), 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(wn.secret, body))
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorBody))
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &models.RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")), Err: statusErr}
+		}
+		return statusErr
+	}
+	// Дочитываем ответ, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	zlog.Logger.Info().Msgf("Webhook delivered successfully to %s", notification.UserID)
+	return nil
+}
+
+// parseRetryAfter разбирает Retry-After в секундах или в формате HTTP-даты
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return defaultRetryAfter
+}
+
+// ValidateRecipient проверяет, что получатель - абсолютный http(s) URL.
+func (wn *WebhookNotifier) ValidateRecipient(recipient string) error {
+	u, err := url.Parse(recipient)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url: must be an absolute http(s) url")
+	}
+	return nil
+}
+
+// GetChannel возвращает тип канала для Webhook
+func (wn *WebhookNotifier) GetChannel() string {
+	return WebhookType
+}
+
+// Sign вычисляет HMAC-SHA256 тела запроса в hex. Получатель проверяет подпись тем же секретом.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
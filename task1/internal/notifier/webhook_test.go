@@ -0,0 +1,127 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier_Send(t *testing.T) {
+	var (
+		gotBody      []byte
+		gotSignature string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(SignatureHeader)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "id-1", r.Header.Get(IDHeader))
+		assert.NotEmpty(t, r.Header.Get(TimestampHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	wn, err := NewWebhookNotifier(config.WebhookConfig{Secret: "secret"})
+	require.NoError(t, err)
+
+	err = wn.Send(&models.Notification{ID: "id-1", UserID: srv.URL, Message: "hello"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "sha256="+Sign([]byte("secret"), gotBody), gotSignature)
+
+	var payload WebhookPayload
+	require.NoError(t, json.Unmarshal(gotBody, &payload))
+	assert.Equal(t, "id-1", payload.ID)
+	assert.Equal(t, "hello", payload.Message)
+}
+
+func TestWebhookNotifier_Send_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		timeout    time.Duration
+		wantStatus int
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "redirect is not success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotModified)
+			},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+			},
+			timeout: 50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			wn, err := NewWebhookNotifier(config.WebhookConfig{Secret: "secret", Timeout: tt.timeout})
+			require.NoError(t, err)
+
+			err = wn.Send(&models.Notification{ID: "id-1", UserID: srv.URL, Message: "hello"})
+
+			require.Error(t, err)
+			var statusErr *StatusError
+			if tt.wantStatus != 0 {
+				require.True(t, errors.As(err, &statusErr))
+				assert.Equal(t, tt.wantStatus, statusErr.StatusCode)
+			} else {
+				assert.False(t, errors.As(err, &statusErr))
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_Send_TooManyRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	wn, err := NewWebhookNotifier(config.WebhookConfig{Secret: "secret"})
+	require.NoError(t, err)
+
+	err = wn.Send(&models.Notification{ID: "id-1", UserID: srv.URL, Message: "hello"})
+
+	var limited *models.RateLimitError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, 3*time.Second, limited.RetryAfter)
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+}
+
+func TestWebhookNotifier_ValidateRecipient(t *testing.T) {
+	wn := &WebhookNotifier{}
+
+	assert.NoError(t, wn.ValidateRecipient("https://example.com/hooks/notify"))
+	assert.Error(t, wn.ValidateRecipient("example.com/hooks"))
+	assert.Error(t, wn.ValidateRecipient("ftp://example.com"))
+	assert.Error(t, wn.ValidateRecipient("1105031510"))
+}
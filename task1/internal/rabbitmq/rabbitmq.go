@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/service"
 	"github.com/pozedorum/wbf/rabbitmq"
+	"github.com/pozedorum/wbf/retry"
 	"github.com/pozedorum/wbf/zlog"
+	"github.com/rabbitmq/amqp091-go"
 )
 
 // RabbitMQAdapter реализует взаимодействие с RabbitMQ:
@@ -22,9 +25,16 @@ type RabbitMQAdapter struct {
 	publisher    *rabbitmq.Publisher
 	mainQueue    rabbitmq.Queue
 	delayedQueue rabbitmq.Queue
+	deadQueue    rabbitmq.Queue
+	deadLetters  *rabbitmq.Publisher
+	prefetch     int
 }
 
-func NewRabbitMQAdapter(url string) (*RabbitMQAdapter, error) {
+const deadLetterRoutingKey = "dead_letter_routing_key"
+
+// NewRabbitMQAdapter подключается к RabbitMQ и объявляет exchange и очереди.
+// prefetch ограничивает число неподтвержденных сообщений у потребителя.
+func NewRabbitMQAdapter(url string, prefetch int) (*RabbitMQAdapter, error) {
 	zlog.Logger.Info().Msg("Initializing RabbitMQ adapter...")
 
 	// Устанавливаем соединение с RabbitMQ
@@ -82,7 +92,8 @@ func NewRabbitMQAdapter(url string) (*RabbitMQAdapter, error) {
 	}
 	zlog.Logger.Info().Str("queue", mainQueue.Name).Msg("Main queue declared")
 
-	// Создаем очередь для отложенных сообщений
+	// Создаем очередь для отложенных сообщений. Relay публикует сюда уведомления
+	// только в пределах окна планирования, поэтому TTL очереди служит лишь верхней границей.
 	zlog.Logger.Info().Msg("Declaring delayed queue with DLX settings...")
 	delayedQueue, err := qm.DeclareQueue("notifications_delayed_queue", rabbitmq.QueueConfig{
 		Durable:    true,
@@ -90,7 +101,7 @@ func NewRabbitMQAdapter(url string) (*RabbitMQAdapter, error) {
 		Args: map[string]interface{}{
 			"x-dead-letter-exchange":    mainExchange.Name(),
 			"x-dead-letter-routing-key": "notifications_routing_key",
-			"x-message-ttl":             int32(86400000),
+			"x-message-ttl":             int32(config.DelayedQueueTTL / time.Millisecond),
 		},
 	})
 	if err != nil {
@@ -100,6 +111,23 @@ func NewRabbitMQAdapter(url string) (*RabbitMQAdapter, error) {
 	}
 	zlog.Logger.Info().Str("queue", delayedQueue.Name).Str("dlx", mainExchange.Name()).Msg("Delayed queue declared")
 
+	// Создаем очередь для сообщений, которые не удалось доставить после всех попыток.
+	// Записи уведомлений, отправленных на replay, удаляет AckDeadLetters
+	zlog.Logger.Info().Msg("Declaring dead-letter queue...")
+	deadQueue, err := qm.DeclareQueue("notifications_dead_letter_queue", rabbitmq.QueueConfig{
+		Durable:    true,
+		AutoDelete: false,
+		Args: map[string]interface{}{
+			"x-message-ttl": int32(7 * 24 * time.Hour / time.Millisecond),
+		},
+	})
+	if err != nil {
+		channel.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+	zlog.Logger.Info().Str("queue", deadQueue.Name).Msg("Dead-letter queue declared")
+
 	// Привязываем основную очередь к основному exchange
 	zlog.Logger.Info().Msg("Binding main queue to main exchange...")
 	err = channel.QueueBind(
@@ -132,6 +160,21 @@ func NewRabbitMQAdapter(url string) (*RabbitMQAdapter, error) {
 	}
 	zlog.Logger.Info().Str("routing_key", "delayed_routing_key").Msg("Delayed queue bound to DLX")
 
+	// Привязываем очередь недоставленных сообщений к основному exchange
+	err = channel.QueueBind(
+		deadQueue.Name,
+		deadLetterRoutingKey,
+		mainExchange.Name(),
+		false,
+		nil,
+	)
+	if err != nil {
+		channel.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+	zlog.Logger.Info().Str("routing_key", deadLetterRoutingKey).Msg("Dead-letter queue bound to exchange")
+
 	// Создаем publisher для отправки сообщений в DLX
 	publisher := rabbitmq.NewPublisher(channel, dlxExchange.Name())
 	zlog.Logger.Info().Msg("Publisher created for DLX exchange")
@@ -145,6 +188,9 @@ func NewRabbitMQAdapter(url string) (*RabbitMQAdapter, error) {
 		publisher:    publisher,
 		mainQueue:    mainQueue,
 		delayedQueue: delayedQueue,
+		deadQueue:    deadQueue,
+		deadLetters:  rabbitmq.NewPublisher(channel, mainExchange.Name()),
+		prefetch:     prefetch,
 	}, nil
 }
 
@@ -181,71 +227,124 @@ func (a *RabbitMQAdapter) PublishWithDelay(ctx context.Context, queueName string
 	return nil
 }
 
-func (a *RabbitMQAdapter) Consume(ctx context.Context, queueName string) (<-chan []byte, error) {
-	zlog.Logger.Info().Str("queue", a.mainQueue.Name).Msg("Starting consumer")
+// PublishDeadLetter публикует сообщение в очередь недоставленных уведомлений.
+func (a *RabbitMQAdapter) PublishDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
 
-	// Создаем канал для сообщений
-	messages := make(chan []byte, 100)
+	err = a.deadLetters.PublishWithRetry(data, deadLetterRoutingKey, "application/json", models.StandartStrategy)
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
 
-	// Создаем конфигурацию потребителя
-	consumerConfig := &rabbitmq.ConsumerConfig{
-		Queue:   a.mainQueue.Name,
-		AutoAck: false,
+	zlog.Logger.Info().Str("queue", a.deadQueue.Name).Str("notification_id", dl.Notification.ID).Msg("Published message to dead-letter queue")
+	return nil
+}
+
+// AckDeadLetters удаляет из очереди недоставленных сообщения уведомлений notificationIDs.
+// RabbitMQ не удаляет сообщения выборочно, поэтому очередь вычитывается на отдельном канале
+// без автоподтверждения: найденные сообщения подтверждаются, остальные брокер возвращает
+// в очередь при закрытии канала.
+func (a *RabbitMQAdapter) AckDeadLetters(ctx context.Context, notificationIDs []string) error {
+	if len(notificationIDs) == 0 {
+		return nil
+	}
+	ids := make(map[string]bool, len(notificationIDs))
+	for _, id := range notificationIDs {
+		ids[id] = true
+	}
+
+	channel, err := a.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
 	}
+	defer channel.Close()
 
-	// Создаем потребителя
-	consumer := rabbitmq.NewConsumer(a.channel, consumerConfig)
+	acked := 0
+	for ctx.Err() == nil {
+		d, ok, err := channel.Get(a.deadQueue.Name, false)
+		if err != nil {
+			return fmt.Errorf("failed to read dead-letter queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+		var dl models.DeadLetter
+		if err := json.Unmarshal(d.Body, &dl); err != nil || !ids[dl.Notification.ID] {
+			continue
+		}
+		if err := d.Ack(false); err != nil {
+			return fmt.Errorf("failed to ack dead letter: %w", err)
+		}
+		acked++
+	}
+
+	zlog.Logger.Info().Str("queue", a.deadQueue.Name).Int("acked", acked).Msg("Dead letters acknowledged after replay")
+	return ctx.Err()
+}
 
-	// Запускаем потребление в отдельной горутине
+// Consume начинает потребление основной очереди с ручным подтверждением.
+// Брокер выдает не больше prefetch неподтвержденных сообщений, поэтому
+// новые сообщения остаются в очереди, пока воркер не подтвердит текущие.
+func (a *RabbitMQAdapter) Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error) {
+	zlog.Logger.Info().Str("queue", a.mainQueue.Name).Int("prefetch", a.prefetch).Msg("Starting consumer")
+
+	if err := a.channel.Qos(a.prefetch, 0, false); err != nil {
+		return nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
+	var deliveries <-chan amqp091.Delivery
+	err := retry.Do(func() error {
+		var err error
+		deliveries, err = a.channel.Consume(a.mainQueue.Name, "", false, false, false, false, nil)
+		return err
+	}, models.ConsumerStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start consumer: %w", err)
+	}
+
+	// Создаем канал для сообщений
+	messages := make(chan models.Delivery)
+
+	// Пересылаем сообщения в выходной канал
 	go func() {
 		defer close(messages)
 		zlog.Logger.Info().Str("queue", a.mainQueue.Name).Msg("Consumer goroutine started")
 
-		// Создаем канал для получения сообщений от RabbitMQ
-		rabbitMsgs := make(chan []byte, 100)
-
-		// Запускаем потребитель с retry стратегией
-		go func() {
-			zlog.Logger.Info().Str("queue", a.mainQueue.Name).Msg("Starting RabbitMQ consumer")
-			err := consumer.ConsumeWithRetry(
-				rabbitMsgs,
-				models.ConsumerStrategy,
-			)
-			if err != nil {
-				zlog.Logger.Error().Err(err).Msg("Consumer error")
-				close(rabbitMsgs)
-			}
-		}()
-
-		// Пересылаем сообщения в выходной канал
 		for {
 			select {
 			case <-ctx.Done():
 				zlog.Logger.Info().Msg("Consumer stopped by context")
 				return
 
-			case msg, ok := <-rabbitMsgs:
+			case d, ok := <-deliveries:
 				if !ok {
 					zlog.Logger.Info().Msg("RabbitMQ messages channel closed")
 					return
 				}
 
-				zlog.Logger.Info().Str("queue", a.mainQueue.Name).Int("size", len(msg)).Msg("Received message from RabbitMQ")
+				zlog.Logger.Info().Str("queue", a.mainQueue.Name).Int("size", len(d.Body)).Msg("Received message from RabbitMQ")
 
-				var processedMsg []byte
-				if len(msg) > 0 && msg[0] == '"' && msg[len(msg)-1] == '"' {
-					processedMsg = msg[1 : len(msg)-1]
-					zlog.Logger.Debug().Str("message", string(processedMsg)).Msg("Unquoted message")
-				} else {
-					processedMsg = msg
-					zlog.Logger.Debug().Str("message", string(processedMsg)).Msg("Raw message")
+				msg := models.Delivery{
+					Body: unquote(d.Body),
+					Ack: func() error {
+						return d.Ack(false)
+					},
+					Nack: func(requeue bool) error {
+						return d.Nack(false, requeue)
+					},
 				}
 
 				// Передаем сообщение дальше
 				select {
-				case messages <- processedMsg:
+				case messages <- msg:
 					zlog.Logger.Debug().Msg("Message forwarded to worker channel")
 				case <-ctx.Done():
+					if err := d.Nack(false, true); err != nil {
+						zlog.Logger.Error().Err(err).Msg("Failed to requeue message on consumer stop")
+					}
 					return
 				}
 			}
@@ -256,6 +355,16 @@ func (a *RabbitMQAdapter) Consume(ctx context.Context, queueName string) (<-chan
 	return messages, nil
 }
 
+// unquote снимает кавычки JSON-строки, в которую сериализуется []byte при публикации
+func unquote(msg []byte) []byte {
+	if len(msg) > 1 && msg[0] == '"' && msg[len(msg)-1] == '"' {
+		zlog.Logger.Debug().Str("message", string(msg[1:len(msg)-1])).Msg("Unquoted message")
+		return msg[1 : len(msg)-1]
+	}
+	zlog.Logger.Debug().Str("message", string(msg)).Msg("Raw message")
+	return msg
+}
+
 func (a *RabbitMQAdapter) Close() error {
 	var errors []error
 	zlog.Logger.Info().Msg("Closing RabbitMQ adapter...")
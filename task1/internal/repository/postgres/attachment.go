@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// attachmentContent - содержимое вложения, которое сохраняется вместе с уведомлением:
+// переданное при создании или скопированное из вложения предыдущего повтора серии.
+type attachmentContent struct {
+	id       string
+	content  []byte
+	sourceID string
+}
+
+// detachAttachments заменяет вложения уведомления ссылками с новыми идентификаторами и возвращает
+// содержимое для insertAttachments. Вызывается до notificationArgs, чтобы в колонку attachments
+// и payload outbox попали только ссылки.
+func detachAttachments(n *models.Notification) []attachmentContent {
+	if len(n.Attachments) == 0 {
+		return nil
+	}
+	var contents []attachmentContent
+	refs := make([]models.Attachment, len(n.Attachments))
+	for i, a := range n.Attachments {
+		switch {
+		case len(a.Content) > 0:
+			a.ID = uuid.New().String()
+			contents = append(contents, attachmentContent{id: a.ID, content: a.Content})
+			a.Content = nil
+		case a.ID != "" && a.URL == "":
+			// Повтор серии получает свою копию, чтобы удаление прошлого повтора ее не затронуло
+			sourceID := a.ID
+			a.ID = uuid.New().String()
+			contents = append(contents, attachmentContent{id: a.ID, sourceID: sourceID})
+		default:
+			// Вложение по URL скачивается при отправке и не хранится
+			a.ID = ""
+		}
+		refs[i] = a
+	}
+	n.Attachments = refs
+	return contents
+}
+
+// insertAttachments сохраняет в транзакции содержимое вложений уведомления notificationID.
+func insertAttachments(ctx context.Context, tx *sql.Tx, notificationID string, contents []attachmentContent) error {
+	insertQuery := `INSERT INTO notification_attachments (id, notification_id, content) VALUES ($1, $2, $3)`
+	copyQuery := `INSERT INTO notification_attachments (id, notification_id, content)
+		SELECT $1, $2, content FROM notification_attachments WHERE id = $3`
+
+	for _, c := range contents {
+		var err error
+		if c.sourceID != "" {
+			_, err = tx.ExecContext(ctx, copyQuery, c.id, notificationID, c.sourceID)
+		} else {
+			_, err = tx.ExecContext(ctx, insertQuery, c.id, notificationID, c.content)
+		}
+		if err != nil {
+			return fmt.Errorf("insert attachment: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetAttachmentContents возвращает содержимое вложений уведомления по их идентификаторам.
+func (nr *NotificationRepository) GetAttachmentContents(ctx context.Context, notificationID string) (map[string][]byte, error) {
+	selectQuery := `SELECT id, content FROM notification_attachments WHERE notification_id = $1`
+
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, selectQuery, notificationID)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", notificationID).Msg("Query failed for attachments")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	contents := make(map[string][]byte)
+	for rows.Next() {
+		var id string
+		var content []byte
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		contents[id] = content
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return contents, nil
+}
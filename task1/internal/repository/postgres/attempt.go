@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// RecordAttempt сохраняет попытку отправки и в той же транзакции увеличивает счетчик попыток
+// уведомления. Ошибка неудачной попытки становится last_error уведомления.
+func (nr *NotificationRepository) RecordAttempt(ctx context.Context, a *models.Attempt) error {
+	insertQuery := `INSERT INTO notification_attempts (notification_id, channel, started_at, duration_ms, error)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	updateQuery := `UPDATE notifications SET attempts = attempts + 1, last_error = COALESCE($1, last_error)
+		WHERE id = $2`
+
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, insertQuery,
+			a.NotificationID, a.Channel, a.StartedAt, a.DurationMS, nullString(a.Error)).Scan(&a.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, updateQuery, nullString(a.Error), a.NotificationID)
+		return err
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", a.NotificationID).Msg("Failed to record send attempt")
+	}
+	return err
+}
+
+// ListAttempts возвращает попытки отправки уведомления в хронологическом порядке.
+func (nr *NotificationRepository) ListAttempts(ctx context.Context, notificationID string) ([]*models.Attempt, error) {
+	listQuery := `SELECT id, notification_id, channel, started_at, duration_ms, COALESCE(error, '')
+		FROM notification_attempts WHERE notification_id = $1 ORDER BY started_at, id`
+
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, listQuery, notificationID)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", notificationID).Msg("Query failed for send attempts")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*models.Attempt
+	for rows.Next() {
+		var a models.Attempt
+		if err := rows.Scan(&a.ID, &a.NotificationID, &a.Channel, &a.StartedAt, &a.DurationMS, &a.Error); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		res = append(res, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// CreateBatch сохраняет рассылку, все ее уведомления и записи outbox в одной транзакции:
+// рассылка создается целиком или не создается совсем. Публикацию в очередь пачками
+// выполняет relay.
+func (nr *NotificationRepository) CreateBatch(ctx context.Context, b *models.Batch, notifications []*models.Notification) error {
+	batchQuery := `INSERT INTO notification_batches (id, total, created_at) VALUES ($1, $2, $3)`
+
+	args := make([][]interface{}, len(notifications))
+	payloads := make([][]byte, len(notifications))
+	for i, n := range notifications {
+		var err error
+		if args[i], payloads[i], err = notificationArgs(n); err != nil {
+			return err
+		}
+	}
+
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, batchQuery, b.ID, b.Total, b.CreatedAt); err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, insertNotificationQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, n := range notifications {
+			if _, err := stmt.ExecContext(ctx, args[i]...); err != nil {
+				return err
+			}
+			if err := insertOutbox(ctx, tx, n.ID, payloads[i], n.SendAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("batch_id", b.ID).Msg("Failed to create batch in database")
+		return err
+	}
+
+	zlog.Logger.Info().Str("batch_id", b.ID).Int("total", b.Total).Msg("Batch created in database")
+	return nil
+}
+
+// GetBatch возвращает рассылку с числом уведомлений по статусам или ErrBatchNotFound.
+func (nr *NotificationRepository) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	batchQuery := `SELECT id, total, created_at FROM notification_batches WHERE id = $1`
+	countsQuery := `SELECT status, COUNT(*) FROM notifications WHERE batch_id = $1 GROUP BY status`
+
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, batchQuery, id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("batch_id", id).Msg("Query failed for batch")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+		return nil, models.ErrBatchNotFound
+	}
+	var b models.Batch
+	if err := rows.Scan(&b.ID, &b.Total, &b.CreatedAt); err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+
+	counts, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, countsQuery, id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("batch_id", id).Msg("Query failed for batch status counts")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer counts.Close()
+
+	b.Counts = make(map[string]int)
+	for counts.Next() {
+		var status string
+		var count int
+		if err := counts.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		b.Counts[status] = count
+	}
+	if err := counts.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return &b, nil
+}
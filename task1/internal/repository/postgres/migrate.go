@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// Migrate применяет SQL-миграции из dir по порядку имен файлов и возвращает имена примененных.
+// Примененные миграции записываются в schema_migrations и при повторном запуске пропускаются,
+// каждая миграция выполняется в своей транзакции вместе с этой записью.
+func (nr *NotificationRepository) Migrate(ctx context.Context, dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no migrations found in %s", dir)
+	}
+	sort.Strings(files)
+
+	createQuery := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`
+	if _, err := nr.db.Master.ExecContext(ctx, createQuery); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var applied []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		script, err := os.ReadFile(file)
+		if err != nil {
+			return applied, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		done, err := nr.applyMigration(ctx, name, string(script))
+		if err != nil {
+			zlog.Logger.Error().Err(err).Str("migration", name).Msg("Failed to apply migration")
+			return applied, fmt.Errorf("migration %s: %w", name, err)
+		}
+		if done {
+			zlog.Logger.Info().Str("migration", name).Msg("Migration applied")
+			applied = append(applied, name)
+		}
+	}
+	return applied, nil
+}
+
+// applyMigration выполняет миграцию, если она еще не записана в schema_migrations.
+// Блокировка таблицы не дает двум процессам применить одну миграцию одновременно.
+func (nr *NotificationRepository) applyMigration(ctx context.Context, name, script string) (bool, error) {
+	tx, err := nr.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+		return false, fmt.Errorf("lock schema_migrations: %w", err)
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = $1)`, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check migration: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (name, applied_at) VALUES ($1, $2)`, name, time.Now()); err != nil {
+		return false, fmt.Errorf("record migration: %w", err)
+	}
+	return true, tx.Commit()
+}
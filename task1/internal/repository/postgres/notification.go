@@ -2,9 +2,14 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/service"
 	"github.com/pozedorum/wbf/dbpg"
@@ -33,12 +38,88 @@ func NewNotificationRepository(db *dbpg.DB) *NotificationRepository {
 	return &NotificationRepository{db: db}
 }
 
+// insertNotificationQuery добавляет уведомление, аргументы готовит notificationArgs
+const insertNotificationQuery = `INSERT INTO notifications (id, user_id, message, channel, send_at, status,
+	created_at, updated_at, series_id, recurrence, occurrence, template_id, template_version, variables,
+	channels, version, idempotency_key, batch_id, subject, parse_mode, attachments)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`
+
+// notificationArgs подготавливает аргументы insertNotificationQuery и payload записи outbox.
+// Версия по умолчанию выставляется до сериализации, чтобы попасть в payload,
+// ревизия новой записи совпадает со значением по умолчанию колонки.
+func notificationArgs(n *models.Notification) ([]interface{}, []byte, error) {
+	recurrence, err := marshalNullable(n.Recurrence)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal recurrence: %w", err)
+	}
+	var variables interface{}
+	if n.Variables != nil {
+		if variables, err = marshalNullable(&n.Variables); err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal variables: %w", err)
+		}
+	}
+	channels, err := marshalChannels(n.Channels)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal channels: %w", err)
+	}
+	var attachments interface{}
+	if len(n.Attachments) > 0 {
+		if attachments, err = marshalNullable(&n.Attachments); err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal attachments: %w", err)
+		}
+	}
+	var templateVersion interface{}
+	if n.TemplateID != "" {
+		templateVersion = n.TemplateVersion
+	}
+	occurrence := n.Occurrence
+	if occurrence == 0 {
+		occurrence = 1
+	}
+	if n.Version == 0 {
+		n.Version = 1
+	}
+	if n.Revision == 0 {
+		n.Revision = 1
+	}
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+
+	args := []interface{}{
+		n.ID, n.UserID, n.Message, n.Channel, n.SendAt, n.Status, n.CreatedAt, n.UpdatedAt,
+		nullString(n.SeriesID), recurrence, occurrence,
+		nullString(n.TemplateID), templateVersion, variables, channels, n.Version,
+		nullString(n.IdempotencyKey), nullString(n.BatchID),
+		nullString(n.Subject), nullString(n.ParseMode), attachments,
+	}
+	return args, payload, nil
+}
+
+// CreateNotification сохраняет уведомление, содержимое его вложений и запись outbox в одной транзакции,
+// чтобы уведомление не могло оказаться в базе без последующей публикации в очередь.
+// Вложения уведомления заменяются ссылками на сохраненное содержимое.
 func (nr *NotificationRepository) CreateNotification(ctx context.Context, n *models.Notification) error {
-	createQuery := `INSERT INTO notifications (id, user_id, message, channel, send_at, status, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	attachments := detachAttachments(n)
+	args, payload, err := notificationArgs(n)
+	if err != nil {
+		return err
+	}
 
-	_, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, createQuery,
-		n.ID, n.UserID, n.Message, n.Channel, n.SendAt, n.Status, n.CreatedAt, n.UpdatedAt)
+	err = nr.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, insertNotificationQuery, args...); err != nil {
+			if isUniqueViolation(err, idempotencyKeyIndex) {
+				return abortTx{models.ErrDuplicateIdempotencyKey}
+			}
+			return err
+		}
+		if err := insertAttachments(ctx, tx, n.ID, attachments); err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, n.ID, payload, n.SendAt)
+	})
 
 	if err != nil {
 		zlog.Logger.Error().Err(err).Str("notification_id", n.ID).Msg("Failed to create notification in database")
@@ -49,17 +130,102 @@ func (nr *NotificationRepository) CreateNotification(ctx context.Context, n *mod
 	return err
 }
 
-func (nr *NotificationRepository) UpdateNotificationStatus(ctx context.Context, id, status string) error {
-	updateQuery := `UPDATE notifications SET status = $1, updated_at = $2 WHERE id = $3`
-	_, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, updateQuery, status, time.Now(), id)
-
+// UpdateNotificationStatus меняет статус уведомления и возвращает его актуальное состояние
+// или ErrNotFound, если уведомления нет. Следующий повтор серии, построенный next,
+// сохраняется в той же транзакции.
+func (nr *NotificationRepository) UpdateNotificationStatus(ctx context.Context, id, status string, next models.NextOccurrenceFunc) (*models.Notification, error) {
+	updateQuery := `UPDATE notifications SET status = $1, updated_at = $2 WHERE id = $3
+		RETURNING ` + notificationColumns
+	finished, err := nr.finishNotifications(ctx, next, updateQuery, status, time.Now(), id)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Str("notification_id", id).Str("status", status).Msg("Failed to update notification status")
-	} else {
-		zlog.Logger.Info().Str("notification_id", id).Str("status", status).Msg("Notification status updated")
+		return nil, err
+	}
+	if len(finished) == 0 {
+		return nil, models.ErrNotFound
 	}
 
-	return err
+	zlog.Logger.Info().Str("notification_id", id).Str("status", status).Msg("Notification status updated")
+	return finished[0], nil
+}
+
+// GetByIdempotencyKey возвращает уведомление, созданное пользователем с данным ключом идемпотентности.
+func (nr *NotificationRepository) GetByIdempotencyKey(ctx context.Context, userID, key string) (*models.Notification, error) {
+	getQuery := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id = $1 AND idempotency_key = $2`
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, getQuery, userID, key)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Query failed for notification by idempotency key")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+		return nil, nil
+	}
+
+	res, err := scanNotification(rows)
+	if err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	return res, nil
+}
+
+// UpdateNotification сохраняет изменения ожидающего уведомления с версией n.Version, если текущая
+// версия в базе равна expectedVersion. В той же транзакции неопубликованные записи outbox
+// старой версии удаляются и добавляется запись с новой версией и временем отправки.
+// Новая ревизия записывается в n.Revision.
+func (nr *NotificationRepository) UpdateNotification(ctx context.Context, n *models.Notification, expectedVersion int) error {
+	lockQuery := `SELECT status, version FROM notifications WHERE id = $1 FOR UPDATE`
+	updateQuery := `UPDATE notifications SET message = $1, channel = $2, channels = $3, send_at = $4,
+		version = $5, updated_at = $6 WHERE id = $7 RETURNING revision`
+	dropOutboxQuery := `DELETE FROM notification_outbox WHERE notification_id = $1 AND dispatched_at IS NULL`
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+	channels, err := marshalChannels(n.Channels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal channels: %w", err)
+	}
+
+	err = nr.withTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		var version int
+		err := tx.QueryRowContext(ctx, lockQuery, n.ID).Scan(&status, &version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return abortTx{models.ErrNotFound}
+		}
+		if err != nil {
+			return err
+		}
+		if status != models.StatusPending {
+			return abortTx{models.ErrNotPending}
+		}
+		if version != expectedVersion {
+			return abortTx{models.ErrVersionConflict}
+		}
+
+		if err := tx.QueryRowContext(ctx, updateQuery,
+			n.Message, n.Channel, channels, n.SendAt, n.Version, n.UpdatedAt, n.ID).Scan(&n.Revision); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, dropOutboxQuery, n.ID); err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, n.ID, payload, n.SendAt)
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", n.ID).Msg("Failed to update notification")
+		return err
+	}
+
+	zlog.Logger.Info().Str("notification_id", n.ID).Int("version", n.Version).Msg("Notification updated in database")
+	return nil
 }
 
 func (nr *NotificationRepository) DeleteNotification(ctx context.Context, id string) error {
@@ -76,14 +242,13 @@ func (nr *NotificationRepository) DeleteNotification(ctx context.Context, id str
 }
 
 func (nr *NotificationRepository) GetByID(ctx context.Context, id string) (*models.Notification, error) {
-	getQuery := `SELECT id, user_id, message, channel, send_at, status, created_at, updated_at 
-		FROM notifications WHERE id = $1`
-	var res models.Notification
+	getQuery := `SELECT ` + notificationColumns + ` FROM notifications WHERE id = $1`
 	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, getQuery, id)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Query failed for notification")
 		return nil, fmt.Errorf("query failed: %v", err)
 	}
+	defer rows.Close()
 
 	if !rows.Next() {
 		if err = rows.Err(); err != nil {
@@ -94,8 +259,7 @@ func (nr *NotificationRepository) GetByID(ctx context.Context, id string) (*mode
 		return nil, nil
 	}
 
-	err = rows.Scan(&res.ID, &res.UserID, &res.Message, &res.Channel,
-		&res.SendAt, &res.Status, &res.CreatedAt, &res.UpdatedAt)
+	res, err := scanNotification(rows)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Scan failed for notification")
 		return nil, fmt.Errorf("scan failed: %w", err)
@@ -107,7 +271,589 @@ func (nr *NotificationRepository) GetByID(ctx context.Context, id string) (*mode
 	}
 
 	zlog.Logger.Debug().Str("notification_id", id).Msg("Notification retrieved from database")
-	return &res, nil
+	return res, nil
+}
+
+// DeleteSeries отменяет серию и удаляет ее ожидающие отправки уведомления, возвращая их идентификаторы.
+// Повтор, который сейчас отправляется, не удаляется и завершается как обычно, но отметка
+// в notification_canceled_series не даст insertNextOccurrence создать после него следующий.
+// Если у серии нет ни ожидающих, ни отправляемых повторов, возвращает ErrNotPending.
+func (nr *NotificationRepository) DeleteSeries(ctx context.Context, seriesID string) ([]string, error) {
+	liveQuery := `SELECT EXISTS (SELECT 1 FROM notifications WHERE series_id = $1 AND status IN ($2, $3))`
+	cancelQuery := `INSERT INTO notification_canceled_series (series_id, canceled_at) VALUES ($1, $2)
+		ON CONFLICT (series_id) DO NOTHING`
+	deleteQuery := `DELETE FROM notifications WHERE series_id = $1 AND status = $2 RETURNING id`
+
+	var ids []string
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		ids = nil
+		if err := lockSeries(ctx, tx, seriesID); err != nil {
+			return err
+		}
+
+		var live bool
+		if err := tx.QueryRowContext(ctx, liveQuery, seriesID, models.StatusPending, models.StatusSending).Scan(&live); err != nil {
+			return err
+		}
+		if !live {
+			return abortTx{models.ErrNotPending}
+		}
+
+		if _, err := tx.ExecContext(ctx, cancelQuery, seriesID, time.Now()); err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, deleteQuery, seriesID, models.StatusPending)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return fmt.Errorf("scan failed: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("series_id", seriesID).Msg("Failed to delete notification series")
+		return nil, fmt.Errorf("delete series failed: %w", err)
+	}
+
+	zlog.Logger.Info().Str("series_id", seriesID).Int("deleted", len(ids)).Msg("Notification series deleted")
+	return ids, nil
+}
+
+// MarkNotificationFailed переводит ожидающее или отправляемое уведомление в статус failed
+// с последней ошибкой и возвращает его актуальное состояние. Уже отправленное или завершенное
+// другим воркером уведомление не меняется, возвращается ErrNotPending: иначе replay отправил бы
+// его повторно. Попытки учитывает RecordAttempt. Следующий повтор серии, построенный next,
+// сохраняется в той же транзакции.
+func (nr *NotificationRepository) MarkNotificationFailed(ctx context.Context, id string, lastErr string, next models.NextOccurrenceFunc) (*models.Notification, error) {
+	updateQuery := `UPDATE notifications SET status = $1, last_error = $2, updated_at = $3
+		WHERE id = $4 AND status IN ($5, $6)
+		RETURNING ` + notificationColumns
+	finished, err := nr.finishNotifications(ctx, next, updateQuery, models.StatusFailed, lastErr, time.Now(), id,
+		models.StatusPending, models.StatusSending)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to mark notification failed")
+		return nil, err
+	}
+	if len(finished) == 0 {
+		return nil, models.ErrNotPending
+	}
+
+	zlog.Logger.Info().Str("notification_id", id).Int("attempts", finished[0].Attempts).Msg("Notification marked failed")
+	return finished[0], nil
+}
+
+// sortColumns - колонки, по которым разрешена сортировка списка уведомлений
+var sortColumns = map[string]string{
+	models.SortBySendAt:    "send_at",
+	models.SortByCreatedAt: "created_at",
+}
+
+// ListNotifications возвращает уведомления по фильтру с keyset-пагинацией по (колонка сортировки, id).
+func (nr *NotificationRepository) ListNotifications(ctx context.Context, filter models.NotificationFilter) ([]*models.Notification, error) {
+	sortColumn, ok := sortColumns[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported sort %q", models.ErrBadFilter, filter.SortBy)
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = "+arg(filter.UserID))
+	}
+	if filter.Channel != "" {
+		conditions = append(conditions, "channel = "+arg(filter.Channel))
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = arg(status)
+		}
+		conditions = append(conditions, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.SendFrom != nil {
+		conditions = append(conditions, "send_at >= "+arg(*filter.SendFrom))
+	}
+	if filter.SendTo != nil {
+		conditions = append(conditions, "send_at < "+arg(*filter.SendTo))
+	}
+
+	direction, cmp := "ASC", ">"
+	if filter.Desc {
+		direction, cmp = "DESC", "<"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)",
+			sortColumn, cmp, arg(filter.After.Value), arg(filter.After.ID)))
+	}
+
+	listQuery := `SELECT ` + notificationColumns + ` FROM notifications`
+	if len(conditions) > 0 {
+		listQuery += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	listQuery += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", sortColumn, direction, direction, arg(filter.Limit))
+
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, listQuery, args...)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Query failed for notifications list")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return res, nil
+}
+
+// GetFailedNotifications возвращает до limit уведомлений в статусе failed, начиная с последних.
+func (nr *NotificationRepository) GetFailedNotifications(ctx context.Context, limit int) ([]*models.Notification, error) {
+	listQuery := `SELECT ` + notificationColumns + ` FROM notifications
+		WHERE status = $1 ORDER BY updated_at DESC LIMIT $2`
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, listQuery, models.StatusFailed, limit)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Query failed for failed notifications")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return res, nil
+}
+
+// RequeueNotification возвращает уведомление из статуса failed в pending и в той же транзакции
+// добавляет запись outbox, чтобы relay снова опубликовал его в отложенную очередь.
+func (nr *NotificationRepository) RequeueNotification(ctx context.Context, id string) (*models.Notification, error) {
+	// Повторная отправка начинается с первого канала цепочки
+	requeueQuery := `UPDATE notifications SET status = $1, updated_at = $2, channel = COALESCE(channels->>0, channel)
+		WHERE id = $3 AND status = $4
+		RETURNING ` + notificationColumns
+
+	var res *models.Notification
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, requeueQuery, models.StatusPending, time.Now(), id, models.StatusFailed)
+		if err != nil {
+			return err
+		}
+		if !rows.Next() {
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return abortTx{models.ErrNotFailed}
+		}
+		n, err := scanNotification(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox payload: %w", err)
+		}
+		if err := insertOutbox(ctx, tx, n.ID, payload, n.SendAt); err != nil {
+			return err
+		}
+		res = n
+		return nil
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to requeue notification")
+		return nil, err
+	}
+
+	zlog.Logger.Info().Str("notification_id", id).Msg("Notification requeued")
+	return res, nil
+}
+
+// RescheduleNotification переносит ожидающее уведомление на n.SendAt и в той же транзакции
+// добавляет запись outbox с новым временем. Для неожидающего уведомления возвращает ErrNotPending.
+// Новая ревизия записывается в n.Revision.
+func (nr *NotificationRepository) RescheduleNotification(ctx context.Context, n *models.Notification) error {
+	rescheduleQuery := `UPDATE notifications SET send_at = $1, updated_at = $2 WHERE id = $3 AND status = $4
+		RETURNING revision`
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+
+	err = nr.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, rescheduleQuery, n.SendAt, n.UpdatedAt, n.ID, models.StatusPending).Scan(&n.Revision)
+		if errors.Is(err, sql.ErrNoRows) {
+			return abortTx{models.ErrNotPending}
+		}
+		if err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, n.ID, payload, n.SendAt)
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", n.ID).Msg("Failed to reschedule notification")
+		return err
+	}
+
+	zlog.Logger.Info().Str("notification_id", n.ID).Time("send_at", n.SendAt).Msg("Notification rescheduled")
+	return nil
+}
+
+// SwitchChannel переключает ожидающее уведомление на n.Channel после исчерпания попыток
+// на предыдущем канале и в той же транзакции добавляет запись outbox для немедленной отправки.
+// Новая ревизия записывается в n.Revision.
+func (nr *NotificationRepository) SwitchChannel(ctx context.Context, n *models.Notification) error {
+	switchQuery := `UPDATE notifications SET channel = $1, channels = $2, last_error = $3, updated_at = $4
+		WHERE id = $5 AND status = $6
+		RETURNING revision`
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+	channels, err := marshalChannels(n.Channels)
+	if err != nil {
+		return fmt.Errorf("failed to marshal channels: %w", err)
+	}
+
+	err = nr.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, switchQuery,
+			n.Channel, channels, n.LastError, n.UpdatedAt, n.ID, models.StatusPending).Scan(&n.Revision)
+		if errors.Is(err, sql.ErrNoRows) {
+			return abortTx{models.ErrNotPending}
+		}
+		if err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, n.ID, payload, time.Now())
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", n.ID).Msg("Failed to switch notification channel")
+		return err
+	}
+
+	zlog.Logger.Info().Str("notification_id", n.ID).Str("channel", n.Channel).Msg("Notification channel switched")
+	return nil
+}
+
+// ClaimNotification атомарно переводит ожидающее уведомление в статус sending до now+lease.
+// Захватить уведомление может только один воркер: остальные получают ErrNotPending,
+// а сообщения устаревшей версии (version != 0) - ErrStaleVersion.
+func (nr *NotificationRepository) ClaimNotification(ctx context.Context, id string, version int, lease time.Duration) (*models.Notification, error) {
+	claimQuery := `UPDATE notifications SET status = $1, claimed_until = $2, updated_at = $3
+		WHERE id = $4 AND status = $5 AND ($6::int = 0 OR version = $6::int)
+		RETURNING ` + notificationColumns
+	stateQuery := `SELECT status, version FROM notifications WHERE id = $1`
+
+	now := time.Now()
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, claimQuery,
+		models.StatusSending, now.Add(lease), now, id, models.StatusPending, version)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to claim notification")
+		return nil, fmt.Errorf("claim failed: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		zlog.Logger.Debug().Str("notification_id", id).Msg("Notification claimed for sending")
+		return n, nil
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	// Выясняем, почему захват не удался
+	state, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, stateQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer state.Close()
+
+	if state.Next() {
+		var status string
+		var current int
+		if err := state.Scan(&status, &current); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		if status == models.StatusPending && current != version {
+			return nil, models.ErrStaleVersion
+		}
+	}
+	return nil, models.ErrNotPending
+}
+
+// ReleaseNotification возвращает захваченное уведомление в pending после неудачной попытки отправки
+// и возвращает его актуальное состояние. Если уведомление уже не в sending, возвращает nil.
+func (nr *NotificationRepository) ReleaseNotification(ctx context.Context, id string) (*models.Notification, error) {
+	releaseQuery := `UPDATE notifications SET status = $1, claimed_until = NULL, updated_at = $2
+		WHERE id = $3 AND status = $4
+		RETURNING ` + notificationColumns
+	n, err := nr.updateReturning(ctx, releaseQuery, models.StatusPending, time.Now(), id, models.StatusSending)
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to release notification")
+	} else {
+		zlog.Logger.Debug().Str("notification_id", id).Msg("Notification released")
+	}
+
+	return n, err
+}
+
+// RecoverStuckNotifications переводит в failed уведомления, которые остались в статусе sending
+// после истечения аренды. Воркер мог успеть отправить их, поэтому повторная отправка не выполняется
+// автоматически - уведомление можно вернуть в работу через replay. Следующие повторы серий,
+// построенные next, сохраняются в той же транзакции.
+func (nr *NotificationRepository) RecoverStuckNotifications(ctx context.Context, lastErr string, next models.NextOccurrenceFunc) ([]*models.Notification, error) {
+	recoverQuery := `UPDATE notifications SET status = $1, last_error = $2, claimed_until = NULL, updated_at = $3
+		WHERE status = $4 AND claimed_until < $3
+		RETURNING ` + notificationColumns
+
+	res, err := nr.finishNotifications(ctx, next, recoverQuery,
+		models.StatusFailed, lastErr, time.Now(), models.StatusSending)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to recover stuck notifications")
+		return nil, fmt.Errorf("recover failed: %w", err)
+	}
+
+	if len(res) > 0 {
+		zlog.Logger.Warn().Int("count", len(res)).Msg("Stuck notifications marked failed")
+	}
+	return res, nil
+}
+
+// finishNotifications выполняет UPDATE ... RETURNING notificationColumns, завершающий уведомления,
+// и в той же транзакции сохраняет следующие повторы их серий. Уже созданный повтор
+// (например, при отправке уведомления, которое ранее было failed и вернулось через replay)
+// не создается заново.
+func (nr *NotificationRepository) finishNotifications(ctx context.Context, next models.NextOccurrenceFunc, query string, args ...interface{}) ([]*models.Notification, error) {
+	var finished []*models.Notification
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		finished, err = queryNotifications(ctx, tx, query, args...)
+		if err != nil {
+			return err
+		}
+		for _, n := range finished {
+			if err := insertNextOccurrence(ctx, tx, n, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update failed: %w", err)
+	}
+	return finished, nil
+}
+
+// queryNotifications выполняет в транзакции запрос, возвращающий notificationColumns.
+// Строки читаются полностью, чтобы в транзакции можно было выполнять следующие запросы.
+func queryNotifications(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]*models.Notification, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+// insertNextOccurrence сохраняет в транзакции следующий повтор серии finished, если next его построит,
+// такого повтора еще нет и серия не отменена.
+func insertNextOccurrence(ctx context.Context, tx *sql.Tx, finished *models.Notification, next models.NextOccurrenceFunc) error {
+	if next == nil || finished.SeriesID == "" {
+		return nil
+	}
+	if err := lockSeries(ctx, tx, finished.SeriesID); err != nil {
+		return err
+	}
+
+	existsQuery := `SELECT EXISTS (SELECT 1 FROM notifications WHERE series_id = $1 AND occurrence = $2)
+		OR EXISTS (SELECT 1 FROM notification_canceled_series WHERE series_id = $1)`
+	var skip bool
+	if err := tx.QueryRowContext(ctx, existsQuery, finished.SeriesID, finished.Occurrence+1).Scan(&skip); err != nil {
+		return err
+	}
+	if skip {
+		return nil
+	}
+
+	n := next(finished)
+	if n == nil {
+		return nil
+	}
+	attachments := detachAttachments(n)
+	args, payload, err := notificationArgs(n)
+	if err != nil {
+		return abortTx{err}
+	}
+	if _, err := tx.ExecContext(ctx, insertNotificationQuery, args...); err != nil {
+		return err
+	}
+	if err := insertAttachments(ctx, tx, n.ID, attachments); err != nil {
+		return err
+	}
+	return insertOutbox(ctx, tx, n.ID, payload, n.SendAt)
+}
+
+// lockSeries берет до конца транзакции блокировку серии. Без нее DeleteSeries и завершение
+// отправляемого повтора в READ COMMITTED не видят изменений друг друга, и следующий повтор
+// создается уже после отмены серии.
+func lockSeries(ctx context.Context, tx *sql.Tx, seriesID string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, seriesID)
+	return err
+}
+
+// updateReturning выполняет UPDATE ... RETURNING notificationColumns для одного уведомления.
+// Если запрос не изменил ни одной строки, возвращает nil.
+func (nr *NotificationRepository) updateReturning(ctx context.Context, query string, args ...interface{}) (*models.Notification, error) {
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("update failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+		return nil, nil
+	}
+	n, err := scanNotification(rows)
+	if err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	return n, nil
+}
+
+// notificationColumns - список колонок, который ожидает scanNotification
+const notificationColumns = `id, user_id, message, channel, send_at, status, attempts, COALESCE(last_error, ''),
+	created_at, updated_at, COALESCE(series_id, ''), recurrence, occurrence,
+	COALESCE(template_id, ''), COALESCE(template_version, 0), variables, channels, version,
+	COALESCE(idempotency_key, ''), COALESCE(batch_id, ''),
+	COALESCE(subject, ''), COALESCE(parse_mode, ''), attachments, revision`
+
+func scanNotification(rows *sql.Rows) (*models.Notification, error) {
+	var n models.Notification
+	var recurrence, variables, channels, attachments []byte
+	err := rows.Scan(&n.ID, &n.UserID, &n.Message, &n.Channel,
+		&n.SendAt, &n.Status, &n.Attempts, &n.LastError, &n.CreatedAt, &n.UpdatedAt,
+		&n.SeriesID, &recurrence, &n.Occurrence,
+		&n.TemplateID, &n.TemplateVersion, &variables, &channels, &n.Version,
+		&n.IdempotencyKey, &n.BatchID,
+		&n.Subject, &n.ParseMode, &attachments, &n.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if attachments != nil {
+		if err := json.Unmarshal(attachments, &n.Attachments); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal attachments: %w", err)
+		}
+	}
+	if channels != nil {
+		if err := json.Unmarshal(channels, &n.Channels); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal channels: %w", err)
+		}
+	}
+	if variables != nil {
+		if err := json.Unmarshal(variables, &n.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal variables: %w", err)
+		}
+	}
+	if recurrence != nil {
+		n.Recurrence = &models.Recurrence{}
+		if err := json.Unmarshal(recurrence, n.Recurrence); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal recurrence: %w", err)
+		}
+	}
+	return &n, nil
+}
+
+// marshalNullable сериализует значение для JSONB колонки, nil превращается в NULL
+func marshalNullable[T any](v *T) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// idempotencyKeyIndex - уникальный индекс (user_id, idempotency_key)
+const idempotencyKeyIndex = "idx_notifications_user_idempotency_key"
+
+// isUniqueViolation сообщает, что запрос нарушил уникальный индекс index
+func isUniqueViolation(err error, index string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == index
+}
+
+// marshalChannels сериализует цепочку каналов, пустая цепочка хранится как NULL
+func marshalChannels(channels []string) (interface{}, error) {
+	if len(channels) == 0 {
+		return nil, nil
+	}
+	return marshalNullable(&channels)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
 }
 
 func (nr *NotificationRepository) Close() {
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/retry"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// ClaimOutboxBatch захватывает до limit неотправленных записей outbox со временем отправки
+// не позже dueBefore на время lease. Захваченные записи не видны другим экземплярам relay,
+// пока не истечет lease, поэтому при падении процесса до публикации запись будет обработана повторно.
+func (nr *NotificationRepository) ClaimOutboxBatch(ctx context.Context, limit int, dueBefore time.Time, lease time.Duration) ([]models.OutboxMessage, error) {
+	claimQuery := `UPDATE notification_outbox SET locked_until = $1
+		WHERE id IN (
+			SELECT id FROM notification_outbox
+			WHERE dispatched_at IS NULL AND send_at <= $2 AND (locked_until IS NULL OR locked_until < $3)
+			ORDER BY send_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, notification_id, payload, send_at, created_at`
+
+	now := time.Now()
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, claimQuery, now.Add(lease), dueBefore, now, limit)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to claim outbox batch")
+		return nil, fmt.Errorf("claim outbox failed: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var m models.OutboxMessage
+		if err := rows.Scan(&m.ID, &m.NotificationID, &m.Payload, &m.SendAt, &m.CreatedAt); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Scan failed for outbox message")
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	if len(messages) > 0 {
+		zlog.Logger.Debug().Int("count", len(messages)).Msg("Outbox batch claimed")
+	}
+	return messages, nil
+}
+
+// MarkOutboxDispatched помечает запись outbox как опубликованную в очередь.
+func (nr *NotificationRepository) MarkOutboxDispatched(ctx context.Context, id int64) error {
+	markQuery := `UPDATE notification_outbox SET dispatched_at = $1, locked_until = NULL WHERE id = $2`
+	_, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, markQuery, time.Now(), id)
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int64("outbox_id", id).Msg("Failed to mark outbox message dispatched")
+	} else {
+		zlog.Logger.Debug().Int64("outbox_id", id).Msg("Outbox message dispatched")
+	}
+
+	return err
+}
+
+// insertOutbox добавляет запись outbox в рамках переданной транзакции.
+func insertOutbox(ctx context.Context, tx *sql.Tx, notificationID string, payload []byte, sendAt time.Time) error {
+	insertQuery := `INSERT INTO notification_outbox (notification_id, payload, send_at, created_at)
+		VALUES ($1, $2, $3, $4)`
+	_, err := tx.ExecContext(ctx, insertQuery, notificationID, string(payload), sendAt, time.Now())
+	return err
+}
+
+// abortTx прерывает транзакцию без повторных попыток, например при нарушении бизнес-условия.
+type abortTx struct {
+	err error
+}
+
+func (a abortTx) Error() string {
+	return a.err.Error()
+}
+
+// withTx выполняет fn в транзакции с повторными попытками при ошибке.
+// Ошибка, обернутая в abortTx, откатывает транзакцию и возвращается сразу.
+func (nr *NotificationRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var aborted error
+	err := retry.Do(func() error {
+		tx, err := nr.db.Master.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			var abort abortTx
+			if errors.As(err, &abort) {
+				aborted = abort.err
+				return nil
+			}
+			return err
+		}
+		return tx.Commit()
+	}, models.StandartStrategy)
+
+	if aborted != nil {
+		return aborted
+	}
+	return err
+}
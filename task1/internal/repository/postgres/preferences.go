@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// GetPreferences возвращает предпочтения пользователя или ErrPreferencesNotFound.
+func (nr *NotificationRepository) GetPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	getQuery := `SELECT user_id, contacts, channels, timezone, quiet_start, quiet_end, updated_at
+		FROM user_preferences WHERE user_id = $1`
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, getQuery, userID)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Query failed for user preferences")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+		return nil, models.ErrPreferencesNotFound
+	}
+
+	var (
+		p                    models.UserPreferences
+		contacts             []byte
+		channels             []byte
+		quietStart, quietEnd sql.NullString
+	)
+	if err := rows.Scan(&p.UserID, &contacts, &channels, &p.Timezone, &quietStart, &quietEnd, &p.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	if err := json.Unmarshal(contacts, &p.Contacts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal contacts: %w", err)
+	}
+	if len(channels) > 0 {
+		if err := json.Unmarshal(channels, &p.Channels); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal channels: %w", err)
+		}
+	}
+	if quietStart.Valid && quietEnd.Valid {
+		p.QuietHours = &models.QuietHours{Start: quietStart.String, End: quietEnd.String}
+	}
+	return &p, nil
+}
+
+// SavePreferences создает или полностью заменяет предпочтения пользователя.
+func (nr *NotificationRepository) SavePreferences(ctx context.Context, p *models.UserPreferences) error {
+	saveQuery := `INSERT INTO user_preferences (user_id, contacts, channels, timezone, quiet_start, quiet_end, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET contacts = EXCLUDED.contacts, channels = EXCLUDED.channels,
+			timezone = EXCLUDED.timezone, quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+			updated_at = EXCLUDED.updated_at`
+
+	contacts, err := marshalNullable(&p.Contacts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contacts: %w", err)
+	}
+	var channels interface{}
+	if len(p.Channels) > 0 {
+		if channels, err = marshalNullable(&p.Channels); err != nil {
+			return fmt.Errorf("failed to marshal channels: %w", err)
+		}
+	}
+	var quietStart, quietEnd interface{}
+	if p.QuietHours != nil {
+		quietStart, quietEnd = p.QuietHours.Start, p.QuietHours.End
+	}
+
+	_, err = nr.db.ExecWithRetry(ctx, models.StandartStrategy, saveQuery,
+		p.UserID, contacts, channels, p.Timezone, quietStart, quietEnd, p.UpdatedAt)
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", p.UserID).Msg("Failed to save user preferences")
+	} else {
+		zlog.Logger.Info().Str("user_id", p.UserID).Msg("User preferences saved")
+	}
+
+	return err
+}
+
+// DeletePreferences удаляет предпочтения пользователя.
+func (nr *NotificationRepository) DeletePreferences(ctx context.Context, userID string) error {
+	deleteQuery := `DELETE FROM user_preferences WHERE user_id = $1`
+	res, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, deleteQuery, userID)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to delete user preferences")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return models.ErrPreferencesNotFound
+	}
+
+	zlog.Logger.Info().Str("user_id", userID).Msg("User preferences deleted")
+	return nil
+}
+
+// Implement PreferencesRepository interface
+var _ service.PreferencesRepository = (*NotificationRepository)(nil)
@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/dbpg"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+var (
+	ErrQueueClosed    = errors.New("queue is closed")
+	errAlreadySettled = errors.New("delivery already acknowledged")
+)
+
+// Queue - очередь отложенных сообщений в таблице notification_queue для развертываний
+// без RabbitMQ. Как и RabbitMQAdapter, она содержит одну основную очередь: имя очереди
+// в PublishWithDelay и Consume используется только в логах.
+//
+// Потребитель захватывает готовые сообщения через SELECT ... FOR UPDATE SKIP LOCKED,
+// поэтому несколько реплик воркера не получат одно сообщение. Захваченное сообщение
+// скрыто на visibility: если воркер упал, не подтвердив его, сообщение станет доступно снова.
+type Queue struct {
+	db           *dbpg.DB
+	pollInterval time.Duration
+	visibility   time.Duration
+	prefetch     int
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewQueue создает очередь на подключении db. Потребитель проверяет таблицу раз
+// в pollInterval и захватывает не больше prefetch сообщений за раз.
+func NewQueue(db *dbpg.DB, pollInterval, visibility time.Duration, prefetch int) *Queue {
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+	return &Queue{
+		db:           db,
+		pollInterval: pollInterval,
+		visibility:   visibility,
+		prefetch:     prefetch,
+		closed:       make(chan struct{}),
+	}
+}
+
+// Queue создает очередь на подключении репозитория.
+func (nr *NotificationRepository) Queue(pollInterval, visibility time.Duration, prefetch int) *Queue {
+	return NewQueue(nr.db, pollInterval, visibility, prefetch)
+}
+
+func (q *Queue) PublishWithDelay(ctx context.Context, queueName string, message interface{}, delay time.Duration) error {
+	payload, err := encodeMessage(message)
+	if err != nil {
+		return err
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	insertQuery := `INSERT INTO notification_queue (payload, deliver_at, created_at) VALUES ($1, $2, $3)`
+	now := time.Now()
+	_, err = q.db.ExecWithRetry(ctx, models.StandartStrategy, insertQuery, string(payload), now.Add(delay), now)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("queue", queueName).Msg("Failed to publish message to PostgreSQL queue")
+		return fmt.Errorf("failed to publish message with delay: %w", err)
+	}
+
+	zlog.Logger.Debug().Str("queue", queueName).Dur("delay", delay).Msg("Published message to PostgreSQL queue")
+	return nil
+}
+
+// PublishDeadLetter сохраняет сообщение в таблице notification_dead_letters.
+func (q *Queue) PublishDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	insertQuery := `INSERT INTO notification_dead_letters (notification_id, payload, created_at) VALUES ($1, $2, $3)`
+	if _, err := q.db.ExecWithRetry(ctx, models.StandartStrategy, insertQuery, dl.Notification.ID, string(data), time.Now()); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	zlog.Logger.Info().Str("notification_id", dl.Notification.ID).Msg("Published message to dead-letter table")
+	return nil
+}
+
+// AckDeadLetters удаляет записи notification_dead_letters уведомлений notificationIDs.
+func (q *Queue) AckDeadLetters(ctx context.Context, notificationIDs []string) error {
+	if len(notificationIDs) == 0 {
+		return nil
+	}
+	deleteQuery := `DELETE FROM notification_dead_letters WHERE notification_id = ANY($1)`
+	if _, err := q.db.ExecWithRetry(ctx, models.StandartStrategy, deleteQuery, pq.Array(notificationIDs)); err != nil {
+		return fmt.Errorf("failed to ack dead letters: %w", err)
+	}
+	return nil
+}
+
+// Consume возвращает канал сообщений, время доставки которых наступило. Канал небуферизованный,
+// захваченные, но не переданные потребителю сообщения при остановке возвращаются в очередь.
+// Канал закрывается при отмене ctx или закрытии очереди.
+func (q *Queue) Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error) {
+	if q.isClosed() {
+		return nil, ErrQueueClosed
+	}
+
+	messages := make(chan models.Delivery)
+	go func() {
+		defer close(messages)
+		zlog.Logger.Info().Str("queue", queueName).Dur("poll_interval", q.pollInterval).Msg("PostgreSQL queue consumer started")
+
+		for {
+			batch, err := q.claim(ctx)
+			if err != nil && ctx.Err() == nil {
+				zlog.Logger.Error().Err(err).Str("queue", queueName).Msg("Failed to claim messages from PostgreSQL queue")
+			}
+
+			for i, msg := range batch {
+				select {
+				case messages <- q.delivery(msg):
+					continue
+				case <-ctx.Done():
+				case <-q.closed:
+				}
+				q.release(batch[i:])
+				return
+			}
+
+			// Полный пакет - вероятно, готовы еще сообщения, забираем их без ожидания
+			if err == nil && len(batch) == q.prefetch {
+				continue
+			}
+			select {
+			case <-time.After(q.pollInterval):
+			case <-ctx.Done():
+				return
+			case <-q.closed:
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// Close останавливает потребителей. Подключение к базе закрывает репозиторий.
+func (q *Queue) Close() error {
+	q.closeOnce.Do(func() { close(q.closed) })
+	return nil
+}
+
+type queueMessage struct {
+	id        int64
+	payload   []byte
+	deliverAt time.Time
+}
+
+// claim захватывает до prefetch готовых сообщений на visibility в порядке времени доставки.
+func (q *Queue) claim(ctx context.Context) ([]queueMessage, error) {
+	claimQuery := `UPDATE notification_queue SET locked_until = $1
+		WHERE id IN (
+			SELECT id FROM notification_queue
+			WHERE deliver_at <= $2 AND (locked_until IS NULL OR locked_until < $2)
+			ORDER BY deliver_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, payload #>> '{}', deliver_at`
+
+	now := time.Now()
+	rows, err := q.db.QueryWithRetry(ctx, models.StandartStrategy, claimQuery, now.Add(q.visibility), now, q.prefetch)
+	if err != nil {
+		return nil, fmt.Errorf("claim failed: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []queueMessage
+	for rows.Next() {
+		var m queueMessage
+		if err := rows.Scan(&m.id, &m.payload, &m.deliverAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		batch = append(batch, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	// RETURNING не сохраняет порядок подзапроса
+	sort.Slice(batch, func(i, j int) bool {
+		if batch[i].deliverAt.Equal(batch[j].deliverAt) {
+			return batch[i].id < batch[j].id
+		}
+		return batch[i].deliverAt.Before(batch[j].deliverAt)
+	})
+	return batch, nil
+}
+
+// delivery оборачивает захваченное сообщение: Ack удаляет его, Nack с requeue
+// снимает захват, без requeue - удаляет, как отклоненное сообщение в RabbitMQ.
+func (q *Queue) delivery(msg queueMessage) models.Delivery {
+	var settled atomic.Bool
+	return models.Delivery{
+		Body: msg.payload,
+		Ack: func() error {
+			if !settled.CompareAndSwap(false, true) {
+				return errAlreadySettled
+			}
+			return q.remove(msg.id)
+		},
+		Nack: func(requeue bool) error {
+			if !settled.CompareAndSwap(false, true) {
+				return errAlreadySettled
+			}
+			if requeue {
+				return q.unlock([]int64{msg.id})
+			}
+			return q.remove(msg.id)
+		},
+	}
+}
+
+func (q *Queue) remove(id int64) error {
+	deleteQuery := `DELETE FROM notification_queue WHERE id = $1`
+	// Контекст потребителя может быть уже отменен, подтверждение все равно нужно записать
+	_, err := q.db.ExecWithRetry(context.Background(), models.StandartStrategy, deleteQuery, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete queue message: %w", err)
+	}
+	return nil
+}
+
+// unlock снимает захват с сообщений, они сразу становятся доступны потребителям.
+func (q *Queue) unlock(ids []int64) error {
+	unlockQuery := `UPDATE notification_queue SET locked_until = NULL WHERE id = ANY($1)`
+	_, err := q.db.ExecWithRetry(context.Background(), models.StandartStrategy, unlockQuery, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to unlock queue messages: %w", err)
+	}
+	return nil
+}
+
+// release возвращает в очередь сообщения, которые не удалось передать потребителю
+func (q *Queue) release(batch []queueMessage) {
+	ids := make([]int64, len(batch))
+	for i, m := range batch {
+		ids[i] = m.id
+	}
+	if err := q.unlock(ids); err != nil {
+		zlog.Logger.Error().Err(err).Int("count", len(ids)).Msg("Failed to release claimed messages")
+	}
+}
+
+func (q *Queue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeMessage сериализует сообщение в JSON, как RabbitMQAdapter: []byte (готовый JSON из outbox)
+// становится JSON-строкой base64. Кавычки снимает claim (payload #>> '{}'), поэтому потребитель
+// получает то же тело, что и из RabbitMQ.
+func encodeMessage(message interface{}) ([]byte, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return data, nil
+}
+
+var _ service.Queue = (*Queue)(nil)
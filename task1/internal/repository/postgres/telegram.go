@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// CreateTelegramLink сохраняет токен привязки чата.
+func (nr *NotificationRepository) CreateTelegramLink(ctx context.Context, link *models.TelegramLink) error {
+	insertQuery := `INSERT INTO telegram_link_tokens (token, user_id, expires_at) VALUES ($1, $2, $3)`
+	_, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, insertQuery, link.Token, link.UserID, link.ExpiresAt)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", link.UserID).Msg("Failed to create telegram link token")
+		return fmt.Errorf("insert failed: %w", err)
+	}
+	return nil
+}
+
+// LinkTelegramChat погашает токен, привязывает чат к пользователю и добавляет чат в его контакты.
+// У пользователя остается один чат: прежние чаты отвязываются. Повторная привязка чата переносит его
+// к новому пользователю, из контактов прежнего владельца чат удаляется в той же транзакции.
+func (nr *NotificationRepository) LinkTelegramChat(ctx context.Context, token string, chatID int64, now time.Time) (string, error) {
+	consumeQuery := `DELETE FROM telegram_link_tokens WHERE token = $1 AND expires_at > $2 RETURNING user_id`
+	// Прежний владелец чата и прежние чаты пользователя
+	unlinkQuery := `DELETE FROM telegram_chats WHERE (chat_id = $1 AND user_id <> $2) OR (user_id = $2 AND chat_id <> $1)
+		RETURNING chat_id, user_id`
+	// Контакт удаляется, только если он все еще указывает на отвязанный чат
+	dropContactQuery := `UPDATE user_preferences SET contacts = contacts - 'telegram', updated_at = $3
+		WHERE user_id = $1 AND contacts->>'telegram' = $2`
+	linkQuery := `INSERT INTO telegram_chats (chat_id, user_id, linked_at) VALUES ($1, $2, $3)
+		ON CONFLICT (chat_id) DO UPDATE SET user_id = EXCLUDED.user_id, linked_at = EXCLUDED.linked_at`
+	// Остальные контакты и настройки профиля сохраняются
+	contactQuery := `INSERT INTO user_preferences (user_id, contacts, updated_at)
+		VALUES ($1, jsonb_build_object('telegram', $2::text), $3)
+		ON CONFLICT (user_id) DO UPDATE SET contacts = user_preferences.contacts || EXCLUDED.contacts,
+			updated_at = EXCLUDED.updated_at`
+
+	var userID string
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, consumeQuery, token, now).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return abortTx{models.ErrTelegramLinkInvalid}
+		}
+		if err != nil {
+			return err
+		}
+
+		unlinked, err := unlinkTelegramChats(ctx, tx, unlinkQuery, chatID, userID)
+		if err != nil {
+			return err
+		}
+		for _, chat := range unlinked {
+			// Контакт самого пользователя перезапишет contactQuery
+			if chat.userID == userID {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, dropContactQuery, chat.userID, strconv.FormatInt(chat.chatID, 10), now); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, linkQuery, chatID, userID, now); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, contactQuery, userID, strconv.FormatInt(chatID, 10), now)
+		return err
+	})
+
+	if err != nil {
+		if !errors.Is(err, models.ErrTelegramLinkInvalid) {
+			zlog.Logger.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to link telegram chat")
+		}
+		return "", err
+	}
+
+	zlog.Logger.Info().Int64("chat_id", chatID).Str("user_id", userID).Msg("Telegram chat linked")
+	return userID, nil
+}
+
+// telegramChat - строка telegram_chats, удаленная при перепривязке
+type telegramChat struct {
+	chatID int64
+	userID string
+}
+
+// unlinkTelegramChats удаляет в транзакции привязки, которые заменяет новая, и возвращает их.
+func unlinkTelegramChats(ctx context.Context, tx *sql.Tx, query string, chatID int64, userID string) ([]telegramChat, error) {
+	rows, err := tx.QueryContext(ctx, query, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []telegramChat
+	for rows.Next() {
+		var chat telegramChat
+		if err := rows.Scan(&chat.chatID, &chat.userID); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		res = append(res, chat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+// GetTelegramChatUser возвращает пользователя, к которому привязан чат.
+func (nr *NotificationRepository) GetTelegramChatUser(ctx context.Context, chatID int64) (string, error) {
+	getQuery := `SELECT user_id FROM telegram_chats WHERE chat_id = $1`
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, getQuery, chatID)
+	if err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", fmt.Errorf("rows error: %w", err)
+		}
+		return "", models.ErrTelegramChatNotLinked
+	}
+	var userID string
+	if err := rows.Scan(&userID); err != nil {
+		return "", fmt.Errorf("scan failed: %w", err)
+	}
+	return userID, nil
+}
+
+var _ service.TelegramRepository = (*NotificationRepository)(nil)
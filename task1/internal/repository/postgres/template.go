@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+const templateColumns = `id, version, name, channel, subject, body, parse_mode, created_at`
+
+// CreateTemplate сохраняет первую версию шаблона.
+func (nr *NotificationRepository) CreateTemplate(ctx context.Context, t *models.Template) error {
+	createQuery := `INSERT INTO notification_templates (` + templateColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, createQuery,
+		t.ID, t.Version, t.Name, t.Channel, t.Subject, t.Body, t.ParseMode, t.CreatedAt)
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", t.ID).Msg("Failed to create template")
+	} else {
+		zlog.Logger.Info().Str("template_id", t.ID).Msg("Template created in database")
+	}
+
+	return err
+}
+
+// CreateTemplateVersion сохраняет новую версию существующего шаблона,
+// номер версии вычисляется в той же транзакции и записывается в t.Version.
+func (nr *NotificationRepository) CreateTemplateVersion(ctx context.Context, t *models.Template) error {
+	// Конкурентная запись той же версии упрется в первичный ключ, и withTx повторит транзакцию
+	versionQuery := `SELECT version FROM notification_templates
+		WHERE id = $1 AND deleted_at IS NULL ORDER BY version DESC LIMIT 1 FOR UPDATE`
+	createQuery := `INSERT INTO notification_templates (` + templateColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	err := nr.withTx(ctx, func(tx *sql.Tx) error {
+		var latest int
+		err := tx.QueryRowContext(ctx, versionQuery, t.ID).Scan(&latest)
+		if errors.Is(err, sql.ErrNoRows) {
+			return abortTx{models.ErrTemplateNotFound}
+		}
+		if err != nil {
+			return err
+		}
+
+		t.Version = latest + 1
+		_, err = tx.ExecContext(ctx, createQuery,
+			t.ID, t.Version, t.Name, t.Channel, t.Subject, t.Body, t.ParseMode, t.CreatedAt)
+		return err
+	})
+
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", t.ID).Msg("Failed to create template version")
+	} else {
+		zlog.Logger.Info().Str("template_id", t.ID).Int("version", t.Version).Msg("Template version created")
+	}
+
+	return err
+}
+
+// GetTemplate возвращает указанную версию шаблона, при version = 0 - последнюю.
+// Удаленные шаблоны по конкретной версии остаются доступны, чтобы запланированные
+// уведомления могли быть отправлены.
+func (nr *NotificationRepository) GetTemplate(ctx context.Context, id string, version int) (*models.Template, error) {
+	var rows *sql.Rows
+	var err error
+	if version > 0 {
+		getQuery := `SELECT ` + templateColumns + ` FROM notification_templates WHERE id = $1 AND version = $2`
+		rows, err = nr.db.QueryWithRetry(ctx, models.StandartStrategy, getQuery, id, version)
+	} else {
+		getQuery := `SELECT ` + templateColumns + ` FROM notification_templates
+			WHERE id = $1 AND deleted_at IS NULL ORDER BY version DESC LIMIT 1`
+		rows, err = nr.db.QueryWithRetry(ctx, models.StandartStrategy, getQuery, id)
+	}
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Query failed for template")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+		return nil, models.ErrTemplateNotFound
+	}
+
+	t, err := scanTemplate(rows)
+	if err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	return t, nil
+}
+
+// ListTemplates возвращает последние версии всех неудаленных шаблонов.
+func (nr *NotificationRepository) ListTemplates(ctx context.Context) ([]*models.Template, error) {
+	listQuery := `SELECT DISTINCT ON (id) ` + templateColumns + ` FROM notification_templates
+		WHERE deleted_at IS NULL ORDER BY id, version DESC`
+	rows, err := nr.db.QueryWithRetry(ctx, models.StandartStrategy, listQuery)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Query failed for templates")
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var res []*models.Template
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		res = append(res, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+// DeleteTemplate помечает все версии шаблона удаленными.
+func (nr *NotificationRepository) DeleteTemplate(ctx context.Context, id string) error {
+	deleteQuery := `UPDATE notification_templates SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+	res, err := nr.db.ExecWithRetry(ctx, models.StandartStrategy, deleteQuery, time.Now(), id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to delete template")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return models.ErrTemplateNotFound
+	}
+
+	zlog.Logger.Info().Str("template_id", id).Msg("Template deleted")
+	return nil
+}
+
+func scanTemplate(rows *sql.Rows) (*models.Template, error) {
+	var t models.Template
+	err := rows.Scan(&t.ID, &t.Version, &t.Name, &t.Channel, &t.Subject, &t.Body, &t.ParseMode, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Implement TemplateRepository interface
+var _ service.TemplateRepository = (*NotificationRepository)(nil)
@@ -3,55 +3,148 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/service"
 	"github.com/pozedorum/wbf/redis"
+	"github.com/pozedorum/wbf/retry"
 	"github.com/pozedorum/wbf/zlog"
 )
 
+// setIfNewerScript записывает models.CacheEntry из ARGV[1] с ревизией ARGV[2] на ARGV[3] мс,
+// если в кэше нет надгробия или записи с большей ревизией. Значения в старом формате
+// (без ревизии) перезаписываются.
+const setIfNewerScript = `
+local current = redis.call('GET', KEYS[1])
+if current then
+	local ok, entry = pcall(cjson.decode, current)
+	if ok and type(entry) == 'table' then
+		if entry.deleted then
+			return 0
+		end
+		if (tonumber(entry.revision) or 0) > tonumber(ARGV[2]) then
+			return 0
+		end
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`
+
 // NotificationCache предоставляет реализацию кэширования уведомлений на базе Redis.
 type NotificationCache struct {
-	client *redis.Client
+	client       *redis.Client
+	ttl          time.Duration
+	tombstoneTTL time.Duration
 }
 
-func NewNotificationRepository(addr, password string, db int) *NotificationCache {
-	zlog.Logger.Info().Str("address", addr).Int("db", db).Msg("Creating Redis notification cache")
-	return &NotificationCache{client: redis.New(addr, password, db)}
+func NewNotificationRepository(addr, password string, db int, ttl, tombstoneTTL time.Duration) *NotificationCache {
+	zlog.Logger.Info().Str("address", addr).Int("db", db).Dur("ttl", ttl).Msg("Creating Redis notification cache")
+	return &NotificationCache{client: redis.New(addr, password, db), ttl: ttl, tombstoneTTL: tombstoneTTL}
 }
 
-func (ns *NotificationCache) Set(ctx context.Context, key string, value interface{}) error {
-	data, err := json.Marshal(value)
+// Set кэширует уведомление на ttl. Устаревшая ревизия и запись поверх надгробия
+// пропускаются без ошибки.
+func (ns *NotificationCache) Set(ctx context.Context, id string, n *models.Notification) error {
+	if n == nil {
+		return errors.New("cannot cache nil notification, use Tombstone")
+	}
+	data, err := json.Marshal(models.CacheEntry{Revision: n.Revision, Notification: n})
 	if err != nil {
-		zlog.Logger.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+		zlog.Logger.Error().Err(err).Str("key", id).Msg("Failed to marshal value for cache")
 		return err
 	}
 
-	err = ns.client.SetWithRetry(ctx, models.StandartStrategy, "notification-"+key, data)
+	var written int64
+	err = retry.Do(func() error {
+		res, err := ns.client.Eval(ctx, setIfNewerScript, []string{cacheKey(id)},
+			string(data), n.Revision, ns.ttl.Milliseconds()).Int64()
+		written = res
+		return err
+	}, models.StandartStrategy)
 	if err != nil {
-		zlog.Logger.Error().Err(err).Str("key", key).Msg("Failed to set value in cache")
+		zlog.Logger.Error().Err(err).Str("key", id).Msg("Failed to set value in cache")
+		return err
+	}
+
+	if written == 0 {
+		zlog.Logger.Debug().Str("key", id).Int64("revision", n.Revision).Msg("Stale value not cached")
 	} else {
-		zlog.Logger.Debug().Str("key", key).Msg("Value set in cache")
+		zlog.Logger.Debug().Str("key", id).Int64("revision", n.Revision).Msg("Value set in cache")
 	}
-	return err
+	return nil
 }
 
-func (ns *NotificationCache) Get(ctx context.Context, key string) (*models.Notification, error) {
-	data, err := ns.client.GetWithRetry(ctx, models.StandartStrategy, "notification-"+key)
+// Get возвращает уведомление из кэша, models.ErrCacheMiss, если записи нет,
+// и models.ErrNotFound, если уведомление удалено.
+func (ns *NotificationCache) Get(ctx context.Context, id string) (*models.Notification, error) {
+	var data string
+	var miss bool
+	err := retry.Do(func() error {
+		v, err := ns.client.Get(ctx, cacheKey(id))
+		if errors.Is(err, redis.NoMatches) {
+			miss = true
+			return nil
+		}
+		data = v
+		return err
+	}, models.StandartStrategy)
 	if err != nil {
-		zlog.Logger.Error().Err(err).Str("key", key).Msg("Failed to get value from cache")
+		zlog.Logger.Error().Err(err).Str("key", id).Msg("Failed to get value from cache")
 		return nil, err
 	}
+	if miss {
+		return nil, models.ErrCacheMiss
+	}
 
-	var n models.Notification
-	err = json.Unmarshal([]byte(data), &n)
-	if err != nil {
-		zlog.Logger.Error().Err(err).Str("key", key).Msg("Failed to unmarshal value from cache")
+	var entry models.CacheEntry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		zlog.Logger.Error().Err(err).Str("key", id).Msg("Failed to unmarshal value from cache")
 		return nil, err
 	}
+	if entry.Deleted {
+		return nil, models.ErrNotFound
+	}
+	// Значение в старом формате читается из PostgreSQL и перезаписывается
+	if entry.Notification == nil {
+		return nil, models.ErrCacheMiss
+	}
+
+	zlog.Logger.Debug().Str("key", id).Msg("Value retrieved from cache")
+	return entry.Notification, nil
+}
+
+// Tombstone заменяет запись уведомления надгробием на tombstoneTTL.
+func (ns *NotificationCache) Tombstone(ctx context.Context, id string) error {
+	data, err := json.Marshal(models.CacheEntry{Deleted: true})
+	if err != nil {
+		return err
+	}
 
-	zlog.Logger.Debug().Str("key", key).Msg("Value retrieved from cache")
-	return &n, nil
+	err = retry.Do(func() error {
+		return ns.client.Client.Set(ctx, cacheKey(id), data, ns.tombstoneTTL).Err()
+	}, models.StandartStrategy)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("key", id).Msg("Failed to set tombstone in cache")
+	} else {
+		zlog.Logger.Debug().Str("key", id).Msg("Tombstone set in cache")
+	}
+	return err
+}
+
+// Delete удаляет уведомление из кэша, следующее чтение пойдет в PostgreSQL.
+func (ns *NotificationCache) Delete(ctx context.Context, id string) error {
+	err := retry.Do(func() error {
+		return ns.client.Del(ctx, cacheKey(id)).Err()
+	}, models.StandartStrategy)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("key", id).Msg("Failed to delete value from cache")
+	} else {
+		zlog.Logger.Debug().Str("key", id).Msg("Value deleted from cache")
+	}
+	return err
 }
 
 func (ns *NotificationCache) Close() error {
@@ -69,4 +162,8 @@ func (ns *NotificationCache) Ping(ctx context.Context) (string, error) {
 	return result, err
 }
 
+func cacheKey(id string) string {
+	return "notification-" + id
+}
+
 var _ service.Cache = (*NotificationCache)(nil)
@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/redis"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// statusChannel - канал Redis pub/sub для событий о смене статусов
+const statusChannel = "notification:status"
+
+// StatusEvents рассылает события о смене статусов через Redis pub/sub, поэтому подписчик
+// на любой реплике API получает события, опубликованные воркерами и другими репликами.
+// Каждый Subscribe открывает отдельную подписку Redis.
+type StatusEvents struct {
+	client *redis.Client
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Events создает StatusEvents на подключении кэша. Подключение закрывает кэш.
+func (ns *NotificationCache) Events() *StatusEvents {
+	return &StatusEvents{client: ns.client, closed: make(chan struct{})}
+}
+
+func (e *StatusEvents) Publish(ctx context.Context, event models.StatusEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status event: %w", err)
+	}
+	if err := e.client.Publish(ctx, statusChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish status event: %w", err)
+	}
+	return nil
+}
+
+func (e *StatusEvents) Subscribe(ctx context.Context) (<-chan models.StatusEvent, error) {
+	pubsub := e.client.Subscribe(ctx, statusChannel)
+	// Дожидаемся подтверждения подписки, чтобы не пропустить события сразу после подключения
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to status events: %w", err)
+	}
+
+	events := make(chan models.StatusEvent)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event models.StatusEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					zlog.Logger.Warn().Err(err).Msg("Failed to decode status event")
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				case <-e.closed:
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-e.closed:
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Close завершает все подписки
+func (e *StatusEvents) Close() error {
+	e.closeOnce.Do(func() { close(e.closed) })
+	return nil
+}
+
+var _ service.StatusEvents = (*StatusEvents)(nil)
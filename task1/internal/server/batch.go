@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/ginext"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// CreateBatch принимает JSON с полем recipients или multipart/form-data, где file - CSV
+// с получателями, а payload - JSON с общими параметрами рассылки.
+func (ns *NotificationServer) CreateBatch(c *ginext.Context) {
+	var req models.CreateBatchRequest
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if err := bindBatchUpload(c, &req); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Failed to read batch upload")
+			c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to bind JSON for create batch")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Int("recipients", len(req.Recipients)).Time("send_at", req.SendAt).Msg("Creating batch")
+
+	batch, err := ns.service.CreateBatch(c.Request.Context(), &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int("recipients", len(req.Recipients)).Msg("Failed to create batch")
+		c.JSON(batchErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("batch_id", batch.ID).Int("total", batch.Total).Msg("Batch created successfully")
+	c.JSON(models.StatusAccepted, batch)
+}
+
+func (ns *NotificationServer) GetBatch(c *ginext.Context) {
+	id := c.Param("id")
+
+	batch, err := ns.service.GetBatch(c.Request.Context(), id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("batch_id", id).Msg("Failed to get batch")
+		c.JSON(batchErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(models.StatusOK, batch)
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidBatch):
+		return models.StatusBadRequest
+	case errors.Is(err, models.ErrBatchNotFound), errors.Is(err, models.ErrTemplateNotFound):
+		return models.StatusNotFound
+	}
+	return models.StatusInternalServerError
+}
+
+// bindBatchUpload заполняет запрос из полей payload и file формы
+func bindBatchUpload(c *ginext.Context, req *models.CreateBatchRequest) error {
+	if payload := c.PostForm("payload"); payload != "" {
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return fmt.Errorf("file is required: %w", err)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	recipients, err := parseRecipientsCSV(file)
+	if err != nil {
+		return err
+	}
+	req.Recipients = append(req.Recipients, recipients...)
+	return nil
+}
+
+// parseRecipientsCSV читает получателей из CSV с заголовком. Колонка user_id обязательна,
+// остальные колонки становятся переменными шаблона получателя.
+func parseRecipientsCSV(r io.Reader) ([]models.BatchRecipient, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+
+	userColumn := -1
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if header[i] == "user_id" {
+			userColumn = i
+		}
+	}
+	if userColumn < 0 {
+		return nil, fmt.Errorf("csv must have a user_id column")
+	}
+
+	var recipients []models.BatchRecipient
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+
+		recipient := models.BatchRecipient{UserID: strings.TrimSpace(record[userColumn])}
+		for i, value := range record {
+			if i == userColumn || header[i] == "" {
+				continue
+			}
+			if recipient.Variables == nil {
+				recipient.Variables = make(map[string]string)
+			}
+			recipient.Variables[header[i]] = value
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
@@ -1,20 +1,39 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/wbf/ginext"
 	"github.com/pozedorum/wbf/zlog"
 )
 
+// IdempotencyKeyHeader - заголовок, по которому повторный POST /notify возвращает исходное уведомление
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 func (ns *NotificationServer) CreateNotification(c *ginext.Context) {
 	var req models.CreateNotificationRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if err := bindNotificationUpload(c, &req); err != nil {
+			zlog.Logger.Error().Err(err).Msg("Failed to read notification upload")
+			c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
 		zlog.Logger.Error().Err(err).Msg("Failed to bind JSON for create notification")
 		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
 		return
 	}
 
+	req.IdempotencyKey = c.GetHeader(IdempotencyKeyHeader)
+
 	zlog.Logger.Info().
 		Str("user_id", req.UserID).
 		Str("channel", req.Channel).
@@ -31,13 +50,7 @@ func (ns *NotificationServer) CreateNotification(c *ginext.Context) {
 		return
 	}
 
-	resp := models.NotificationResponse{
-		ID:      n.ID,
-		Status:  n.Status,
-		SendAt:  n.SendAt,
-		Message: n.Message,
-		Channel: n.Channel,
-	}
+	resp := newNotificationResponse(n)
 
 	zlog.Logger.Info().
 		Str("notification_id", n.ID).
@@ -47,6 +60,60 @@ func (ns *NotificationServer) CreateNotification(c *ginext.Context) {
 	c.JSON(models.StatusAccepted, resp)
 }
 
+// uploadOverhead - запас на поле payload и заголовки частей multipart сверх размера вложений
+const uploadOverhead = 1 << 20
+
+// bindNotificationUpload заполняет запрос из поля payload формы и добавляет
+// загруженные файлы attachments как вложения. Тело запроса и суммарный размер файлов
+// ограничиваются до чтения, чтобы большая загрузка не попадала в память целиком.
+func bindNotificationUpload(c *ginext.Context, req *models.CreateNotificationRequest) error {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, models.MaxAttachmentsSize+uploadOverhead)
+
+	payload := c.PostForm("payload")
+	if payload == "" {
+		return fmt.Errorf("payload is required")
+	}
+	if err := json.Unmarshal([]byte(payload), req); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return fmt.Errorf("invalid form: %w", err)
+	}
+	files := form.File["attachments"]
+	if len(files) > models.MaxAttachments {
+		return fmt.Errorf("at most %d attachments are allowed", models.MaxAttachments)
+	}
+
+	var total int64
+	for _, header := range files {
+		if total+header.Size > models.MaxAttachmentsSize {
+			return fmt.Errorf("attachments must not exceed %d bytes", models.MaxAttachmentsSize)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open attachment %s: %w", header.Filename, err)
+		}
+		remaining := models.MaxAttachmentsSize - total
+		content, err := io.ReadAll(io.LimitReader(file, remaining+1))
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read attachment %s: %w", header.Filename, err)
+		}
+		if int64(len(content)) > remaining {
+			return fmt.Errorf("attachments must not exceed %d bytes", models.MaxAttachmentsSize)
+		}
+		total += int64(len(content))
+		req.Attachments = append(req.Attachments, models.Attachment{
+			Filename:    header.Filename,
+			ContentType: header.Header.Get("Content-Type"),
+			Content:     content,
+		})
+	}
+	return nil
+}
+
 func (ns *NotificationServer) GetNotificationStatus(c *ginext.Context) {
 	id := c.Param("id")
 
@@ -65,13 +132,7 @@ func (ns *NotificationServer) GetNotificationStatus(c *ginext.Context) {
 		return
 	}
 
-	resp := models.NotificationResponse{
-		ID:      n.ID,
-		Status:  n.Status,
-		SendAt:  n.SendAt,
-		Message: n.Message,
-		Channel: n.Channel,
-	}
+	resp := newNotificationResponse(n)
 
 	zlog.Logger.Info().
 		Str("notification_id", id).
@@ -81,6 +142,56 @@ func (ns *NotificationServer) GetNotificationStatus(c *ginext.Context) {
 	c.JSON(models.StatusOK, resp)
 }
 
+func (ns *NotificationServer) UpdateNotification(c *ginext.Context) {
+	id := c.Param("id")
+	var req models.UpdateNotificationRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to bind JSON for update notification")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("notification_id", id).Msg("Updating notification")
+
+	n, err := ns.service.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to update notification")
+		status := models.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			status = models.StatusNotFound
+		case errors.Is(err, models.ErrNotPending), errors.Is(err, models.ErrVersionConflict):
+			status = models.StatusConflict
+		}
+		c.JSON(status, ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("notification_id", id).Int("version", n.Version).Msg("Notification updated successfully")
+	c.JSON(models.StatusOK, newNotificationResponse(n))
+}
+
+func (ns *NotificationServer) ListNotificationAttempts(c *ginext.Context) {
+	id := c.Param("id")
+
+	attempts, err := ns.service.ListAttempts(c.Request.Context(), id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to list notification attempts")
+		status := models.StatusInternalServerError
+		if errors.Is(err, models.ErrNotFound) {
+			status = models.StatusNotFound
+		}
+		c.JSON(status, ginext.H{"error": err.Error()})
+		return
+	}
+
+	if attempts == nil {
+		attempts = []*models.Attempt{}
+	}
+	c.JSON(models.StatusOK, ginext.H{"attempts": attempts})
+}
+
 func (ns *NotificationServer) DeleteNotification(c *ginext.Context) {
 	id := c.Param("id")
 
@@ -96,10 +207,134 @@ func (ns *NotificationServer) DeleteNotification(c *ginext.Context) {
 	c.JSON(models.StatusOK, ginext.H{"status": "canceled"})
 }
 
+func (ns *NotificationServer) ListFailedNotifications(c *ginext.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	zlog.Logger.Info().Int("limit", limit).Msg("Listing failed notifications")
+
+	notifications, err := ns.service.ListFailed(c.Request.Context(), limit)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to list failed notifications")
+		c.JSON(models.StatusInternalServerError, ginext.H{"error": err.Error()})
+		return
+	}
+
+	if notifications == nil {
+		notifications = []*models.Notification{}
+	}
+	c.JSON(models.StatusOK, ginext.H{"notifications": notifications})
+}
+
+func (ns *NotificationServer) ListNotifications(c *ginext.Context) {
+	var req models.ListNotificationsRequest
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to bind query for list notifications")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	page, err := ns.service.List(c.Request.Context(), &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", req.UserID).Msg("Failed to list notifications")
+		status := models.StatusInternalServerError
+		if errors.Is(err, models.ErrBadFilter) {
+			status = models.StatusBadRequest
+		}
+		c.JSON(status, ginext.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(models.StatusOK, page)
+}
+
+func (ns *NotificationServer) ReplayNotification(c *ginext.Context) {
+	id := c.Param("id")
+
+	zlog.Logger.Info().Str("notification_id", id).Msg("Replaying notification")
+
+	n, err := ns.service.Replay(c.Request.Context(), id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to replay notification")
+		status := models.StatusInternalServerError
+		if errors.Is(err, models.ErrNotFailed) {
+			status = models.StatusConflict
+		}
+		c.JSON(status, ginext.H{"error": err.Error()})
+		return
+	}
+
+	resp := newNotificationResponse(n)
+
+	zlog.Logger.Info().Str("notification_id", id).Msg("Notification replayed")
+	c.JSON(models.StatusAccepted, resp)
+}
+
+func (ns *NotificationServer) ReplayAllFailedNotifications(c *ginext.Context) {
+	zlog.Logger.Info().Msg("Replaying all failed notifications")
+
+	replayed, err := ns.service.ReplayAllFailed(c.Request.Context())
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int("replayed", replayed).Msg("Failed to replay failed notifications")
+		c.JSON(models.StatusInternalServerError, ginext.H{"error": err.Error(), "replayed": replayed})
+		return
+	}
+
+	zlog.Logger.Info().Int("replayed", replayed).Msg("Failed notifications replayed")
+	c.JSON(models.StatusAccepted, ginext.H{"replayed": replayed})
+}
+
+// HealthCheck отвечает 503, пока воркер не читает очередь, чтобы балансировщик
+// не считал экземпляр готовым.
 func (ns *NotificationServer) HealthCheck(c *ginext.Context) {
 	zlog.Logger.Debug().Msg("Health check requested")
-	c.JSON(models.StatusOK, ginext.H{
+
+	resp := ginext.H{
 		"status":  "healthy",
 		"service": "notification-server",
-	})
+	}
+	if ns.worker == nil {
+		c.JSON(models.StatusOK, resp)
+		return
+	}
+
+	resp["worker"] = ns.worker.GetStatus()
+	if !ns.worker.Ready() {
+		resp["status"] = "unavailable"
+		c.JSON(models.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(models.StatusOK, resp)
+}
+
+func newNotificationResponse(n *models.Notification) models.NotificationResponse {
+	return models.NotificationResponse{
+		ID:       n.ID,
+		Status:   n.Status,
+		SendAt:   n.SendAt,
+		Message:  n.Message,
+		Subject:  n.Subject,
+		Channel:  n.Channel,
+		Channels: n.Channels,
+		SeriesID: n.SeriesID,
+		Version:  n.Version,
+
+		Attachments: attachmentsInfo(n.Attachments),
+		Attempts:    n.Attempts,
+		LastError:   n.LastError,
+	}
+}
+
+// attachmentsInfo убирает из вложений содержимое и ссылку на него, чтобы не возвращать их в ответах API
+func attachmentsInfo(attachments []models.Attachment) []models.Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	info := make([]models.Attachment, len(attachments))
+	for i, a := range attachments {
+		a.ID = ""
+		a.Content = nil
+		info[i] = a
+	}
+	return info
 }
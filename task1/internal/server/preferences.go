@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/ginext"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+func (ns *NotificationServer) GetPreferences(c *ginext.Context) {
+	userID := c.Param("id")
+
+	p, err := ns.preferences.Get(c.Request.Context(), userID)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to get user preferences")
+		c.JSON(preferencesErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(models.StatusOK, p)
+}
+
+func (ns *NotificationServer) SavePreferences(c *ginext.Context) {
+	userID := c.Param("id")
+	var req models.PreferencesRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to bind JSON for user preferences")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	p, err := ns.preferences.Save(c.Request.Context(), userID, &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to save user preferences")
+		c.JSON(preferencesErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("user_id", userID).Msg("User preferences saved successfully")
+	c.JSON(models.StatusOK, p)
+}
+
+func (ns *NotificationServer) DeletePreferences(c *ginext.Context) {
+	userID := c.Param("id")
+
+	if err := ns.preferences.Delete(c.Request.Context(), userID); err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to delete user preferences")
+		c.JSON(preferencesErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("user_id", userID).Msg("User preferences deleted successfully")
+	c.JSON(models.StatusOK, ginext.H{"status": "deleted"})
+}
+
+// CreateTelegramLink выдает одноразовый токен, который пользователь отправляет боту
+// командой /start, чтобы привязать свой чат Telegram.
+func (ns *NotificationServer) CreateTelegramLink(c *ginext.Context) {
+	userID := c.Param("id")
+
+	link, err := ns.telegram.CreateLink(c.Request.Context(), userID)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to create telegram link")
+		c.JSON(models.StatusInternalServerError, ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("user_id", userID).Time("expires_at", link.ExpiresAt).Msg("Telegram link created")
+	c.JSON(models.StatusCreated, link)
+}
+
+func preferencesErrorStatus(err error) int {
+	if errors.Is(err, models.ErrPreferencesNotFound) {
+		return models.StatusNotFound
+	}
+	return models.StatusInternalServerError
+}
@@ -1,19 +1,45 @@
 package server
 
 import (
+	"sync"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/metrics"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/service"
 	"github.com/pozedorum/wbf/ginext"
 	"github.com/pozedorum/wbf/zlog"
 )
 
+// WorkerStatus - состояние воркера, которое health check использует как признак готовности.
+type WorkerStatus interface {
+	Ready() bool
+	GetStatus() map[string]interface{}
+}
+
 type NotificationServer struct {
-	service service.NotificationService
+	service     service.NotificationService
+	templates   service.TemplateService
+	preferences service.PreferencesService
+	telegram    service.TelegramService
+	worker      WorkerStatus
+
+	// streamsDone закрывается при остановке сервера и завершает потоки статусов
+	streamsDone  chan struct{}
+	closeStreams sync.Once
 }
 
-func New(service service.NotificationService) *NotificationServer {
+// New создает сервер. worker может быть nil, если воркер запущен в другом процессе.
+func New(service service.NotificationService, templates service.TemplateService, preferences service.PreferencesService,
+	telegram service.TelegramService, worker WorkerStatus) *NotificationServer {
 	zlog.Logger.Info().Msg("Creating notification server")
-	return &NotificationServer{service: service}
+	return &NotificationServer{
+		service:     service,
+		templates:   templates,
+		preferences: preferences,
+		telegram:    telegram,
+		worker:      worker,
+		streamsDone: make(chan struct{}),
+	}
 }
 
 func (ns *NotificationServer) SetupRoutes(router *ginext.RouterGroup) {
@@ -25,10 +51,48 @@ func (ns *NotificationServer) SetupRoutes(router *ginext.RouterGroup) {
 	notifyGroup := router.Group("/notify")
 	{
 		notifyGroup.POST("", ns.CreateNotification)
+		notifyGroup.GET("", ns.ListNotifications)
+		notifyGroup.GET("/stream", ns.StreamNotificationStatus)
+		notifyGroup.GET("/failed", ns.ListFailedNotifications)
+		notifyGroup.POST("/failed/replay", ns.ReplayAllFailedNotifications)
+		notifyGroup.POST("/batch", ns.CreateBatch)
+		notifyGroup.GET("/batch/:id", ns.GetBatch)
 		notifyGroup.GET("/:id", ns.GetNotificationStatus)
+		notifyGroup.GET("/:id/attempts", ns.ListNotificationAttempts)
+		notifyGroup.PATCH("/:id", ns.UpdateNotification)
 		notifyGroup.DELETE("/:id", ns.DeleteNotification)
+		notifyGroup.POST("/:id/replay", ns.ReplayNotification)
+	}
+
+	templateGroup := router.Group("/templates")
+	{
+		templateGroup.POST("", ns.CreateTemplate)
+		templateGroup.GET("", ns.ListTemplates)
+		templateGroup.GET("/:id", ns.GetTemplate)
+		templateGroup.PUT("/:id", ns.UpdateTemplate)
+		templateGroup.DELETE("/:id", ns.DeleteTemplate)
+		templateGroup.POST("/:id/preview", ns.PreviewTemplate)
 	}
-	router.GET("/health", ns.HealthCheck)
+
+	userGroup := router.Group("/users")
+	{
+		userGroup.GET("/:id/preferences", ns.GetPreferences)
+		userGroup.PUT("/:id/preferences", ns.SavePreferences)
+		userGroup.DELETE("/:id/preferences", ns.DeletePreferences)
+		userGroup.POST("/:id/telegram/link", ns.CreateTelegramLink)
+	}
+	ns.SetupProbeRoutes(router)
 
 	zlog.Logger.Info().Msg("Notification server routes configured")
 }
+
+// SetupProbeRoutes регистрирует только /health и /metrics: процесс в роли worker
+// не обслуживает API, но должен отвечать на проверки готовности и отдавать метрики.
+func (ns *NotificationServer) SetupProbeRoutes(router *ginext.RouterGroup) {
+	router.GET("/health", ns.HealthCheck)
+
+	metricsHandler := metrics.Handler()
+	router.GET("/metrics", func(c *ginext.Context) {
+		metricsHandler.ServeHTTP(c.Writer, c.Request)
+	})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/ginext"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// streamHeartbeat - период комментариев, которые не дают прокси закрыть простаивающий поток
+const streamHeartbeat = 15 * time.Second
+
+// StreamNotificationStatus отдает смены статусов уведомлений как Server-Sent Events
+// с типом status. Поток открыт, пока клиент не отключится или сервер не начнет остановку.
+func (ns *NotificationServer) StreamNotificationStatus(c *ginext.Context) {
+	var req models.StatusStreamRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to bind query for status stream")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	events, err := ns.service.StreamStatus(c.Request.Context(), &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", req.UserID).Msg("Failed to open status stream")
+		status := models.StatusInternalServerError
+		if errors.Is(err, models.ErrStreamUnavailable) {
+			status = models.StatusServiceUnavailable
+		}
+		c.JSON(status, ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("user_id", req.UserID).Strs("ids", req.IDs).Msg("Status stream opened")
+	defer zlog.Logger.Info().Str("user_id", req.UserID).Msg("Status stream closed")
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Отключает буферизацию ответа в nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(models.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			c.SSEvent("status", event)
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-ns.streamsDone:
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// CloseStreams завершает открытые потоки статусов. http.Server.Shutdown не прерывает
+// активные запросы, поэтому его нужно вызвать при остановке, иначе она дождется таймаута.
+func (ns *NotificationServer) CloseStreams() {
+	ns.closeStreams.Do(func() { close(ns.streamsDone) })
+}
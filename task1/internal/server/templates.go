@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/ginext"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+func (ns *NotificationServer) CreateTemplate(c *ginext.Context) {
+	var req models.TemplateRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to bind JSON for create template")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	t, err := ns.templates.Create(c.Request.Context(), &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("name", req.Name).Msg("Failed to create template")
+		c.JSON(models.StatusInternalServerError, ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("template_id", t.ID).Msg("Template created successfully")
+	c.JSON(models.StatusCreated, t)
+}
+
+func (ns *NotificationServer) UpdateTemplate(c *ginext.Context) {
+	id := c.Param("id")
+	var req models.TemplateRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to bind JSON for update template")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	t, err := ns.templates.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to update template")
+		c.JSON(templateErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("template_id", id).Int("version", t.Version).Msg("Template updated successfully")
+	c.JSON(models.StatusOK, t)
+}
+
+func (ns *NotificationServer) GetTemplate(c *ginext.Context) {
+	id := c.Param("id")
+	version, _ := strconv.Atoi(c.Query("version"))
+
+	t, err := ns.templates.Get(c.Request.Context(), id, version)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to get template")
+		c.JSON(templateErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(models.StatusOK, t)
+}
+
+func (ns *NotificationServer) ListTemplates(c *ginext.Context) {
+	templates, err := ns.templates.List(c.Request.Context())
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to list templates")
+		c.JSON(models.StatusInternalServerError, ginext.H{"error": err.Error()})
+		return
+	}
+
+	if templates == nil {
+		templates = []*models.Template{}
+	}
+	c.JSON(models.StatusOK, ginext.H{"templates": templates})
+}
+
+func (ns *NotificationServer) DeleteTemplate(c *ginext.Context) {
+	id := c.Param("id")
+
+	if err := ns.templates.Delete(c.Request.Context(), id); err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to delete template")
+		c.JSON(templateErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	zlog.Logger.Info().Str("template_id", id).Msg("Template deleted successfully")
+	c.JSON(models.StatusOK, ginext.H{"status": "deleted"})
+}
+
+func (ns *NotificationServer) PreviewTemplate(c *ginext.Context) {
+	id := c.Param("id")
+	var req models.PreviewTemplateRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to bind JSON for template preview")
+		c.JSON(models.StatusBadRequest, ginext.H{"error": err.Error()})
+		return
+	}
+
+	rendered, err := ns.templates.Preview(c.Request.Context(), id, &req)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("template_id", id).Msg("Failed to preview template")
+		c.JSON(templateErrorStatus(err), ginext.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(models.StatusOK, rendered)
+}
+
+func templateErrorStatus(err error) int {
+	if errors.Is(err, models.ErrTemplateNotFound) {
+		return models.StatusNotFound
+	}
+	return models.StatusInternalServerError
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// ListAttempts возвращает историю попыток отправки уведомления.
+func (s *notificationService) ListAttempts(ctx context.Context, id string) ([]*models.Attempt, error) {
+	n, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, models.ErrNotFound
+	}
+
+	attempts, err := s.repo.ListAttempts(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// recordAttempt сохраняет результат попытки отправки и отражает его в n.
+// Ошибка записи не влияет на результат отправки и только логируется.
+// RateLimitError попыткой не считается: воркер повторяет ту же попытку после паузы.
+func (s *notificationService) recordAttempt(ctx context.Context, n *models.Notification, started time.Time, sendErr error) {
+	var limited *models.RateLimitError
+	if errors.As(sendErr, &limited) {
+		return
+	}
+
+	attempt := &models.Attempt{
+		NotificationID: n.ID,
+		Channel:        n.Channel,
+		StartedAt:      started,
+		DurationMS:     time.Since(started).Milliseconds(),
+	}
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+
+	if err := s.repo.RecordAttempt(ctx, attempt); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", n.ID).Msg("Failed to record send attempt")
+		return
+	}
+
+	n.Attempts++
+	if sendErr != nil {
+		n.LastError = attempt.Error
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_ProcessNotification_RecordsFailedAttempt(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	n := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending, Attempts: 1}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", n).Return(nil)
+	repo.On("ReleaseNotification", mock.Anything, "id-1").Return(nil, nil)
+	notifier.On("Send", mock.Anything).Return(errors.New("smtp down"))
+	repo.
+		On("RecordAttempt", mock.Anything, mock.MatchedBy(func(a *models.Attempt) bool {
+			return a.NotificationID == "id-1" &&
+				a.Channel == "email" &&
+				!a.StartedAt.IsZero() &&
+				a.Error == "failed to send notification: smtp down"
+		})).
+		Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.Error(t, err)
+	repo.AssertExpectations(t)
+	assert.Equal(t, 2, n.Attempts)
+	assert.Equal(t, "failed to send notification: smtp down", n.LastError)
+}
+
+func TestNotificationService_ProcessNotification_RateLimitIsNotAttempt(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	n := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending, Attempts: 1}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", n).Return(nil)
+	repo.On("ReleaseNotification", mock.Anything, "id-1").Return(nil, nil)
+	notifier.On("Send", mock.Anything).Return(&models.RateLimitError{RetryAfter: time.Second, Err: errors.New("429")})
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	var limited *models.RateLimitError
+	require.ErrorAs(t, err, &limited)
+	repo.AssertNotCalled(t, "RecordAttempt", mock.Anything, mock.Anything)
+	assert.Equal(t, 1, n.Attempts)
+	assert.Empty(t, n.LastError)
+}
+
+func TestNotificationService_ListAttempts(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+
+	attempts := []*models.Attempt{
+		{ID: 1, NotificationID: "id-1", Channel: "email", Error: "smtp down"},
+		{ID: 2, NotificationID: "id-1", Channel: "telegram"},
+	}
+	cache.On("Get", mock.Anything, "id-1").Return(&models.Notification{ID: "id-1"}, nil)
+	repo.On("ListAttempts", mock.Anything, "id-1").Return(attempts, nil)
+
+	service := NewNotificationService(repo, cache, new(testsutils.MockQueue), nil, nil)
+
+	got, err := service.ListAttempts(context.Background(), "id-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, attempts, got)
+}
+
+func TestNotificationService_ListAttempts_NotFound(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+
+	cache.On("Get", mock.Anything, "id-1").Return(nil, models.ErrCacheMiss)
+	repo.On("GetByID", mock.Anything, "id-1").Return(nil, nil)
+
+	service := NewNotificationService(repo, cache, new(testsutils.MockQueue), nil, nil)
+
+	_, err := service.ListAttempts(context.Background(), "id-1")
+
+	require.ErrorIs(t, err, models.ErrNotFound)
+	repo.AssertNotCalled(t, "ListAttempts", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pozedorum/WB_project_3/task1/internal/metrics"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// maxBatchSize - максимальное число получателей одной рассылки
+const maxBatchSize = 10000
+
+// CreateBatch создает по уведомлению на каждого получателя с общим текстом или шаблоном.
+// Адреса получателей не проверяются заранее: профили тысяч пользователей загружались бы
+// по одному, ошибки адресов проявятся при отправке и попадут в статистику рассылки.
+func (s *notificationService) CreateBatch(ctx context.Context, req *models.CreateBatchRequest) (*models.Batch, error) {
+	if len(req.Recipients) == 0 {
+		return nil, fmt.Errorf("%w: recipients are required", models.ErrInvalidBatch)
+	}
+	if len(req.Recipients) > maxBatchSize {
+		return nil, fmt.Errorf("%w: at most %d recipients allowed", models.ErrInvalidBatch, maxBatchSize)
+	}
+
+	// Общие параметры проверяются так же, как у одиночного уведомления
+	shared := &models.CreateNotificationRequest{
+		UserID:          req.Recipients[0].UserID,
+		Message:         req.Message,
+		Channel:         req.Channel,
+		Channels:        req.Channels,
+		SendAt:          req.SendAt,
+		TemplateID:      req.TemplateID,
+		TemplateVersion: req.TemplateVersion,
+	}
+	if err := s.validateRequest(shared); err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidBatch, err)
+	}
+	for _, channel := range channelChain(shared) {
+		if _, exists := s.notifiers[channel]; !exists {
+			return nil, fmt.Errorf("%w: unsupported channel: %s", models.ErrInvalidBatch, channel)
+		}
+	}
+
+	var tpl *models.Template
+	if req.TemplateID != "" {
+		var err error
+		if tpl, err = s.repo.GetTemplate(ctx, req.TemplateID, req.TemplateVersion); err != nil {
+			return nil, fmt.Errorf("failed to get template: %w", err)
+		}
+		if tpl.Channel != shared.Channel {
+			return nil, fmt.Errorf("%w: template channel %s does not match notification channel %s",
+				models.ErrInvalidBatch, tpl.Channel, shared.Channel)
+		}
+	}
+
+	now := time.Now()
+	batch := &models.Batch{
+		ID:        uuid.New().String(),
+		Total:     len(req.Recipients),
+		CreatedAt: now,
+	}
+
+	notifications := make([]*models.Notification, 0, len(req.Recipients))
+	seen := make(map[string]bool, len(req.Recipients))
+	for i, recipient := range req.Recipients {
+		if recipient.UserID == "" {
+			return nil, fmt.Errorf("%w: recipients[%d]: user_id is required", models.ErrInvalidBatch, i)
+		}
+		if seen[recipient.UserID] {
+			return nil, fmt.Errorf("%w: duplicate recipient: %s", models.ErrInvalidBatch, recipient.UserID)
+		}
+		seen[recipient.UserID] = true
+
+		n := &models.Notification{
+			ID:        uuid.New().String(),
+			UserID:    recipient.UserID,
+			Message:   req.Message,
+			Channel:   shared.Channel,
+			Channels:  req.Channels,
+			SendAt:    req.SendAt,
+			Status:    models.StatusPending,
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+			BatchID:   batch.ID,
+		}
+		if tpl != nil {
+			n.TemplateID = tpl.ID
+			n.TemplateVersion = tpl.Version
+			n.Variables = mergeVariables(req.Variables, recipient.Variables)
+			if _, err := renderTemplate(tpl, n.Variables); err != nil {
+				return nil, fmt.Errorf("%w: recipient %s: %v", models.ErrInvalidBatch, recipient.UserID, err)
+			}
+		}
+		notifications = append(notifications, n)
+	}
+
+	// Уведомления рассылки не кэшируются заранее, GetByID загрузит их из базы по запросу
+	if err := s.repo.CreateBatch(ctx, batch, notifications); err != nil {
+		return nil, fmt.Errorf("failed to create batch: %w", err)
+	}
+	metrics.NotificationsCreated.WithLabelValues(shared.Channel).Add(float64(batch.Total))
+
+	batch.Counts = map[string]int{models.StatusPending: batch.Total}
+
+	zlog.Logger.Info().Str("batch_id", batch.ID).Int("total", batch.Total).Msg("Batch created")
+	return batch, nil
+}
+
+// GetBatch возвращает рассылку с текущим числом уведомлений по статусам.
+func (s *notificationService) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	batch, err := s.repo.GetBatch(ctx, id)
+	if errors.Is(err, models.ErrBatchNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+	return batch, nil
+}
+
+// mergeVariables объединяет общие переменные рассылки с переменными получателя,
+// значения получателя имеют приоритет.
+func mergeVariables(shared, own map[string]string) map[string]string {
+	if len(shared) == 0 && len(own) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(shared)+len(own))
+	for k, v := range shared {
+		merged[k] = v
+	}
+	for k, v := range own {
+		merged[k] = v
+	}
+	return merged
+}
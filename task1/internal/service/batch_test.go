@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_CreateBatch(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	repo.On("GetTemplate", mock.Anything, "tpl-1", 0).Return(&models.Template{
+		ID:      "tpl-1",
+		Version: 3,
+		Channel: "email",
+		Body:    "{{.greeting}}, {{.name}}",
+	}, nil)
+	repo.
+		On("CreateBatch", mock.Anything, mock.AnythingOfType("*models.Batch"), mock.MatchedBy(func(ns []*models.Notification) bool {
+			return len(ns) == 2 &&
+				ns[0].UserID == "user-1" && ns[0].BatchID != "" && ns[0].TemplateVersion == 3 &&
+				ns[0].Variables["greeting"] == "Hi" && ns[0].Variables["name"] == "Ann" &&
+				ns[1].Variables["greeting"] == "Hello" && ns[1].BatchID == ns[0].BatchID
+		})).
+		Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	batch, err := service.CreateBatch(context.Background(), &models.CreateBatchRequest{
+		Recipients: []models.BatchRecipient{
+			{UserID: "user-1", Variables: map[string]string{"name": "Ann"}},
+			{UserID: "user-2", Variables: map[string]string{"name": "Bob", "greeting": "Hello"}},
+		},
+		Channel:    "email",
+		SendAt:     time.Now().Add(time.Hour),
+		TemplateID: "tpl-1",
+		Variables:  map[string]string{"greeting": "Hi"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, batch.Total)
+	assert.Equal(t, map[string]int{models.StatusPending: 2}, batch.Counts)
+	repo.AssertExpectations(t)
+	// Уведомления рассылки не кэшируются при создании
+	cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_CreateBatch_Validation(t *testing.T) {
+	sendAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		req         *models.CreateBatchRequest
+		errContains string
+	}{
+		{
+			name:        "no recipients",
+			req:         &models.CreateBatchRequest{Message: "hi", Channel: "email", SendAt: sendAt},
+			errContains: "recipients are required",
+		},
+		{
+			name: "duplicate recipient",
+			req: &models.CreateBatchRequest{
+				Recipients: []models.BatchRecipient{{UserID: "user-1"}, {UserID: "user-1"}},
+				Message:    "hi",
+				Channel:    "email",
+				SendAt:     sendAt,
+			},
+			errContains: "duplicate recipient",
+		},
+		{
+			name: "empty user id",
+			req: &models.CreateBatchRequest{
+				Recipients: []models.BatchRecipient{{UserID: "user-1"}, {UserID: ""}},
+				Message:    "hi",
+				Channel:    "email",
+				SendAt:     sendAt,
+			},
+			errContains: "recipients[1]: user_id is required",
+		},
+		{
+			name: "unsupported channel",
+			req: &models.CreateBatchRequest{
+				Recipients: []models.BatchRecipient{{UserID: "user-1"}},
+				Message:    "hi",
+				Channel:    "sms",
+				SendAt:     sendAt,
+			},
+			errContains: "unsupported channel",
+		},
+		{
+			name: "send_at in the past",
+			req: &models.CreateBatchRequest{
+				Recipients: []models.BatchRecipient{{UserID: "user-1"}},
+				Message:    "hi",
+				Channel:    "email",
+				SendAt:     time.Now(),
+			},
+			errContains: "send_at must be at least 1 minute in the future",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			notifier := &testsutils.MockNotifier{Channel: "email"}
+			service := NewNotificationService(repo, new(testsutils.MockCache), new(testsutils.MockQueue), []Notifier{notifier}, nil)
+
+			_, err := service.CreateBatch(context.Background(), tt.req)
+
+			require.ErrorIs(t, err, models.ErrInvalidBatch)
+			assert.Contains(t, err.Error(), tt.errContains)
+			repo.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestNotificationService_GetBatch_NotFound(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	repo.On("GetBatch", mock.Anything, "batch-1").Return(nil, models.ErrBatchNotFound)
+
+	service := NewNotificationService(repo, new(testsutils.MockCache), new(testsutils.MockQueue), nil, nil)
+
+	_, err := service.GetBatch(context.Background(), "batch-1")
+
+	require.ErrorIs(t, err, models.ErrBatchNotFound)
+}
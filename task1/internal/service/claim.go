@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/metrics"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// sendLease - время, на которое воркер захватывает уведомление для отправки.
+// Должно с запасом превышать таймауты нотификаторов.
+const sendLease = 2 * time.Minute
+
+// stuckSendError - ошибка, с которой помечаются уведомления с истекшей арендой
+const stuckSendError = "send lease expired, delivery state unknown"
+
+// deliver подготавливает текст захваченного уведомления и отправляет его
+func (s *notificationService) deliver(ctx context.Context, claimed *models.Notification, prefs *models.UserPreferences) error {
+	outgoing, err := s.render(ctx, claimed)
+	if err != nil {
+		return err
+	}
+	if outgoing, err = s.withAttachmentContents(ctx, outgoing); err != nil {
+		return err
+	}
+	if err := s.send(outgoing, prefs); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// withAttachmentContents возвращает копию уведомления с содержимым вложений, которые репозиторий
+// хранит отдельно. Для каналов без вложений содержимое не читается.
+func (s *notificationService) withAttachmentContents(ctx context.Context, n *models.Notification) (*models.Notification, error) {
+	sender, ok := s.notifiers[n.Channel].(AttachmentSender)
+	if !ok || !sender.SendsAttachments() || !hasStoredAttachments(n.Attachments) {
+		return n, nil
+	}
+
+	contents, err := s.repo.GetAttachmentContents(ctx, n.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	attachments := make([]models.Attachment, len(n.Attachments))
+	for i, a := range n.Attachments {
+		if a.ID != "" && len(a.Content) == 0 {
+			content, ok := contents[a.ID]
+			if !ok {
+				return nil, fmt.Errorf("content of attachment %s not found", a.Filename)
+			}
+			a.Content = content
+		}
+		attachments[i] = a
+	}
+	withContents := *n
+	withContents.Attachments = attachments
+	return &withContents, nil
+}
+
+// hasStoredAttachments сообщает, есть ли среди вложений ссылки на сохраненное содержимое
+func hasStoredAttachments(attachments []models.Attachment) bool {
+	for _, a := range attachments {
+		if a.ID != "" && len(a.Content) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// observeSend учитывает в метриках длительность попытки отправки, а после успешной -
+// доставку и отставание от запланированного времени. Ограничение частоты провайдером
+// учитывается отдельно от ошибок, с результатом rate_limited
+func observeSend(n *models.Notification, started time.Time, sendErr error) {
+	result := metrics.ResultSuccess
+	var limited *models.RateLimitError
+	switch {
+	case errors.As(sendErr, &limited):
+		result = metrics.ResultRateLimited
+	case sendErr != nil:
+		result = metrics.ResultError
+	}
+	metrics.SendDuration.WithLabelValues(n.Channel, result).Observe(time.Since(started).Seconds())
+	if sendErr != nil {
+		return
+	}
+	metrics.NotificationsSent.WithLabelValues(n.Channel).Inc()
+	metrics.QueueLag.WithLabelValues(n.Channel).Observe(time.Since(n.SendAt).Seconds())
+}
+
+// release возвращает уведомление в pending после неудачной попытки, чтобы воркер
+// мог повторить отправку. Если вернуть не удалось, уведомление подберет RecoverStuck.
+func (s *notificationService) release(ctx context.Context, id string) {
+	released, err := s.repo.ReleaseNotification(ctx, id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to release notification claim")
+		return
+	}
+	if released == nil {
+		return
+	}
+	if err := s.cache.Set(ctx, id, released); err != nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to update cache after release")
+	}
+	s.publishStatus(ctx, released)
+}
+
+// RecoverStuck помечает failed уведомления, воркер которых не завершил отправку до истечения
+// аренды, и отправляет их в очередь недоставленных. Повторно такие уведомления не отправляются:
+// доставка могла состояться, решение о replay остается за оператором.
+func (s *notificationService) RecoverStuck(ctx context.Context) (int, error) {
+	next, scheduled := continueSeries()
+	stuck, err := s.repo.RecoverStuckNotifications(ctx, stuckSendError, next)
+	if err != nil {
+		return 0, fmt.Errorf("failed to recover stuck notifications: %w", err)
+	}
+
+	for _, n := range stuck {
+		metrics.NotificationsFailed.WithLabelValues(n.Channel).Inc()
+		s.publishDeadLetter(ctx, n, n.Attempts, stuckSendError)
+		occurrenceScheduled(n, scheduled[n.ID])
+		if err := s.cache.Set(ctx, n.ID, n); err != nil {
+			zlog.Logger.Warn().Err(err).Str("notification_id", n.ID).Msg("Failed to update cache after recovery")
+		}
+		s.publishStatus(ctx, n)
+	}
+
+	return len(stuck), nil
+}
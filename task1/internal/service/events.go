@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// publishStatus сообщает подписчикам потока о текущем статусе уведомления. Ошибка только
+// логируется: поток служит для обновления интерфейса, состояние хранится в репозитории.
+func (s *notificationService) publishStatus(ctx context.Context, n *models.Notification) {
+	s.publish(ctx, models.StatusEvent{
+		NotificationID: n.ID,
+		UserID:         n.UserID,
+		Status:         n.Status,
+		Channel:        n.Channel,
+		Revision:       n.Revision,
+		LastError:      n.LastError,
+		At:             time.Now(),
+	})
+}
+
+// publishCanceled сообщает об отмене удаленного уведомления
+func (s *notificationService) publishCanceled(ctx context.Context, id, userID string) {
+	s.publish(ctx, models.StatusEvent{
+		NotificationID: id,
+		UserID:         userID,
+		Status:         models.StatusCanceled,
+		At:             time.Now(),
+	})
+}
+
+func (s *notificationService) publish(ctx context.Context, event models.StatusEvent) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.Publish(ctx, event); err != nil {
+		zlog.Logger.Warn().Err(err).
+			Str("notification_id", event.NotificationID).
+			Str("status", event.Status).
+			Msg("Failed to publish status event")
+	}
+}
+
+// StreamStatus подписывает на смены статусов уведомлений пользователя req.UserID
+// и уведомлений из req.IDs. Канал закрывается при отмене ctx.
+func (s *notificationService) StreamStatus(ctx context.Context, req *models.StatusStreamRequest) (<-chan models.StatusEvent, error) {
+	if s.events == nil {
+		return nil, models.ErrStreamUnavailable
+	}
+
+	ids := make(map[string]struct{})
+	for _, value := range req.IDs {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+
+	events, err := s.events.Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make(chan models.StatusEvent)
+	go func() {
+		defer close(filtered)
+		for event := range events {
+			if !matchStatusEvent(event, req.UserID, ids) {
+				continue
+			}
+			select {
+			case filtered <- event:
+			case <-ctx.Done():
+				// Дочитываем канал подписки, чтобы он закрылся без блокировок
+				for range events {
+				}
+				return
+			}
+		}
+	}()
+	return filtered, nil
+}
+
+// matchStatusEvent проверяет событие по фильтрам потока. Если заданы оба фильтра,
+// достаточно совпадения с любым из них.
+func matchStatusEvent(event models.StatusEvent, userID string, ids map[string]struct{}) bool {
+	if userID == "" && len(ids) == 0 {
+		return true
+	}
+	if userID != "" && event.UserID == userID {
+		return true
+	}
+	_, ok := ids[event.NotificationID]
+	return ok
+}
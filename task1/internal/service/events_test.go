@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_ProcessNotification_PublishesStatusEvents(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	events := new(testsutils.MockStatusEvents)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	n := &models.Notification{ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusPending, Revision: 1}
+	claimed := &models.Notification{ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusSending, Revision: 2}
+	sent := &models.Notification{ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusSent, Revision: 3}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("GetPreferences", mock.Anything, "user-1").Return(nil, models.ErrPreferencesNotFound)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(claimed, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.Anything).Return(nil)
+	repo.On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).Return(sent, nil)
+	cache.On("Set", mock.Anything, "id-1", mock.Anything).Return(nil)
+	notifier.On("Send", mock.Anything).Return(nil)
+
+	var published []models.StatusEvent
+	events.On("Publish", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { published = append(published, args.Get(1).(models.StatusEvent)) }).
+		Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, events)
+
+	require.NoError(t, service.ProcessNotification(context.Background(), n))
+
+	require.Len(t, published, 2)
+	assert.Equal(t, models.StatusSending, published[0].Status)
+	assert.Equal(t, models.StatusSent, published[1].Status)
+	assert.Equal(t, "user-1", published[1].UserID)
+	assert.Equal(t, int64(3), published[1].Revision)
+}
+
+func TestNotificationService_Delete_PublishesCanceled(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	events := new(testsutils.MockStatusEvents)
+
+	n := &models.Notification{ID: "id-1", UserID: "user-1", Status: models.StatusPending}
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("DeleteNotification", mock.Anything, "id-1").Return(nil)
+	cache.On("Tombstone", mock.Anything, "id-1").Return(nil)
+	events.On("Publish", mock.Anything, mock.MatchedBy(func(e models.StatusEvent) bool {
+		return e.NotificationID == "id-1" && e.UserID == "user-1" && e.Status == models.StatusCanceled
+	})).Return(nil)
+
+	service := NewNotificationService(repo, cache, new(testsutils.MockQueue), nil, events)
+
+	require.NoError(t, service.Delete(context.Background(), "id-1"))
+	events.AssertExpectations(t)
+}
+
+func TestNotificationService_StreamStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *models.StatusStreamRequest
+		want []string
+	}{
+		{
+			name: "no filter",
+			req:  &models.StatusStreamRequest{},
+			want: []string{"id-1", "id-2", "id-3"},
+		},
+		{
+			name: "by user",
+			req:  &models.StatusStreamRequest{UserID: "user-1"},
+			want: []string{"id-1", "id-2"},
+		},
+		{
+			name: "by ids, comma separated",
+			req:  &models.StatusStreamRequest{IDs: []string{"id-1, id-3"}},
+			want: []string{"id-1", "id-3"},
+		},
+		{
+			name: "user or id",
+			req:  &models.StatusStreamRequest{UserID: "user-2", IDs: []string{"id-2"}},
+			want: []string{"id-2", "id-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := new(testsutils.MockStatusEvents)
+			source := make(chan models.StatusEvent, 3)
+			source <- models.StatusEvent{NotificationID: "id-1", UserID: "user-1", Status: models.StatusSent}
+			source <- models.StatusEvent{NotificationID: "id-2", UserID: "user-1", Status: models.StatusFailed}
+			source <- models.StatusEvent{NotificationID: "id-3", UserID: "user-2", Status: models.StatusCanceled}
+			close(source)
+			events.On("Subscribe", mock.Anything).Return((<-chan models.StatusEvent)(source), nil)
+
+			service := NewNotificationService(new(testsutils.MockRepository), new(testsutils.MockCache), new(testsutils.MockQueue), nil, events)
+
+			stream, err := service.StreamStatus(context.Background(), tt.req)
+			require.NoError(t, err)
+
+			var got []string
+			for event := range stream {
+				got = append(got, event.NotificationID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNotificationService_StreamStatus_Unavailable(t *testing.T) {
+	service := NewNotificationService(new(testsutils.MockRepository), new(testsutils.MockCache), new(testsutils.MockQueue), nil, nil)
+
+	_, err := service.StreamStatus(context.Background(), &models.StatusStreamRequest{})
+
+	assert.ErrorIs(t, err, models.ErrStreamUnavailable)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// channelChain возвращает каналы запроса в порядке попыток отправки
+func channelChain(req *models.CreateNotificationRequest) []string {
+	if len(req.Channels) > 0 {
+		return req.Channels
+	}
+	return []string{req.Channel}
+}
+
+// firstChannel возвращает канал, с которого начинается отправка уведомления
+func firstChannel(n *models.Notification) string {
+	if len(n.Channels) > 0 {
+		return n.Channels[0]
+	}
+	return n.Channel
+}
+
+// preferredChain строит цепочку из канала уведомления и резервных каналов профиля,
+// для которых у пользователя указан адрес.
+func preferredChain(channel string, prefs *models.UserPreferences) []string {
+	if prefs == nil || len(prefs.Channels) == 0 {
+		return nil
+	}
+
+	chain := []string{channel}
+	for _, c := range prefs.Channels {
+		if c == channel {
+			continue
+		}
+		if _, ok := prefs.Contacts[c]; ok {
+			chain = append(chain, c)
+		}
+	}
+	return chain
+}
+
+// nextChannel возвращает следующий после current канал цепочки, для которого есть нотификатор.
+// Если уведомление создано по шаблону tpl, каналы, отличные от канала шаблона, пропускаются.
+func (s *notificationService) nextChannel(chain []string, current string, tpl *models.Template) string {
+	for i, channel := range chain {
+		if channel != current {
+			continue
+		}
+		for _, next := range chain[i+1:] {
+			if _, exists := s.notifiers[next]; !exists {
+				continue
+			}
+			if tpl != nil && tpl.Channel != next {
+				continue
+			}
+			return next
+		}
+		return ""
+	}
+	return ""
+}
+
+// fallbackTemplate возвращает шаблон уведомления, проверенный так же, как при создании:
+// он должен существовать и рендериться с переменными уведомления. Если это не так, ok = false:
+// такое уведомление не отправить ни по одному каналу. Для уведомления без шаблона возвращает nil.
+func (s *notificationService) fallbackTemplate(ctx context.Context, n *models.Notification) (tpl *models.Template, ok bool, err error) {
+	if n.TemplateID == "" {
+		return nil, true, nil
+	}
+	tpl, err = s.repo.GetTemplate(ctx, n.TemplateID, n.TemplateVersion)
+	if errors.Is(err, models.ErrTemplateNotFound) {
+		zlog.Logger.Warn().Err(err).Str("notification_id", n.ID).Msg("Notification template not found, no fallback channel")
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get template: %w", err)
+	}
+	if _, err := renderTemplate(tpl, n.Variables); err != nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", n.ID).Msg("Notification template cannot be rendered, no fallback channel")
+		return nil, false, nil
+	}
+	return tpl, true, nil
+}
+
+// switchToNextChannel переключает уведомление на следующий канал цепочки и ставит его
+// в outbox для немедленной отправки. Цепочка берется из уведомления, а если она не задана -
+// из резервных каналов профиля пользователя. Уведомление по шаблону переключается только
+// на канал шаблона. Возвращает false, если подходящих каналов не осталось.
+func (s *notificationService) switchToNextChannel(ctx context.Context, n *models.Notification, lastErr string) (bool, error) {
+	chain := n.Channels
+	if len(chain) == 0 {
+		prefs, err := s.getPreferences(ctx, n.UserID)
+		if err != nil {
+			return false, err
+		}
+		chain = preferredChain(n.Channel, prefs)
+	}
+
+	tpl, ok, err := s.fallbackTemplate(ctx, n)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	next := s.nextChannel(chain, n.Channel, tpl)
+	if next == "" {
+		return false, nil
+	}
+
+	switched := *n
+	switched.Channel = next
+	switched.Channels = chain
+	switched.LastError = lastErr
+	switched.UpdatedAt = time.Now()
+
+	if err := s.repo.SwitchChannel(ctx, &switched); err != nil {
+		return false, fmt.Errorf("failed to switch notification channel: %w", err)
+	}
+
+	// Счетчик попыток в сообщении из очереди устарел, поэтому кэшируем состояние из базы
+	if current, err := s.repo.GetByID(ctx, switched.ID); err != nil || current == nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", switched.ID).Msg("Failed to reload notification after channel switch")
+	} else {
+		if err := s.cache.Set(ctx, current.ID, current); err != nil {
+			zlog.Logger.Warn().Err(err).Str("notification_id", switched.ID).Msg("Failed to update cache after channel switch")
+		}
+		s.publishStatus(ctx, current)
+	}
+
+	zlog.Logger.Info().
+		Str("notification_id", switched.ID).
+		Str("from", n.Channel).
+		Str("to", next).
+		Msg("Notification switched to fallback channel")
+	return true, nil
+}
@@ -10,24 +10,118 @@ import (
 type NotificationService interface {
 	Create(ctx context.Context, req *models.CreateNotificationRequest) (*models.Notification, error)
 	GetByID(ctx context.Context, id string) (*models.Notification, error)
+	Update(ctx context.Context, id string, req *models.UpdateNotificationRequest) (*models.Notification, error)
 	Delete(ctx context.Context, id string) error
-	Consume(ctx context.Context, queueName string) (<-chan []byte, error)
+	Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error)
 	ProcessNotification(ctx context.Context, notification *models.Notification) error
 	ProcessNotificationData(ctx context.Context, data []byte) error
+	DispatchOutbox(ctx context.Context, batchSize int, window time.Duration) (int, error)
+	FailNotification(ctx context.Context, notification *models.Notification, attempts int, cause error) error
+	RecoverStuck(ctx context.Context) (int, error)
+	ListAttempts(ctx context.Context, id string) ([]*models.Attempt, error)
+	CreateBatch(ctx context.Context, req *models.CreateBatchRequest) (*models.Batch, error)
+	GetBatch(ctx context.Context, id string) (*models.Batch, error)
+	List(ctx context.Context, req *models.ListNotificationsRequest) (*models.NotificationPage, error)
+	ListFailed(ctx context.Context, limit int) ([]*models.Notification, error)
+	Replay(ctx context.Context, id string) (*models.Notification, error)
+	ReplayAllFailed(ctx context.Context) (int, error)
+	StreamStatus(ctx context.Context, req *models.StatusStreamRequest) (<-chan models.StatusEvent, error)
+}
+
+// TemplateService управляет версионированными шаблонами сообщений
+type TemplateService interface {
+	Create(ctx context.Context, req *models.TemplateRequest) (*models.Template, error)
+	Update(ctx context.Context, id string, req *models.TemplateRequest) (*models.Template, error)
+	Get(ctx context.Context, id string, version int) (*models.Template, error)
+	List(ctx context.Context) ([]*models.Template, error)
+	Delete(ctx context.Context, id string) error
+	Preview(ctx context.Context, id string, req *models.PreviewTemplateRequest) (*models.RenderedMessage, error)
+}
+
+// PreferencesService управляет профилями получателей
+type PreferencesService interface {
+	Get(ctx context.Context, userID string) (*models.UserPreferences, error)
+	Save(ctx context.Context, userID string, req *models.PreferencesRequest) (*models.UserPreferences, error)
+	Delete(ctx context.Context, userID string) error
+}
+
+// TelegramService привязывает чаты Telegram к пользователям по одноразовым токенам
+type TelegramService interface {
+	CreateLink(ctx context.Context, userID string) (*models.TelegramLink, error)
+	// LinkChat погашает токен и делает чат адресом пользователя в канале telegram
+	LinkChat(ctx context.Context, token string, chatID int64) (string, error)
+	ChatUser(ctx context.Context, chatID int64) (string, error)
 }
 
 // Repository интерфейс для работы с данными
 type Repository interface {
 	CreateNotification(ctx context.Context, n *models.Notification) error
 	GetByID(ctx context.Context, id string) (*models.Notification, error)
-	UpdateNotificationStatus(ctx context.Context, id, status string) error
+	GetByIdempotencyKey(ctx context.Context, userID, key string) (*models.Notification, error)
+	// UpdateNotificationStatus, MarkNotificationFailed и RecoverStuckNotifications завершают повтор
+	// серии и в той же транзакции сохраняют следующий повтор, построенный next (next может быть nil)
+	UpdateNotificationStatus(ctx context.Context, id, status string, next models.NextOccurrenceFunc) (*models.Notification, error)
+	ClaimNotification(ctx context.Context, id string, version int, lease time.Duration) (*models.Notification, error)
+	ReleaseNotification(ctx context.Context, id string) (*models.Notification, error)
+	RecoverStuckNotifications(ctx context.Context, lastErr string, next models.NextOccurrenceFunc) ([]*models.Notification, error)
+	UpdateNotification(ctx context.Context, n *models.Notification, expectedVersion int) error
 	DeleteNotification(ctx context.Context, id string) error
+	DeleteSeries(ctx context.Context, seriesID string) ([]string, error)
+	ClaimOutboxBatch(ctx context.Context, limit int, dueBefore time.Time, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkOutboxDispatched(ctx context.Context, id int64) error
+	MarkNotificationFailed(ctx context.Context, id string, lastErr string, next models.NextOccurrenceFunc) (*models.Notification, error)
+	ListNotifications(ctx context.Context, filter models.NotificationFilter) ([]*models.Notification, error)
+	GetFailedNotifications(ctx context.Context, limit int) ([]*models.Notification, error)
+	RequeueNotification(ctx context.Context, id string) (*models.Notification, error)
+	RescheduleNotification(ctx context.Context, n *models.Notification) error
+	SwitchChannel(ctx context.Context, n *models.Notification) error
+	RecordAttempt(ctx context.Context, a *models.Attempt) error
+	ListAttempts(ctx context.Context, notificationID string) ([]*models.Attempt, error)
+	// GetAttachmentContents возвращает содержимое вложений уведомления по их идентификаторам
+	GetAttachmentContents(ctx context.Context, notificationID string) (map[string][]byte, error)
+	GetTemplate(ctx context.Context, id string, version int) (*models.Template, error)
+	GetPreferences(ctx context.Context, userID string) (*models.UserPreferences, error)
+	CreateBatch(ctx context.Context, b *models.Batch, notifications []*models.Notification) error
+	GetBatch(ctx context.Context, id string) (*models.Batch, error)
+}
+
+// TemplateRepository интерфейс для хранения шаблонов
+type TemplateRepository interface {
+	CreateTemplate(ctx context.Context, t *models.Template) error
+	CreateTemplateVersion(ctx context.Context, t *models.Template) error
+	GetTemplate(ctx context.Context, id string, version int) (*models.Template, error)
+	ListTemplates(ctx context.Context) ([]*models.Template, error)
+	DeleteTemplate(ctx context.Context, id string) error
+}
+
+// PreferencesRepository интерфейс для хранения предпочтений пользователей
+type PreferencesRepository interface {
+	GetPreferences(ctx context.Context, userID string) (*models.UserPreferences, error)
+	SavePreferences(ctx context.Context, p *models.UserPreferences) error
+	DeletePreferences(ctx context.Context, userID string) error
 }
 
-// Cache интерфейс для кэширования
+// TelegramRepository хранит токены привязки и привязанные чаты Telegram
+type TelegramRepository interface {
+	CreateTelegramLink(ctx context.Context, link *models.TelegramLink) error
+	// LinkTelegramChat в одной транзакции удаляет действующий на момент now токен, привязывает
+	// чат к пользователю токена и записывает чат в его контакты. Возвращает ID пользователя
+	// или models.ErrTelegramLinkInvalid
+	LinkTelegramChat(ctx context.Context, token string, chatID int64, now time.Time) (string, error)
+	// GetTelegramChatUser возвращает ID пользователя чата или models.ErrTelegramChatNotLinked
+	GetTelegramChatUser(ctx context.Context, chatID int64) (string, error)
+}
+
+// Cache интерфейс для кэширования уведомлений. Записи хранятся ограниченное время
+// и сравниваются по ревизии: Set не заменяет более новое состояние уведомления и надгробие.
 type Cache interface {
-	Set(ctx context.Context, key string, value interface{}) error
-	Get(ctx context.Context, key string) (*models.Notification, error)
+	Set(ctx context.Context, id string, n *models.Notification) error
+	// Get возвращает models.ErrCacheMiss, если записи нет, и models.ErrNotFound для надгробия
+	Get(ctx context.Context, id string) (*models.Notification, error)
+	// Tombstone помечает уведомление удаленным
+	Tombstone(ctx context.Context, id string) error
+	// Delete убирает запись, следующее чтение пойдет в репозиторий
+	Delete(ctx context.Context, id string) error
 	Ping(ctx context.Context) (string, error)
 	Close() error
 }
@@ -35,7 +129,20 @@ type Cache interface {
 // Queue интерфейс для работы с очередями
 type Queue interface {
 	PublishWithDelay(ctx context.Context, queueName string, message interface{}, delay time.Duration) error
-	Consume(ctx context.Context, queueName string) (<-chan []byte, error)
+	// PublishDeadLetter переносит уведомление с исчерпанными попытками в очередь недоставленных
+	PublishDeadLetter(ctx context.Context, dl models.DeadLetter) error
+	// AckDeadLetters убирает из очереди недоставленных записи уведомлений, отправленных на replay
+	AckDeadLetters(ctx context.Context, notificationIDs []string) error
+	Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error)
+	Close() error
+}
+
+// StatusEvents рассылает события о смене статусов уведомлений всем репликам API.
+// Доставка не гарантируется: подписчик, подключившийся позже, пропущенные события не получит.
+type StatusEvents interface {
+	Publish(ctx context.Context, event models.StatusEvent) error
+	// Subscribe возвращает канал событий, который закрывается при отмене ctx или закрытии StatusEvents
+	Subscribe(ctx context.Context) (<-chan models.StatusEvent, error)
 	Close() error
 }
 
@@ -44,3 +151,15 @@ type Notifier interface {
 	Send(notification *models.Notification) error
 	GetChannel() string
 }
+
+// RecipientValidator может быть реализован нотификатором, чтобы отклонять
+// некорректных получателей при создании уведомления, а не при отправке.
+type RecipientValidator interface {
+	ValidateRecipient(recipient string) error
+}
+
+// AttachmentSender реализуется нотификаторами, которые доставляют вложения.
+// Уведомление с вложениями должно содержать в цепочке хотя бы один такой канал.
+type AttachmentSender interface {
+	SendsAttachments() bool
+}
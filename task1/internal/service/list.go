@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+const (
+	// defaultListLimit и maxListLimit ограничивают размер страницы GET /notify
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// List возвращает страницу уведомлений по фильтрам запроса. Пагинация по курсору
+// устойчива к вставкам: следующая страница начинается строго после последнего элемента.
+func (s *notificationService) List(ctx context.Context, req *models.ListNotificationsRequest) (*models.NotificationPage, error) {
+	filter, err := buildFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Запрашиваем на один элемент больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	notifications, err := s.repo.ListNotifications(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	page := &models.NotificationPage{Notifications: notifications}
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		last := page.Notifications[limit-1]
+		page.NextCursor, err = encodeCursor(newCursor(filter, last))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if page.Notifications == nil {
+		page.Notifications = []*models.Notification{}
+	}
+	return page, nil
+}
+
+func buildFilter(req *models.ListNotificationsRequest) (models.NotificationFilter, error) {
+	filter := models.NotificationFilter{
+		UserID:   req.UserID,
+		Channel:  req.Channel,
+		SendFrom: req.SendFrom,
+		SendTo:   req.SendTo,
+		SortBy:   req.Sort,
+		Limit:    req.Limit,
+	}
+
+	for _, value := range req.Status {
+		for _, status := range strings.Split(value, ",") {
+			switch status = strings.TrimSpace(status); status {
+			case models.StatusPending, models.StatusSending, models.StatusSent, models.StatusFailed, models.StatusCanceled:
+				filter.Statuses = append(filter.Statuses, status)
+			case "":
+			default:
+				return filter, fmt.Errorf("%w: unknown status %q", models.ErrBadFilter, status)
+			}
+		}
+	}
+
+	if filter.SendFrom != nil && filter.SendTo != nil && !filter.SendFrom.Before(*filter.SendTo) {
+		return filter, fmt.Errorf("%w: send_from must be before send_to", models.ErrBadFilter)
+	}
+
+	switch filter.SortBy {
+	case "":
+		filter.SortBy = models.SortBySendAt
+	case models.SortBySendAt, models.SortByCreatedAt:
+	default:
+		return filter, fmt.Errorf("%w: unsupported sort %q", models.ErrBadFilter, filter.SortBy)
+	}
+
+	switch strings.ToLower(req.Order) {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, fmt.Errorf("%w: unsupported order %q", models.ErrBadFilter, req.Order)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return filter, err
+		}
+		// Курсор привязан к порядку сортировки, иначе страницы пересекались бы
+		if cursor.SortBy != filter.SortBy || cursor.Desc != filter.Desc {
+			return filter, fmt.Errorf("%w: cursor does not match sort order", models.ErrBadFilter)
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
+
+func newCursor(filter models.NotificationFilter, last *models.Notification) *models.NotificationCursor {
+	cursor := &models.NotificationCursor{SortBy: filter.SortBy, Desc: filter.Desc, Value: last.SendAt, ID: last.ID}
+	if filter.SortBy == models.SortByCreatedAt {
+		cursor.Value = last.CreatedAt
+	}
+	return cursor
+}
+
+func encodeCursor(cursor *models.NotificationCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(value string) (*models.NotificationCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", models.ErrBadFilter)
+	}
+	var cursor models.NotificationCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", models.ErrBadFilter)
+	}
+	return &cursor, nil
+}
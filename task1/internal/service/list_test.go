@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_List_Pagination(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	base := time.Date(2025, 12, 22, 9, 0, 0, 0, time.UTC)
+	notifications := []*models.Notification{
+		{ID: "id-1", UserID: "user-1", SendAt: base},
+		{ID: "id-2", UserID: "user-1", SendAt: base.Add(time.Hour)},
+		{ID: "id-3", UserID: "user-1", SendAt: base.Add(2 * time.Hour)},
+	}
+
+	// Первая страница: репозиторий возвращает limit+1 элементов
+	repo.
+		On("ListNotifications", mock.Anything, mock.MatchedBy(func(f models.NotificationFilter) bool {
+			return f.After == nil && f.Limit == 3 && f.UserID == "user-1" &&
+				assert.ObjectsAreEqual([]string{"pending", "failed"}, f.Statuses)
+		})).
+		Return(notifications, nil).
+		Once()
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	page, err := service.List(context.Background(), &models.ListNotificationsRequest{
+		UserID: "user-1",
+		Status: []string{"pending,failed"},
+		Limit:  2,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, page.Notifications, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Вторая страница начинается после последнего элемента первой
+	repo.
+		On("ListNotifications", mock.Anything, mock.MatchedBy(func(f models.NotificationFilter) bool {
+			return f.After != nil &&
+				f.After.ID == "id-2" &&
+				f.After.Value.Equal(base.Add(time.Hour)) &&
+				f.After.SortBy == models.SortBySendAt
+		})).
+		Return(notifications[2:], nil).
+		Once()
+
+	page, err = service.List(context.Background(), &models.ListNotificationsRequest{
+		UserID: "user-1",
+		Status: []string{"pending,failed"},
+		Limit:  2,
+		Cursor: page.NextCursor,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, page.Notifications, 1)
+	assert.Equal(t, "id-3", page.Notifications[0].ID)
+	assert.Empty(t, page.NextCursor)
+	repo.AssertExpectations(t)
+}
+
+func TestNotificationService_List_InvalidFilter(t *testing.T) {
+	from := time.Date(2025, 12, 22, 9, 0, 0, 0, time.UTC)
+	to := from.Add(-time.Hour)
+
+	descCursor, err := encodeCursor(&models.NotificationCursor{SortBy: models.SortBySendAt, Desc: true, ID: "id-1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		req  models.ListNotificationsRequest
+	}{
+		{name: "unknown status", req: models.ListNotificationsRequest{Status: []string{"lost"}}},
+		{name: "unsupported sort", req: models.ListNotificationsRequest{Sort: "message"}},
+		{name: "unsupported order", req: models.ListNotificationsRequest{Order: "random"}},
+		{name: "empty range", req: models.ListNotificationsRequest{SendFrom: &from, SendTo: &to}},
+		{name: "malformed cursor", req: models.ListNotificationsRequest{Cursor: "not-a-cursor"}},
+		{name: "cursor from another order", req: models.ListNotificationsRequest{Cursor: descCursor}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			service := NewNotificationService(repo, new(testsutils.MockCache), new(testsutils.MockQueue), nil, nil)
+
+			_, err := service.List(context.Background(), &tt.req)
+
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, models.ErrBadFilter))
+			repo.AssertNotCalled(t, "ListNotifications", mock.Anything, mock.Anything)
+		})
+	}
+}
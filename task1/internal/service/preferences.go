@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// preferencesService хранит профили получателей. Адреса проверяются нотификаторами
+// соответствующих каналов при сохранении, чтобы ошибки не всплывали только при отправке.
+type preferencesService struct {
+	repo      PreferencesRepository
+	notifiers map[string]Notifier
+}
+
+func NewPreferencesService(repo PreferencesRepository, notifiers []Notifier) PreferencesService {
+	notifierMap := make(map[string]Notifier)
+	for _, notifier := range notifiers {
+		notifierMap[notifier.GetChannel()] = notifier
+	}
+
+	return &preferencesService{repo: repo, notifiers: notifierMap}
+}
+
+func (s *preferencesService) Get(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	p, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	return p, nil
+}
+
+func (s *preferencesService) Save(ctx context.Context, userID string, req *models.PreferencesRequest) (*models.UserPreferences, error) {
+	if err := s.validatePreferences(req); err != nil {
+		return nil, err
+	}
+
+	p := &models.UserPreferences{
+		UserID:     userID,
+		Contacts:   req.Contacts,
+		Channels:   req.Channels,
+		Timezone:   req.Timezone,
+		QuietHours: req.QuietHours,
+		UpdatedAt:  time.Now(),
+	}
+	if err := s.repo.SavePreferences(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to save preferences: %w", err)
+	}
+	return p, nil
+}
+
+func (s *preferencesService) Delete(ctx context.Context, userID string) error {
+	if err := s.repo.DeletePreferences(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete preferences: %w", err)
+	}
+	return nil
+}
+
+func (s *preferencesService) validatePreferences(req *models.PreferencesRequest) error {
+	if len(req.Contacts) == 0 {
+		return fmt.Errorf("contacts are required")
+	}
+	for channel, contact := range req.Contacts {
+		notifier, exists := s.notifiers[channel]
+		if !exists {
+			return fmt.Errorf("unsupported channel: %s", channel)
+		}
+		if contact == "" {
+			return fmt.Errorf("contact for channel %s is empty", channel)
+		}
+		if validator, ok := notifier.(RecipientValidator); ok {
+			if err := validator.ValidateRecipient(contact); err != nil {
+				return fmt.Errorf("invalid contact for channel %s: %w", channel, err)
+			}
+		}
+	}
+	for _, channel := range req.Channels {
+		if _, exists := req.Contacts[channel]; !exists {
+			return fmt.Errorf("no contact for channel %s", channel)
+		}
+	}
+
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	if req.QuietHours != nil {
+		start, err := parseClock(req.QuietHours.Start)
+		if err != nil {
+			return fmt.Errorf("invalid quiet_hours.start: %w", err)
+		}
+		end, err := parseClock(req.QuietHours.End)
+		if err != nil {
+			return fmt.Errorf("invalid quiet_hours.end: %w", err)
+		}
+		if start == end {
+			return fmt.Errorf("quiet_hours.start and quiet_hours.end must differ")
+		}
+	}
+	return nil
+}
+
+// resolveRecipient возвращает адрес получателя для текущего канала уведомления.
+// Без профиля адресом служит сам UserID.
+func resolveRecipient(n *models.Notification, prefs *models.UserPreferences) (string, error) {
+	if prefs == nil {
+		return n.UserID, nil
+	}
+	contact, ok := prefs.Contacts[n.Channel]
+	if !ok {
+		return "", fmt.Errorf("no contact for channel: %s", n.Channel)
+	}
+	return contact, nil
+}
+
+// getPreferences возвращает профиль пользователя или nil, если он не задан
+func (s *notificationService) getPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	prefs, err := s.repo.GetPreferences(ctx, userID)
+	if errors.Is(err, models.ErrPreferencesNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// quietUntil сообщает, попадает ли now в тихие часы пользователя, и возвращает их окончание.
+func quietUntil(prefs *models.UserPreferences, now time.Time) (time.Time, bool) {
+	if prefs == nil || prefs.QuietHours == nil {
+		return time.Time{}, false
+	}
+	start, err := parseClock(prefs.QuietHours.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(prefs.QuietHours.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+	loc, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	var inside bool
+	if start < end {
+		inside = minute >= start && minute < end
+	} else {
+		// Интервал переходит через полночь, например 22:00-08:00
+		inside = minute >= start || minute < end
+	}
+	if !inside {
+		return time.Time{}, false
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !until.After(local) {
+		until = time.Date(local.Year(), local.Month(), local.Day()+1, end/60, end%60, 0, 0, loc)
+	}
+	return until, true
+}
+
+// parseClock разбирает время "HH:MM" в минуты от начала суток
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
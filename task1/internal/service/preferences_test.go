@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietUntil(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		prefs     *models.UserPreferences
+		now       time.Time
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{
+			name:  "no preferences",
+			prefs: nil,
+			now:   time.Date(2025, 12, 22, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "overnight window before midnight",
+			prefs:     &models.UserPreferences{QuietHours: &models.QuietHours{Start: "22:00", End: "08:00"}},
+			now:       time.Date(2025, 12, 22, 23, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2025, 12, 23, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "overnight window after midnight",
+			prefs:     &models.UserPreferences{QuietHours: &models.QuietHours{Start: "22:00", End: "08:00"}},
+			now:       time.Date(2025, 12, 23, 3, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2025, 12, 23, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "outside window",
+			prefs: &models.UserPreferences{QuietHours: &models.QuietHours{Start: "22:00", End: "08:00"}},
+			now:   time.Date(2025, 12, 22, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "end is exclusive",
+			prefs: &models.UserPreferences{QuietHours: &models.QuietHours{Start: "13:00", End: "14:00"}},
+			now:   time.Date(2025, 12, 22, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "user timezone",
+			prefs: &models.UserPreferences{
+				Timezone:   "Europe/Moscow",
+				QuietHours: &models.QuietHours{Start: "22:00", End: "08:00"},
+			},
+			// 20:00 UTC - это 23:00 по Москве
+			now:       time.Date(2025, 12, 22, 20, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2025, 12, 23, 8, 0, 0, 0, moscow),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := quietUntil(tt.prefs, tt.now)
+
+			assert.Equal(t, tt.wantQuiet, quiet)
+			if tt.wantQuiet {
+				assert.True(t, tt.wantUntil.Equal(until), "want %s, got %s", tt.wantUntil, until)
+			}
+		})
+	}
+}
+
+func TestPreferencesService_Save(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     models.PreferencesRequest
+		wantErr string
+	}{
+		{
+			name: "success",
+			req: models.PreferencesRequest{
+				Contacts:   map[string]string{"email": "ann@example.com", "telegram": "12345"},
+				Channels:   []string{"telegram", "email"},
+				Timezone:   "Europe/Moscow",
+				QuietHours: &models.QuietHours{Start: "22:00", End: "08:00"},
+			},
+		},
+		{
+			name:    "unsupported channel",
+			req:     models.PreferencesRequest{Contacts: map[string]string{"sms": "+70000000000"}},
+			wantErr: "unsupported channel",
+		},
+		{
+			name: "channel without contact",
+			req: models.PreferencesRequest{
+				Contacts: map[string]string{"email": "ann@example.com"},
+				Channels: []string{"telegram"},
+			},
+			wantErr: "no contact for channel telegram",
+		},
+		{
+			name: "invalid timezone",
+			req: models.PreferencesRequest{
+				Contacts: map[string]string{"email": "ann@example.com"},
+				Timezone: "Mars/Olympus",
+			},
+			wantErr: "invalid timezone",
+		},
+		{
+			name: "invalid quiet hours",
+			req: models.PreferencesRequest{
+				Contacts:   map[string]string{"email": "ann@example.com"},
+				QuietHours: &models.QuietHours{Start: "22", End: "08:00"},
+			},
+			wantErr: "invalid quiet_hours.start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			if tt.wantErr == "" {
+				repo.On("SavePreferences", mock.Anything, mock.AnythingOfType("*models.UserPreferences")).Return(nil)
+			}
+
+			notifiers := []Notifier{
+				&testsutils.MockNotifier{Channel: "email"},
+				&testsutils.MockNotifier{Channel: "telegram"},
+			}
+			service := NewPreferencesService(repo, notifiers)
+
+			p, err := service.Save(context.Background(), "user-1", &tt.req)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				repo.AssertNotCalled(t, "SavePreferences", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", p.UserID)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/robfig/cron/v3"
+	"github.com/teambition/rrule-go"
+)
+
+// validateRecurrence проверяет, что задано ровно одно расписание и его можно разобрать.
+func validateRecurrence(r *models.Recurrence, sendAt time.Time) error {
+	if r.Cron == "" && r.RRule == "" {
+		return fmt.Errorf("recurrence requires cron or rrule")
+	}
+	if r.Cron != "" && r.RRule != "" {
+		return fmt.Errorf("recurrence accepts either cron or rrule, not both")
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("recurrence count must not be negative")
+	}
+	if r.Until != nil && r.Until.Before(sendAt) {
+		return fmt.Errorf("recurrence until must be after send_at")
+	}
+
+	if r.Cron != "" {
+		if _, err := cron.ParseStandard(r.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression: %w", err)
+		}
+		return nil
+	}
+	if _, err := parseRRule(r.RRule, sendAt); err != nil {
+		return fmt.Errorf("invalid rrule: %w", err)
+	}
+	return nil
+}
+
+// nextOccurrence вычисляет время следующей отправки серии после after.
+// Второе значение равно false, если серия завершена по Count или Until.
+func nextOccurrence(r *models.Recurrence, occurrence int, after time.Time) (time.Time, bool, error) {
+	if r.Count > 0 && occurrence >= r.Count {
+		return time.Time{}, false, nil
+	}
+
+	var next time.Time
+	if r.Cron != "" {
+		schedule, err := cron.ParseStandard(r.Cron)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid cron expression: %w", err)
+		}
+		next = schedule.Next(after)
+	} else {
+		rule, err := parseRRule(r.RRule, r.Start)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid rrule: %w", err)
+		}
+		next = rule.After(after, false)
+	}
+
+	if next.IsZero() || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false, nil
+	}
+	return next, true, nil
+}
+
+// parseRRule разбирает RRULE; если DTSTART не указан, серия отсчитывается от start.
+func parseRRule(value string, start time.Time) (*rrule.RRule, error) {
+	option, err := rrule.StrToROption(value)
+	if err != nil {
+		return nil, err
+	}
+	if option.Dtstart.IsZero() {
+		option.Dtstart = start
+	}
+	return rrule.NewRRule(*option)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	start := time.Date(2030, 1, 6, 9, 0, 0, 0, time.UTC) // воскресенье
+	until := start.Add(48 * time.Hour)
+
+	tests := []struct {
+		name       string
+		recurrence models.Recurrence
+		occurrence int
+		after      time.Time
+		want       time.Time
+		wantOK     bool
+	}{
+		{
+			name:       "daily cron",
+			recurrence: models.Recurrence{Cron: "0 9 * * *", Start: start},
+			occurrence: 1,
+			after:      start,
+			want:       start.Add(24 * time.Hour),
+			wantOK:     true,
+		},
+		{
+			name:       "weekly rrule",
+			recurrence: models.Recurrence{RRule: "FREQ=WEEKLY;BYDAY=MO", Start: start},
+			occurrence: 1,
+			after:      start,
+			want:       start.Add(24 * time.Hour),
+			wantOK:     true,
+		},
+		{
+			name:       "count reached",
+			recurrence: models.Recurrence{Cron: "0 9 * * *", Count: 3, Start: start},
+			occurrence: 3,
+			after:      start,
+		},
+		{
+			name:       "after until",
+			recurrence: models.Recurrence{Cron: "0 9 * * *", Until: &until, Start: start},
+			occurrence: 2,
+			after:      start.Add(48 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok, err := nextOccurrence(&tt.recurrence, tt.occurrence, tt.after)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.True(t, tt.want.Equal(next), "got %s, want %s", next, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRecurrence(t *testing.T) {
+	sendAt := time.Now().Add(time.Hour)
+	before := sendAt.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		recurrence models.Recurrence
+		wantErr    string
+	}{
+		{name: "valid cron", recurrence: models.Recurrence{Cron: "*/15 * * * *"}},
+		{name: "valid rrule", recurrence: models.Recurrence{RRule: "FREQ=DAILY;INTERVAL=2"}},
+		{name: "empty", wantErr: "recurrence requires cron or rrule"},
+		{name: "both", recurrence: models.Recurrence{Cron: "* * * * *", RRule: "FREQ=DAILY"}, wantErr: "either cron or rrule"},
+		{name: "invalid cron", recurrence: models.Recurrence{Cron: "every day"}, wantErr: "invalid cron expression"},
+		{name: "invalid rrule", recurrence: models.Recurrence{RRule: "FREQ=SOMETIMES"}, wantErr: "invalid rrule"},
+		{name: "until before send_at", recurrence: models.Recurrence{Cron: "* * * * *", Until: &before}, wantErr: "until must be after send_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRecurrence(&tt.recurrence, sendAt)
+
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,14 +3,26 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pozedorum/WB_project_3/task1/internal/metrics"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/wbf/zlog"
 )
 
+// outboxLease - время, на которое relay захватывает записи outbox.
+const outboxLease = 30 * time.Second
+
+// defaultFailedLimit - размер страницы при выборке failed уведомлений.
+const defaultFailedLimit = 100
+
+// maxIdempotencyKeyLength - максимальная длина заголовка Idempotency-Key.
+const maxIdempotencyKeyLength = 255
+
 // NotificationService реализует бизнес-логику управления уведомлениями:
 // создание, получение, удаление и отправку через очередь.
 type notificationService struct {
@@ -18,9 +30,11 @@ type notificationService struct {
 	cache     Cache
 	queue     Queue
 	notifiers map[string]Notifier // map[channel]Notifier
+	events    StatusEvents
 }
 
-func NewNotificationService(repo Repository, cache Cache, queue Queue, notifiers []Notifier) NotificationService {
+// NewNotificationService создает сервис. events может быть nil, тогда поток статусов недоступен.
+func NewNotificationService(repo Repository, cache Cache, queue Queue, notifiers []Notifier, events StatusEvents) NotificationService {
 	notifierMap := make(map[string]Notifier)
 	for _, notifier := range notifiers {
 		notifierMap[notifier.GetChannel()] = notifier
@@ -31,18 +45,48 @@ func NewNotificationService(repo Repository, cache Cache, queue Queue, notifiers
 		cache:     cache,
 		queue:     queue,
 		notifiers: notifierMap,
+		events:    events,
 	}
 }
 
 func (s *notificationService) Create(ctx context.Context, req *models.CreateNotificationRequest) (*models.Notification, error) {
+	// Повтор запроса с тем же ключом возвращает исходное уведомление. Проверяем до валидации:
+	// повтор после таймаута может прийти, когда send_at уже слишком близко
+	if req.IdempotencyKey != "" {
+		if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+			return nil, fmt.Errorf("idempotency key must be at most %d characters", maxIdempotencyKeyLength)
+		}
+		existing, err := s.repo.GetByIdempotencyKey(ctx, req.UserID, req.IdempotencyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check idempotency key: %w", err)
+		}
+		if existing != nil {
+			zlog.Logger.Info().Str("notification_id", existing.ID).Msg("Notification already created with this idempotency key")
+			return existing, nil
+		}
+	}
+
 	// Валидация
 	if err := s.validateRequest(req); err != nil {
 		return nil, err
 	}
 
-	// Проверяем поддержку канала
-	if _, exists := s.notifiers[req.Channel]; !exists {
-		return nil, fmt.Errorf("unsupported channel: %s", req.Channel)
+	if err := s.validateChannels(ctx, req.UserID, channelChain(req)); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateAttachments(req.Attachments, channelChain(req)); err != nil {
+		return nil, err
+	}
+
+	// Фиксируем версию шаблона, чтобы его последующие изменения не влияли на уведомление
+	templateVersion := 0
+	if req.TemplateID != "" {
+		tpl, err := s.resolveTemplate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		templateVersion = tpl.Version
 	}
 
 	// Создаем уведомление
@@ -51,42 +95,65 @@ func (s *notificationService) Create(ctx context.Context, req *models.CreateNoti
 		UserID:    req.UserID,
 		Message:   req.Message,
 		Channel:   req.Channel,
+		Channels:  req.Channels,
 		SendAt:    req.SendAt,
 		Status:    models.StatusPending,
+		Version:   1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+
+		IdempotencyKey: req.IdempotencyKey,
+
+		TemplateID:      req.TemplateID,
+		TemplateVersion: templateVersion,
+		Variables:       req.Variables,
+
+		Subject:     req.Subject,
+		ParseMode:   req.ParseMode,
+		Attachments: req.Attachments,
 	}
 
-	// Сохраняем в репозиторий
+	// Повторяющееся уведомление становится первым в серии
+	if req.Recurrence != nil {
+		recurrence := *req.Recurrence
+		recurrence.Start = req.SendAt
+		notification.SeriesID = notification.ID
+		notification.Recurrence = &recurrence
+		notification.Occurrence = 1
+	}
+
+	// Сохраняем в репозиторий вместе с записью outbox, публикацией займется relay
 	if err := s.repo.CreateNotification(ctx, notification); err != nil {
+		// Параллельный запрос с тем же ключом успел создать уведомление раньше
+		if errors.Is(err, models.ErrDuplicateIdempotencyKey) {
+			existing, getErr := s.repo.GetByIdempotencyKey(ctx, req.UserID, req.IdempotencyKey)
+			if getErr == nil && existing != nil {
+				return existing, nil
+			}
+		}
 		return nil, fmt.Errorf("failed to create notification: %w", err)
 	}
+	metrics.NotificationsCreated.WithLabelValues(notification.Channel).Inc()
 
 	// Кэшируем
 	if err := s.cache.Set(ctx, notification.ID, notification); err != nil {
 		zlog.Logger.Warn().Err(err).Str("notification_id", notification.ID).Msg("Failed to cache notification")
 	}
-
-	// Отправляем в очередь
-	if err := s.publishToQueue(ctx, notification); err != nil {
-		// Откатываем изменения при ошибке
-		if err := s.repo.UpdateNotificationStatus(ctx, notification.ID, models.StatusFailed); err != nil {
-			zlog.Logger.Error().Err(err).Str("notification_id", notification.ID).Msg("Failed to update status after queue error")
-		}
-		return nil, fmt.Errorf("failed to publish to queue: %w", err)
-	}
+	s.publishStatus(ctx, notification)
 
 	return notification, nil
 }
 
 func (s *notificationService) GetByID(ctx context.Context, id string) (*models.Notification, error) {
-	// Пробуем из кэша
-	if cached, err := s.cache.Get(ctx, id); err == nil && cached != nil {
-		if cached == nil {
-			// Запись была удалена
-			return nil, nil
-		}
+	// Пробуем из кэша, надгробие означает, что уведомление удалено
+	cached, err := s.cache.Get(ctx, id)
+	switch {
+	case err == nil:
 		return cached, nil
+	case errors.Is(err, models.ErrNotFound):
+		return nil, nil
+	case !errors.Is(err, models.ErrCacheMiss):
+		zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to read notification from cache")
 	}
 
 	// Ищем в репозитории
@@ -99,17 +166,80 @@ func (s *notificationService) GetByID(ctx context.Context, id string) (*models.N
 		return nil, nil
 	}
 
-	// Обновляем кэш асинхронно
-	notificationCopy := *notification
-	go func() {
-		if err := s.cache.Set(context.Background(), id, &notificationCopy); err != nil {
-			zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to update cache")
-		}
-	}()
+	// Кэш не примет прочитанное состояние, если его уже обновили до более новой ревизии
+	if err := s.cache.Set(ctx, id, notification); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to update cache")
+	}
 
 	return notification, nil
 }
 
+// Update изменяет текст, канал или время отправки ожидающего уведомления. Версия уведомления
+// увеличивается: уже опубликованное в очередь сообщение будет проигнорировано при обработке,
+// а сообщение с новой версией опубликует relay из outbox.
+func (s *notificationService) Update(ctx context.Context, id string, req *models.UpdateNotificationRequest) (*models.Notification, error) {
+	current, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+	if current == nil {
+		return nil, models.ErrNotFound
+	}
+	if current.Status != models.StatusPending {
+		return nil, models.ErrNotPending
+	}
+	if req.Version != 0 && req.Version != current.Version {
+		return nil, models.ErrVersionConflict
+	}
+
+	updated := *current
+	if req.Message != nil {
+		if *req.Message == "" && current.TemplateID == "" {
+			return nil, fmt.Errorf("message is required")
+		}
+		updated.Message = *req.Message
+	}
+	if req.Channel != nil && *req.Channel != current.Channel {
+		if err := s.validateChannels(ctx, current.UserID, []string{*req.Channel}); err != nil {
+			return nil, err
+		}
+		if err := s.validateAttachments(current.Attachments, []string{*req.Channel}); err != nil {
+			return nil, err
+		}
+		if current.TemplateID != "" {
+			tpl, err := s.repo.GetTemplate(ctx, current.TemplateID, current.TemplateVersion)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get template: %w", err)
+			}
+			if tpl.Channel != *req.Channel {
+				return nil, fmt.Errorf("template channel %s does not match notification channel %s", tpl.Channel, *req.Channel)
+			}
+		}
+		updated.Channel = *req.Channel
+		updated.Channels = nil
+	}
+	if req.SendAt != nil {
+		if req.SendAt.Before(time.Now().Add(1 * time.Minute)) {
+			return nil, fmt.Errorf("send_at must be at least 1 minute in the future")
+		}
+		updated.SendAt = *req.SendAt
+	}
+
+	updated.Version = current.Version + 1
+	updated.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdateNotification(ctx, &updated, current.Version); err != nil {
+		return nil, fmt.Errorf("failed to update notification: %w", err)
+	}
+
+	// Обновляем кэш, чтобы обработка не увидела старую версию
+	if err := s.cache.Set(ctx, id, &updated); err != nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to update cache after update")
+	}
+
+	return &updated, nil
+}
+
 func (s *notificationService) Delete(ctx context.Context, id string) error {
 	notification, err := s.GetByID(ctx, id)
 	if err != nil {
@@ -120,6 +250,11 @@ func (s *notificationService) Delete(ctx context.Context, id string) error {
 		return fmt.Errorf("notification not found")
 	}
 
+	// Для серии отменяем все ожидающие повторы, даже если передан ID уже отправленного
+	if notification.SeriesID != "" {
+		return s.deleteSeries(ctx, notification.SeriesID, notification.UserID)
+	}
+
 	if notification.Status == models.StatusSent {
 		return fmt.Errorf("cannot delete sent notification")
 	}
@@ -131,15 +266,16 @@ func (s *notificationService) Delete(ctx context.Context, id string) error {
 	if err := s.repo.DeleteNotification(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete notification: %w", err)
 	}
-	// Устанавливаем новый статус в redis
-	if err := s.cache.Set(ctx, id, nil); err != nil {
+	// Надгробие не даст устаревшей записи вернуть уведомление в кэш
+	if err := s.cache.Tombstone(ctx, id); err != nil {
 		zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to update cache after deletion")
 	}
+	s.publishCanceled(ctx, id, notification.UserID)
 	return nil
 }
 
 // Функция для воркера
-func (s *notificationService) Consume(ctx context.Context, queueName string) (<-chan []byte, error) {
+func (s *notificationService) Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error) {
 	return s.queue.Consume(ctx, queueName)
 }
 
@@ -161,64 +297,538 @@ func (s *notificationService) ProcessNotification(ctx context.Context, notificat
 	}
 
 	if current == nil || current.Status != models.StatusPending {
-		return fmt.Errorf("notification is no longer pending")
+		return models.ErrNotPending
 	}
 
-	// Отправляем уведомление
-	notifier, exists := s.notifiers[notification.Channel]
-	if !exists {
-		return fmt.Errorf("no notifier for channel: %s", notification.Channel)
+	// Сообщение опубликовано до изменения уведомления, новую версию доставит другое сообщение.
+	// Версия 0 - сообщение, опубликованное до появления версий
+	if notification.Version != 0 && notification.Version != current.Version {
+		return models.ErrStaleVersion
 	}
 
-	if err := notifier.Send(current); err != nil {
-		// Обновляем статус на failed
-		if updateErr := s.repo.UpdateNotificationStatus(ctx, notification.ID, models.StatusFailed); updateErr != nil {
-			zlog.Logger.Error().Err(updateErr).Str("notification_id", notification.ID).Msg("Failed to update status after send error")
-		}
-		return fmt.Errorf("failed to send notification: %w", err)
+	prefs, err := s.getPreferences(ctx, current.UserID)
+	if err != nil {
+		return err
 	}
 
-	// Обновляем статус на sent
-	if err := s.repo.UpdateNotificationStatus(ctx, notification.ID, models.StatusSent); err != nil {
+	// В тихие часы не отправляем, а переносим уведомление на их окончание
+	if until, quiet := quietUntil(prefs, time.Now()); quiet {
+		return s.deferNotification(ctx, current, until)
+	}
+
+	// Захватываем уведомление: отправит его только один воркер,
+	// даже если сообщение пришло из очереди повторно
+	claimed, err := s.repo.ClaimNotification(ctx, notification.ID, notification.Version, sendLease)
+	if err != nil {
+		return fmt.Errorf("failed to claim notification: %w", err)
+	}
+	if err := s.cache.Set(ctx, claimed.ID, claimed); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", claimed.ID).Msg("Failed to update cache")
+	}
+	s.publishStatus(ctx, claimed)
+
+	// Статус failed (или переход к следующему каналу) выставляет воркер
+	// через FailNotification, когда попытки исчерпаны
+	started := time.Now()
+	err = s.deliver(ctx, claimed, prefs)
+	observeSend(claimed, started, err)
+	s.recordAttempt(ctx, claimed, started, err)
+	if err != nil {
+		s.release(ctx, claimed.ID)
+		return err
+	}
+
+	// Обновляем статус на sent, следующий повтор серии создается в той же транзакции
+	next, scheduled := continueSeries()
+	sent, err := s.repo.UpdateNotificationStatus(ctx, notification.ID, models.StatusSent, next)
+	if err != nil {
 		return fmt.Errorf("failed to update status: %w", err)
 	}
+	occurrenceScheduled(sent, scheduled[sent.ID])
 
 	// Обновляем кэш
-	current.Status = models.StatusSent
-	if err := s.cache.Set(ctx, notification.ID, current); err != nil {
+	if err := s.cache.Set(ctx, notification.ID, sent); err != nil {
 		zlog.Logger.Error().Err(err).Str("notification_id", notification.ID).Msg("Failed to update cache")
 	}
+	s.publishStatus(ctx, sent)
 
 	zlog.Logger.Info().Str("notification_id", notification.ID).Msg("Notification processed successfully")
 	return nil
 }
 
+// validateChannels проверяет, что для каналов есть нотификаторы. Адреса из профиля проверяются
+// при его сохранении, без профиля адресом во всех каналах служит user_id.
+func (s *notificationService) validateChannels(ctx context.Context, userID string, channels []string) error {
+	var prefs *models.UserPreferences
+	prefsLoaded := false
+	for _, channel := range channels {
+		notifier, exists := s.notifiers[channel]
+		if !exists {
+			return fmt.Errorf("unsupported channel: %s", channel)
+		}
+		validator, ok := notifier.(RecipientValidator)
+		if !ok {
+			continue
+		}
+		if !prefsLoaded {
+			var err error
+			if prefs, err = s.getPreferences(ctx, userID); err != nil {
+				return err
+			}
+			prefsLoaded = true
+		}
+		if prefs == nil {
+			if err := validator.ValidateRecipient(userID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// send отправляет уведомление через его текущий канал по адресу из профиля пользователя.
+func (s *notificationService) send(outgoing *models.Notification, prefs *models.UserPreferences) error {
+	notifier, exists := s.notifiers[outgoing.Channel]
+	if !exists {
+		return fmt.Errorf("no notifier for channel: %s", outgoing.Channel)
+	}
+
+	recipient, err := resolveRecipient(outgoing, prefs)
+	if err != nil {
+		return err
+	}
+
+	msg := *outgoing
+	msg.UserID = recipient
+	return notifier.Send(&msg)
+}
+
+// deferNotification переносит уведомление на время until через outbox,
+// текущее сообщение из очереди при этом считается обработанным.
+func (s *notificationService) deferNotification(ctx context.Context, current *models.Notification, until time.Time) error {
+	deferred := *current
+	deferred.SendAt = until
+	deferred.UpdatedAt = time.Now()
+
+	if err := s.repo.RescheduleNotification(ctx, &deferred); err != nil {
+		return fmt.Errorf("failed to defer notification: %w", err)
+	}
+
+	if err := s.cache.Set(ctx, deferred.ID, &deferred); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", deferred.ID).Msg("Failed to update cache")
+	}
+
+	zlog.Logger.Info().
+		Str("notification_id", deferred.ID).
+		Time("send_at", until).
+		Msg("Notification deferred until the end of quiet hours")
+	return nil
+}
+
+// continueSeries возвращает функцию, которую репозиторий вызывает для завершенного повтора серии
+// (отправленного или failed) в транзакции смены его статуса. Так следующий повтор создается
+// вместе со статусом, и серию не обрывает ни сбой между двумя записями, ни неудачная отправка.
+// Построенные повторы запоминаются по ID завершенного уведомления: при повторе транзакции
+// значение перезаписывается, и после фиксации в scheduled остается сохраненный повтор.
+func continueSeries() (models.NextOccurrenceFunc, map[string]*models.Notification) {
+	scheduled := make(map[string]*models.Notification)
+	next := func(finished *models.Notification) *models.Notification {
+		n := buildNextOccurrence(finished)
+		scheduled[finished.ID] = n
+		return n
+	}
+	return next, scheduled
+}
+
+// buildNextOccurrence строит следующее уведомление серии после повтора current или возвращает nil,
+// если уведомление не повторяется или серия закончилась.
+// Уникальный индекс (series_id, occurrence) не дает создать один повтор дважды.
+func buildNextOccurrence(current *models.Notification) *models.Notification {
+	if current.Recurrence == nil {
+		return nil
+	}
+
+	after := current.SendAt
+	if now := time.Now(); now.After(after) {
+		after = now
+	}
+
+	nextAt, ok, err := nextOccurrence(current.Recurrence, current.Occurrence, after)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("series_id", current.SeriesID).Msg("Failed to calculate next occurrence")
+		return nil
+	}
+	if !ok {
+		zlog.Logger.Info().Str("series_id", current.SeriesID).Int("occurrence", current.Occurrence).Msg("Notification series completed")
+		return nil
+	}
+
+	return &models.Notification{
+		ID:         uuid.New().String(),
+		UserID:     current.UserID,
+		Message:    current.Message,
+		Channel:    firstChannel(current),
+		Channels:   current.Channels,
+		SendAt:     nextAt,
+		Status:     models.StatusPending,
+		Version:    1,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		SeriesID:   current.SeriesID,
+		Recurrence: current.Recurrence,
+		Occurrence: current.Occurrence + 1,
+
+		TemplateID:      current.TemplateID,
+		TemplateVersion: current.TemplateVersion,
+		Variables:       current.Variables,
+
+		Subject:     current.Subject,
+		ParseMode:   current.ParseMode,
+		Attachments: current.Attachments,
+	}
+}
+
+// occurrenceScheduled учитывает следующий повтор серии, сохраненный вместе с завершением current
+func occurrenceScheduled(current, next *models.Notification) {
+	if next == nil {
+		return
+	}
+	metrics.NotificationsCreated.WithLabelValues(next.Channel).Inc()
+
+	zlog.Logger.Info().
+		Str("series_id", current.SeriesID).
+		Str("notification_id", next.ID).
+		Time("send_at", next.SendAt).
+		Msg("Next occurrence scheduled")
+}
+
+// deleteSeries отменяет серию пользователя userID и удаляет ее ожидающие уведомления.
+// Если повтор серии сейчас отправляется, удалять может быть нечего, но серия все равно
+// отменена: следующий повтор после него не создается.
+func (s *notificationService) deleteSeries(ctx context.Context, seriesID, userID string) error {
+	ids, err := s.repo.DeleteSeries(ctx, seriesID)
+	if errors.Is(err, models.ErrNotPending) {
+		return fmt.Errorf("notification series has no pending notifications")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete notification series: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := s.cache.Tombstone(ctx, id); err != nil {
+			zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to update cache after deletion")
+		}
+		s.publishCanceled(ctx, id, userID)
+	}
+	return nil
+}
+
+// FailNotification вызывается после исчерпания попыток на текущем канале. Если в цепочке
+// есть следующий канал, уведомление переключается на него, иначе помечается как failed,
+// сохраняет последнюю ошибку и отправляется в очередь недоставленных.
+func (s *notificationService) FailNotification(ctx context.Context, notification *models.Notification, attempts int, cause error) error {
+	lastErr := ""
+	if cause != nil {
+		lastErr = cause.Error()
+	}
+
+	switched, err := s.switchToNextChannel(ctx, notification, lastErr)
+	if err != nil {
+		return err
+	}
+	if switched {
+		return nil
+	}
+
+	// Неудачный повтор не обрывает серию: следующий создается вместе со статусом failed
+	next, scheduled := continueSeries()
+	failed, err := s.repo.MarkNotificationFailed(ctx, notification.ID, lastErr, next)
+	if errors.Is(err, models.ErrNotPending) {
+		// Уведомление уже отправлено или завершено другим воркером, его статус не меняем
+		zlog.Logger.Warn().Str("notification_id", notification.ID).Msg("Notification already finished, failure not recorded")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark notification failed: %w", err)
+	}
+	occurrenceScheduled(failed, scheduled[failed.ID])
+	metrics.NotificationsFailed.WithLabelValues(failed.Channel).Inc()
+	s.publishDeadLetter(ctx, failed, attempts, lastErr)
+
+	if err := s.cache.Set(ctx, notification.ID, failed); err != nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", notification.ID).Msg("Failed to update cache after failure")
+	}
+	s.publishStatus(ctx, failed)
+
+	return nil
+}
+
+// publishDeadLetter отправляет уведомление в очередь недоставленных. Статус failed уже сохранен,
+// поэтому ошибка публикации только логируется: уведомление доступно через ListFailed.
+func (s *notificationService) publishDeadLetter(ctx context.Context, failed *models.Notification, attempts int, lastErr string) {
+	deadLetter := models.DeadLetter{
+		Notification: *failed,
+		Attempts:     attempts,
+		Error:        lastErr,
+		FailedAt:     failed.UpdatedAt,
+	}
+	if err := s.queue.PublishDeadLetter(ctx, deadLetter); err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", failed.ID).Msg("Failed to publish dead letter")
+	}
+}
+
+// ackDeadLetters убирает из очереди недоставленных уведомления, отправленные на replay.
+// Replay уже выполнен, поэтому ошибка только логируется.
+func (s *notificationService) ackDeadLetters(ctx context.Context, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.queue.AckDeadLetters(ctx, ids); err != nil {
+		zlog.Logger.Error().Err(err).Strs("notification_ids", ids).Msg("Failed to ack dead letters after replay")
+	}
+}
+
+// ListFailed возвращает последние уведомления, которые не удалось доставить.
+func (s *notificationService) ListFailed(ctx context.Context, limit int) ([]*models.Notification, error) {
+	if limit <= 0 {
+		limit = defaultFailedLimit
+	}
+	notifications, err := s.repo.GetFailedNotifications(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// Replay возвращает уведомление в статус pending и ставит его в outbox для повторной публикации.
+func (s *notificationService) Replay(ctx context.Context, id string) (*models.Notification, error) {
+	notification, err := s.replay(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.ackDeadLetters(ctx, []string{id})
+	return notification, nil
+}
+
+// replay возвращает failed уведомление в pending, не трогая очередь недоставленных.
+func (s *notificationService) replay(ctx context.Context, id string) (*models.Notification, error) {
+	notification, err := s.repo.RequeueNotification(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay notification: %w", err)
+	}
+
+	if err := s.cache.Set(ctx, id, notification); err != nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to update cache after replay")
+	}
+	s.publishStatus(ctx, notification)
+
+	return notification, nil
+}
+
+// ReplayAllFailed повторно ставит в очередь все уведомления в статусе failed.
+func (s *notificationService) ReplayAllFailed(ctx context.Context) (int, error) {
+	replayed := 0
+	for {
+		notifications, err := s.repo.GetFailedNotifications(ctx, defaultFailedLimit)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to list failed notifications: %w", err)
+		}
+
+		var batchReplayed []string
+		for _, n := range notifications {
+			if _, err := s.replay(ctx, n.ID); err != nil {
+				zlog.Logger.Error().Err(err).Str("notification_id", n.ID).Msg("Failed to replay notification")
+				continue
+			}
+			batchReplayed = append(batchReplayed, n.ID)
+		}
+		// Очередь недоставленных вычищается один раз на пачку
+		s.ackDeadLetters(ctx, batchReplayed)
+		replayed += len(batchReplayed)
+
+		// Останавливаемся, если failed больше нет или ни одно не удалось переотправить
+		if len(notifications) < defaultFailedLimit || len(batchReplayed) == 0 {
+			return replayed, nil
+		}
+	}
+}
+
 // Вспомогательные методы
+
+// resolveTemplate находит шаблон запроса и проверяет, что его можно отрендерить с переданными переменными.
+func (s *notificationService) resolveTemplate(ctx context.Context, req *models.CreateNotificationRequest) (*models.Template, error) {
+	tpl, err := s.repo.GetTemplate(ctx, req.TemplateID, req.TemplateVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	if tpl.Channel != req.Channel {
+		return nil, fmt.Errorf("template channel %s does not match notification channel %s", tpl.Channel, req.Channel)
+	}
+	if _, err := renderTemplate(tpl, req.Variables); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// render возвращает копию уведомления с текстом, подставленным из шаблона. Разметку задает
+// шаблон, тема шаблона заменяет тему уведомления. Уведомления без шаблона отправляются как есть.
+func (s *notificationService) render(ctx context.Context, n *models.Notification) (*models.Notification, error) {
+	if n.TemplateID == "" {
+		return n, nil
+	}
+
+	tpl, err := s.repo.GetTemplate(ctx, n.TemplateID, n.TemplateVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	rendered, err := renderTemplate(tpl, n.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	outgoing := *n
+	outgoing.Message = rendered.Body
+	if rendered.Subject != "" {
+		outgoing.Subject = rendered.Subject
+	}
+	outgoing.ParseMode = rendered.ParseMode
+	return &outgoing, nil
+}
+
 func (s *notificationService) validateRequest(req *models.CreateNotificationRequest) error {
 	if req.UserID == "" {
 		return fmt.Errorf("user_id is required")
 	}
-	if req.Message == "" {
+	if req.Message == "" && req.TemplateID == "" {
 		return fmt.Errorf("message is required")
 	}
-	if req.Channel == "" {
+	if req.Channel == "" && len(req.Channels) == 0 {
 		return fmt.Errorf("channel is required")
 	}
+	if len(req.Channels) > 0 {
+		if req.Channel == "" {
+			req.Channel = req.Channels[0]
+		}
+		if req.Channel != req.Channels[0] {
+			return fmt.Errorf("channel must be the first element of channels")
+		}
+		seen := make(map[string]bool)
+		for _, channel := range req.Channels {
+			if seen[channel] {
+				return fmt.Errorf("duplicate channel in channels: %s", channel)
+			}
+			seen[channel] = true
+		}
+	}
+	if err := validateParseMode(req.ParseMode); err != nil {
+		return err
+	}
 	if req.SendAt.Before(time.Now().Add(1 * time.Minute)) {
 		return fmt.Errorf("send_at must be at least 1 minute in the future")
 	}
+	if req.Recurrence != nil {
+		if err := validateRecurrence(req.Recurrence, req.SendAt); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *notificationService) publishToQueue(ctx context.Context, notification *models.Notification) error {
-	delay := time.Until(notification.SendAt)
-	if delay < 0 {
-		delay = 0
+// validateParseMode проверяет разметку тела уведомления или шаблона
+func validateParseMode(mode string) error {
+	switch mode {
+	case "", models.ParseModeMarkdown, models.ParseModeMarkdownV2, models.ParseModeHTML:
+		return nil
 	}
+	return fmt.Errorf("unsupported parse_mode: %s", mode)
+}
 
-	data, err := json.Marshal(notification)
+// validateAttachments проверяет вложения: хотя бы один канал цепочки должен их доставлять,
+// у каждого вложения должно быть имя и ровно один источник - содержимое или http(s) URL.
+func (s *notificationService) validateAttachments(attachments []models.Attachment, channels []string) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	supported := false
+	for _, channel := range channels {
+		if sender, ok := s.notifiers[channel].(AttachmentSender); ok && sender.SendsAttachments() {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("attachments are not supported by channels %v", channels)
+	}
+	if len(attachments) > models.MaxAttachments {
+		return fmt.Errorf("at most %d attachments are allowed", models.MaxAttachments)
+	}
+
+	total := 0
+	for _, a := range attachments {
+		if a.Filename == "" {
+			return fmt.Errorf("attachment filename is required")
+		}
+		if (a.URL == "") == (len(a.Content) == 0) {
+			return fmt.Errorf("attachment %s must have either content or url", a.Filename)
+		}
+		if a.URL != "" {
+			u, err := url.Parse(a.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("attachment %s url must be an absolute http(s) URL", a.Filename)
+			}
+		}
+		total += len(a.Content)
+	}
+	if total > models.MaxAttachmentsSize {
+		return fmt.Errorf("attachments must not exceed %d bytes", models.MaxAttachmentsSize)
+	}
+	return nil
+}
+
+// DispatchOutbox публикует в очередь очередную пачку записей outbox, время отправки которых
+// наступает в пределах window, и возвращает количество успешно опубликованных.
+// Более поздние уведомления остаются в PostgreSQL: так задержка в очереди никогда не
+// превышает window, и короткие задержки не ждут за длинными в голове очереди.
+// Записи, которые не удалось опубликовать, будут захвачены повторно после истечения lease.
+func (s *notificationService) DispatchOutbox(ctx context.Context, batchSize int, window time.Duration) (int, error) {
+	messages, err := s.repo.ClaimOutboxBatch(ctx, batchSize, time.Now().Add(window), outboxLease)
 	if err != nil {
-		return fmt.Errorf("failed to marshal notification: %w", err)
+		return 0, fmt.Errorf("failed to claim outbox batch: %w", err)
+	}
+
+	dispatched := 0
+	for _, msg := range messages {
+		if err := s.publishToQueue(ctx, msg.Payload, msg.SendAt); err != nil {
+			zlog.Logger.Warn().Err(err).Str("notification_id", msg.NotificationID).Msg("Failed to publish outbox message, will retry")
+			continue
+		}
+		if err := s.repo.MarkOutboxDispatched(ctx, msg.ID); err != nil {
+			// Сообщение уже в очереди, повторная публикация будет отброшена проверкой статуса
+			zlog.Logger.Error().Err(err).Str("notification_id", msg.NotificationID).Msg("Failed to mark outbox message dispatched")
+			continue
+		}
+		metrics.NotificationsQueued.WithLabelValues(payloadChannel(msg.Payload)).Inc()
+		dispatched++
+	}
+
+	return dispatched, nil
+}
+
+// payloadChannel возвращает канал уведомления из payload записи outbox для меток метрик
+func payloadChannel(payload []byte) string {
+	var n struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return ""
+	}
+	return n.Channel
+}
+
+func (s *notificationService) publishToQueue(ctx context.Context, data []byte, sendAt time.Time) error {
+	delay := time.Until(sendAt)
+	if delay < 0 {
+		delay = 0
 	}
 	return s.queue.PublishWithDelay(ctx, "notifications", data, delay)
 }
@@ -3,11 +3,16 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/pozedorum/WB_project_3/task1/internal/metrics"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -18,7 +23,6 @@ func TestNotificationService_Create(t *testing.T) {
 		name        string
 		channel     string
 		repoErr     error
-		queueErr    error
 		wantErr     bool
 		errContains string
 	}{
@@ -33,13 +37,6 @@ func TestNotificationService_Create(t *testing.T) {
 			wantErr:     true,
 			errContains: "failed to create notification",
 		},
-		{
-			name:        "queue error",
-			channel:     "email",
-			queueErr:    errors.New("rabbitmq error"),
-			wantErr:     true,
-			errContains: "failed to publish to queue",
-		},
 		{
 			name:        "unsupported channel",
 			channel:     "telegram",
@@ -60,6 +57,7 @@ func TestNotificationService_Create(t *testing.T) {
 				cache,
 				queue,
 				[]Notifier{notifier},
+				nil,
 			)
 
 			req := &models.CreateNotificationRequest{
@@ -78,23 +76,6 @@ func TestNotificationService_Create(t *testing.T) {
 					cache.
 						On("Set", mock.Anything, mock.Anything, mock.Anything).
 						Return(nil)
-
-					queue.
-						On("PublishWithDelay",
-							mock.Anything,
-							"notifications",
-							mock.Anything,
-							mock.AnythingOfType("time.Duration")).
-						Return(tt.queueErr)
-
-					if tt.queueErr != nil {
-						repo.
-							On("UpdateNotificationStatus",
-								mock.Anything,
-								mock.AnythingOfType("string"),
-								models.StatusFailed).
-							Return(nil)
-					}
 				}
 			}
 
@@ -111,10 +92,402 @@ func TestNotificationService_Create(t *testing.T) {
 				assert.NotEmpty(t, notification.ID)
 				assert.Equal(t, models.StatusPending, notification.Status)
 			}
+
+			// Публикация в очередь выполняется relay, а не Create
+			queue.AssertNotCalled(t, "PublishWithDelay")
+		})
+	}
+}
+
+func TestNotificationService_DispatchOutbox(t *testing.T) {
+	messages := []models.OutboxMessage{
+		{ID: 1, NotificationID: "id-1", Payload: []byte(`{"id":"id-1"}`), SendAt: time.Now().Add(time.Minute)},
+		{ID: 2, NotificationID: "id-2", Payload: []byte(`{"id":"id-2"}`), SendAt: time.Now().Add(-time.Minute)},
+	}
+
+	tests := []struct {
+		name           string
+		claimErr       error
+		publishErr     error
+		wantDispatched int
+		wantErr        bool
+	}{
+		{
+			name:           "success",
+			wantDispatched: 2,
+		},
+		{
+			name:           "publish error leaves messages in outbox",
+			publishErr:     errors.New("rabbitmq error"),
+			wantDispatched: 0,
+		},
+		{
+			name:     "claim error",
+			claimErr: errors.New("db error"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			queue := new(testsutils.MockQueue)
+
+			// Захватываются только записи, которые нужно отправить в пределах окна
+			dueBefore := mock.MatchedBy(func(due time.Time) bool {
+				return due.After(time.Now().Add(50*time.Second)) && due.Before(time.Now().Add(time.Minute))
+			})
+
+			if tt.claimErr != nil {
+				repo.On("ClaimOutboxBatch", mock.Anything, 10, dueBefore, outboxLease).Return(nil, tt.claimErr)
+			} else {
+				repo.On("ClaimOutboxBatch", mock.Anything, 10, dueBefore, outboxLease).Return(messages, nil)
+
+				queue.
+					On("PublishWithDelay", mock.Anything, "notifications", messages[0].Payload, mock.MatchedBy(func(d time.Duration) bool {
+						return d > 0
+					})).
+					Return(tt.publishErr)
+				queue.
+					On("PublishWithDelay", mock.Anything, "notifications", messages[1].Payload, time.Duration(0)).
+					Return(tt.publishErr)
+
+				if tt.publishErr == nil {
+					repo.On("MarkOutboxDispatched", mock.Anything, int64(1)).Return(nil)
+					repo.On("MarkOutboxDispatched", mock.Anything, int64(2)).Return(nil)
+				}
+			}
+
+			service := NewNotificationService(repo, cache, queue, nil, nil)
+
+			n, err := service.DispatchOutbox(context.Background(), 10, time.Minute)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantDispatched, n)
+			}
+
+			repo.AssertExpectations(t)
+			queue.AssertExpectations(t)
+			if tt.publishErr != nil {
+				repo.AssertNotCalled(t, "MarkOutboxDispatched", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestNotificationService_Create_Idempotency(t *testing.T) {
+	original := &models.Notification{ID: "id-1", UserID: "user-1", Status: models.StatusPending, IdempotencyKey: "key-1"}
+
+	tests := []struct {
+		name  string
+		setup func(repo *testsutils.MockRepository, cache *testsutils.MockCache)
+	}{
+		{
+			name: "repeated request",
+			setup: func(repo *testsutils.MockRepository, cache *testsutils.MockCache) {
+				repo.On("GetByIdempotencyKey", mock.Anything, "user-1", "key-1").Return(original, nil).Once()
+			},
+		},
+		{
+			name: "concurrent request wins the race",
+			setup: func(repo *testsutils.MockRepository, cache *testsutils.MockCache) {
+				repo.On("GetByIdempotencyKey", mock.Anything, "user-1", "key-1").Return(nil, nil).Once()
+				repo.
+					On("CreateNotification", mock.Anything, mock.MatchedBy(func(n *models.Notification) bool {
+						return n.IdempotencyKey == "key-1"
+					})).
+					Return(fmt.Errorf("insert: %w", models.ErrDuplicateIdempotencyKey))
+				repo.On("GetByIdempotencyKey", mock.Anything, "user-1", "key-1").Return(original, nil).Once()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			queue := new(testsutils.MockQueue)
+			tt.setup(repo, cache)
+
+			service := NewNotificationService(repo, cache, queue, []Notifier{&testsutils.MockNotifier{Channel: "email"}}, nil)
+
+			n, err := service.Create(context.Background(), &models.CreateNotificationRequest{
+				UserID:         "user-1",
+				Message:        "hello",
+				Channel:        "email",
+				SendAt:         time.Now().Add(2 * time.Minute),
+				IdempotencyKey: "key-1",
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, "id-1", n.ID)
+			repo.AssertExpectations(t)
+			cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestNotificationService_Create_WithTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    *models.Template
+		variables   map[string]string
+		errContains string
+	}{
+		{
+			name:      "pins latest template version",
+			template:  &models.Template{ID: "tpl-1", Version: 3, Channel: "email", Body: "Hi {{.name}}"},
+			variables: map[string]string{"name": "Ann"},
+		},
+		{
+			name:        "channel mismatch",
+			template:    &models.Template{ID: "tpl-1", Version: 3, Channel: "telegram", Body: "Hi"},
+			errContains: "does not match notification channel",
+		},
+		{
+			name:        "missing variable",
+			template:    &models.Template{ID: "tpl-1", Version: 3, Channel: "email", Body: "Hi {{.name}}"},
+			errContains: "failed to render body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			queue := new(testsutils.MockQueue)
+			notifier := &testsutils.MockNotifier{Channel: "email"}
+
+			repo.On("GetTemplate", mock.Anything, "tpl-1", 0).Return(tt.template, nil)
+			repo.
+				On("CreateNotification", mock.Anything, mock.AnythingOfType("*models.Notification")).
+				Return(nil)
+			cache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+			n, err := service.Create(context.Background(), &models.CreateNotificationRequest{
+				UserID:     "user-1",
+				Channel:    "email",
+				SendAt:     time.Now().Add(2 * time.Minute),
+				TemplateID: "tpl-1",
+				Variables:  tt.variables,
+			})
+
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				repo.AssertNotCalled(t, "CreateNotification", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "tpl-1", n.TemplateID)
+			assert.Equal(t, 3, n.TemplateVersion)
 		})
 	}
 }
 
+// attachmentNotifier - нотификатор, доставляющий вложения
+type attachmentNotifier struct {
+	testsutils.MockNotifier
+}
+
+func (n *attachmentNotifier) SendsAttachments() bool {
+	return true
+}
+
+func TestNotificationService_Create_EmailContent(t *testing.T) {
+	report := models.Attachment{Filename: "report.pdf", URL: "https://files.example.com/report.pdf"}
+
+	tests := []struct {
+		name        string
+		req         models.CreateNotificationRequest
+		errContains string
+	}{
+		{
+			name: "subject, html and attachments",
+			req: models.CreateNotificationRequest{Channel: "email", Subject: "Отчет", ParseMode: models.ParseModeHTML,
+				Attachments: []models.Attachment{report, {Filename: "notes.txt", Content: []byte("notes")}}},
+		},
+		{
+			name:        "channel without attachments",
+			req:         models.CreateNotificationRequest{Channel: "telegram", Attachments: []models.Attachment{report}},
+			errContains: "attachments are not supported",
+		},
+		{
+			name: "attachment without source",
+			req: models.CreateNotificationRequest{Channel: "email",
+				Attachments: []models.Attachment{{Filename: "empty.txt"}}},
+			errContains: "must have either content or url",
+		},
+		{
+			name: "attachment with relative url",
+			req: models.CreateNotificationRequest{Channel: "email",
+				Attachments: []models.Attachment{{Filename: "a.pdf", URL: "/files/a.pdf"}}},
+			errContains: "absolute http(s) URL",
+		},
+		{
+			name:        "unsupported parse mode",
+			req:         models.CreateNotificationRequest{Channel: "email", ParseMode: "BBCode"},
+			errContains: "unsupported parse_mode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			email := &attachmentNotifier{testsutils.MockNotifier{Channel: "email"}}
+			telegram := &testsutils.MockNotifier{Channel: "telegram"}
+
+			repo.
+				On("CreateNotification", mock.Anything, mock.AnythingOfType("*models.Notification")).
+				Return(nil)
+			cache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			service := NewNotificationService(repo, cache, new(testsutils.MockQueue), []Notifier{email, telegram}, nil)
+
+			req := tt.req
+			req.UserID = "user@example.com"
+			req.Message = "<p>hello</p>"
+			req.SendAt = time.Now().Add(2 * time.Minute)
+			n, err := service.Create(context.Background(), &req)
+
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				repo.AssertNotCalled(t, "CreateNotification", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.req.Subject, n.Subject)
+			assert.Equal(t, tt.req.ParseMode, n.ParseMode)
+			assert.Equal(t, tt.req.Attachments, n.Attachments)
+		})
+	}
+}
+
+func TestNotificationService_Update(t *testing.T) {
+	sendAt := time.Now().Add(time.Hour)
+	newSendAt := time.Now().Add(2 * time.Hour)
+	past := time.Now().Add(-time.Minute)
+	message := "fixed typo"
+	telegram := "telegram"
+
+	tests := []struct {
+		name    string
+		current *models.Notification
+		req     models.UpdateNotificationRequest
+		wantErr error
+		errText string
+	}{
+		{
+			name: "reschedule and edit",
+			current: &models.Notification{
+				ID: "id-1", UserID: "1", Message: "fixd typo", Channel: "email",
+				Channels: []string{"email", "telegram"}, SendAt: sendAt, Status: models.StatusPending, Version: 2,
+			},
+			req: models.UpdateNotificationRequest{Message: &message, Channel: &telegram, SendAt: &newSendAt, Version: 2},
+		},
+		{
+			name:    "not found",
+			wantErr: models.ErrNotFound,
+		},
+		{
+			name:    "not pending",
+			current: &models.Notification{ID: "id-1", Status: models.StatusSent, Version: 1},
+			req:     models.UpdateNotificationRequest{Message: &message},
+			wantErr: models.ErrNotPending,
+		},
+		{
+			name:    "version conflict",
+			current: &models.Notification{ID: "id-1", Status: models.StatusPending, Version: 3},
+			req:     models.UpdateNotificationRequest{Message: &message, Version: 2},
+			wantErr: models.ErrVersionConflict,
+		},
+		{
+			name:    "send_at in the past",
+			current: &models.Notification{ID: "id-1", Status: models.StatusPending, Version: 1},
+			req:     models.UpdateNotificationRequest{SendAt: &past},
+			errText: "send_at must be at least 1 minute in the future",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			queue := new(testsutils.MockQueue)
+			notifiers := []Notifier{
+				&testsutils.MockNotifier{Channel: "email"},
+				&testsutils.MockNotifier{Channel: "telegram"},
+			}
+
+			repo.On("GetByID", mock.Anything, "id-1").Return(tt.current, nil)
+			success := tt.wantErr == nil && tt.errText == ""
+			if success {
+				repo.
+					On("UpdateNotification", mock.Anything, mock.MatchedBy(func(n *models.Notification) bool {
+						return n.Version == 3 &&
+							n.Message == message &&
+							n.Channel == "telegram" &&
+							n.Channels == nil &&
+							n.SendAt.Equal(newSendAt)
+					}), 2).
+					Return(nil)
+				cache.
+					On("Set", mock.Anything, "id-1", mock.MatchedBy(func(n *models.Notification) bool {
+						return n.Version == 3 && n.Message == message
+					})).
+					Return(nil)
+			}
+
+			service := NewNotificationService(repo, cache, queue, notifiers, nil)
+
+			n, err := service.Update(context.Background(), "id-1", &tt.req)
+
+			if !success {
+				require.Error(t, err)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				} else {
+					assert.Contains(t, err.Error(), tt.errText)
+				}
+				repo.AssertNotCalled(t, "UpdateNotification", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 3, n.Version)
+			repo.AssertExpectations(t)
+			cache.AssertExpectations(t)
+			assert.Equal(t, 2, tt.current.Version, "current notification must not be modified")
+		})
+	}
+}
+
+func TestNotificationService_ProcessNotification_IgnoresStaleVersion(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	queued := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending, Version: 1}
+	current := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending, Version: 2}
+
+	cache.On("Get", mock.Anything, "id-1").Return(current, nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), queued)
+
+	assert.ErrorIs(t, err, models.ErrStaleVersion)
+	notifier.AssertNotCalled(t, "Send", mock.Anything)
+}
+
 func TestNotificationService_GetByID(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -144,7 +517,7 @@ func TestNotificationService_GetByID(t *testing.T) {
 
 			cache.
 				On("Get", mock.Anything, "id-1").
-				Return((*models.Notification)(nil), errors.New("cache miss"))
+				Return((*models.Notification)(nil), models.ErrCacheMiss)
 
 			repo.
 				On("GetByID", mock.Anything, "id-1").
@@ -156,7 +529,7 @@ func TestNotificationService_GetByID(t *testing.T) {
 					Return(nil)
 			}
 
-			service := NewNotificationService(repo, cache, queue, nil)
+			service := NewNotificationService(repo, cache, queue, nil, nil)
 
 			n, err := service.GetByID(context.Background(), "id-1")
 
@@ -231,9 +604,15 @@ func TestNotificationService_Delete(t *testing.T) {
 			queue := new(testsutils.MockQueue)
 
 			// Первый вызов всегда идет в кэш
-			cache.
-				On("Get", mock.Anything, "id-1").
-				Return(tt.cacheNotification, nil)
+			if tt.cacheNotification != nil {
+				cache.
+					On("Get", mock.Anything, "id-1").
+					Return(tt.cacheNotification, nil)
+			} else {
+				cache.
+					On("Get", mock.Anything, "id-1").
+					Return(nil, models.ErrCacheMiss)
+			}
 
 			notification := tt.cacheNotification
 
@@ -245,7 +624,7 @@ func TestNotificationService_Delete(t *testing.T) {
 
 				notification = tt.repoNotification
 
-				// GetByID асинхронно обновляет кэш
+				// GetByID кэширует прочитанное из БД
 				if notification != nil {
 					cache.
 						On("Set", mock.Anything, "id-1", mock.Anything).
@@ -263,12 +642,12 @@ func TestNotificationService_Delete(t *testing.T) {
 
 				if tt.deleteErr == nil {
 					cache.
-						On("Set", mock.Anything, "id-1", nil).
+						On("Tombstone", mock.Anything, "id-1").
 						Return(nil)
 				}
 			}
 
-			service := NewNotificationService(repo, cache, queue, nil)
+			service := NewNotificationService(repo, cache, queue, nil, nil)
 
 			err := service.Delete(context.Background(), "id-1")
 
@@ -327,7 +706,7 @@ func TestNotificationService_ProcessNotification(t *testing.T) {
 				notifiers = []Notifier{notifier}
 			}
 
-			service := NewNotificationService(repo, cache, queue, notifiers)
+			service := NewNotificationService(repo, cache, queue, notifiers, nil)
 
 			n := &models.Notification{
 				ID:      "id-1",
@@ -336,17 +715,24 @@ func TestNotificationService_ProcessNotification(t *testing.T) {
 			}
 
 			cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+			repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
 
-			if tt.status == models.StatusPending && tt.notifier {
-				repo.
-					On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent).
-					Return(nil)
-
+			if tt.status == models.StatusPending {
+				repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+				repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+				repo.On("ReleaseNotification", mock.Anything, "id-1").Return(nil, nil)
+				// Захват и отправка записываются в кэш
 				cache.
 					On("Set", mock.Anything, "id-1", n).
 					Return(nil)
 			}
 
+			if tt.status == models.StatusPending && tt.notifier {
+				repo.
+					On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).
+					Return(n, nil)
+			}
+
 			err := service.ProcessNotification(context.Background(), n)
 
 			if tt.wantErr {
@@ -359,12 +745,654 @@ func TestNotificationService_ProcessNotification(t *testing.T) {
 	}
 }
 
+func TestNotificationService_ProcessNotification_LoadsAttachmentContents(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	email := &attachmentNotifier{testsutils.MockNotifier{Channel: "email"}}
+
+	n := &models.Notification{
+		ID:      "id-1",
+		UserID:  "user@example.com",
+		Channel: "email",
+		Status:  models.StatusPending,
+		Attachments: []models.Attachment{
+			{ID: "att-1", Filename: "report.pdf"},
+			{Filename: "logo.png", URL: "https://files.example.com/logo.png"},
+		},
+	}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", mock.Anything).Return(nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	repo.On("GetAttachmentContents", mock.Anything, "id-1").Return(map[string][]byte{"att-1": []byte("%PDF-report")}, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+	repo.On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).Return(n, nil)
+
+	var sent *models.Notification
+	email.On("Send", mock.Anything).Run(func(args mock.Arguments) {
+		sent = args.Get(0).(*models.Notification)
+	}).Return(nil)
+
+	service := NewNotificationService(repo, cache, new(testsutils.MockQueue), []Notifier{email}, nil)
+	require.NoError(t, service.ProcessNotification(context.Background(), n))
+
+	require.NotNil(t, sent)
+	require.Len(t, sent.Attachments, 2)
+	assert.Equal(t, []byte("%PDF-report"), sent.Attachments[0].Content)
+	assert.Empty(t, sent.Attachments[1].Content)
+	// Содержимое не попадает в уведомление, которое сохраняется в кэше
+	assert.Empty(t, n.Attachments[0].Content)
+}
+
+func TestNotificationService_ProcessNotification_SchedulesNextOccurrence(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	sendAt := time.Now().Add(-time.Second)
+	n := &models.Notification{
+		ID:         "id-1",
+		UserID:     "user-1",
+		Message:    "daily digest",
+		Channel:    "email",
+		Status:     models.StatusPending,
+		SendAt:     sendAt,
+		SeriesID:   "id-1",
+		Recurrence: &models.Recurrence{Cron: "0 9 * * *", Start: sendAt},
+		Occurrence: 1,
+	}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	cache.On("Set", mock.Anything, "id-1", n).Return(nil)
+	notifier.On("Send", n).Return(nil)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+	// Следующий повтор строится внутри транзакции, которая ставит статус sent
+	var next *models.Notification
+	repo.On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).
+		Run(func(args mock.Arguments) {
+			next = args.Get(3).(models.NextOccurrenceFunc)(n)
+		}).
+		Return(n, nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "CreateNotification", mock.Anything, mock.Anything)
+	require.NotNil(t, next)
+	assert.NotEqual(t, "id-1", next.ID)
+	assert.Equal(t, "id-1", next.SeriesID)
+	assert.Equal(t, 2, next.Occurrence)
+	assert.Equal(t, models.StatusPending, next.Status)
+	assert.True(t, next.SendAt.After(time.Now()))
+	assert.Equal(t, "daily digest", next.Message)
+}
+
+func TestNotificationService_FailNotification_SchedulesNextOccurrence(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	sendAt := time.Now().Add(-time.Second)
+	failed := &models.Notification{
+		ID:         "id-1",
+		Channel:    "email",
+		Status:     models.StatusFailed,
+		SendAt:     sendAt,
+		SeriesID:   "id-1",
+		Recurrence: &models.Recurrence{Cron: "0 9 * * *", Count: 3, Start: sendAt},
+		Occurrence: 2,
+	}
+
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	var next *models.Notification
+	repo.On("MarkNotificationFailed", mock.Anything, "id-1", "smtp down", mock.Anything).
+		Run(func(args mock.Arguments) {
+			next = args.Get(3).(models.NextOccurrenceFunc)(failed)
+		}).
+		Return(failed, nil)
+	cache.On("Set", mock.Anything, "id-1", failed).Return(nil)
+	queue.On("PublishDeadLetter", mock.Anything, mock.Anything).Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	err := service.FailNotification(context.Background(), &models.Notification{ID: "id-1", Channel: "email"}, 5, errors.New("smtp down"))
+
+	require.NoError(t, err)
+	require.NotNil(t, next, "a failed occurrence must not end the series")
+	assert.Equal(t, 3, next.Occurrence)
+	assert.Equal(t, models.StatusPending, next.Status)
+
+	// Последний повтор серии следующего не создает
+	failed.Occurrence = 3
+	assert.Nil(t, buildNextOccurrence(failed))
+}
+
+func TestNotificationService_Delete_CancelsSeries(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	// Передан ID уже отправленного первого уведомления серии
+	cache.On("Get", mock.Anything, "id-1").Return(&models.Notification{
+		ID:       "id-1",
+		Status:   models.StatusSent,
+		SeriesID: "id-1",
+	}, nil)
+	repo.On("DeleteSeries", mock.Anything, "id-1").Return([]string{"id-3"}, nil)
+	cache.On("Tombstone", mock.Anything, "id-3").Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	err := service.Delete(context.Background(), "id-1")
+
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+	cache.AssertExpectations(t)
+	repo.AssertNotCalled(t, "DeleteNotification", mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_Delete_SeriesWithoutLiveOccurrences(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	cache.On("Get", mock.Anything, "id-1").Return(&models.Notification{
+		ID:       "id-1",
+		Status:   models.StatusSent,
+		SeriesID: "id-1",
+	}, nil)
+	repo.On("DeleteSeries", mock.Anything, "id-1").Return([]string(nil), models.ErrNotPending)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	err := service.Delete(context.Background(), "id-1")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no pending notifications")
+	cache.AssertNotCalled(t, "Tombstone", mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_ProcessNotification_RendersTemplate(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "telegram"}
+
+	n := &models.Notification{
+		ID:              "id-1",
+		Channel:         "telegram",
+		Status:          models.StatusPending,
+		TemplateID:      "tpl-1",
+		TemplateVersion: 2,
+		Variables:       map[string]string{"name": "Ann"},
+	}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	cache.On("Set", mock.Anything, "id-1", n).Return(nil)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+	repo.On("GetTemplate", mock.Anything, "tpl-1", 2).Return(&models.Template{
+		ID:        "tpl-1",
+		Version:   2,
+		Body:      "*Hi {{.name}}*",
+		ParseMode: models.ParseModeMarkdown,
+	}, nil)
+	repo.On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).Return(n, nil)
+	notifier.
+		On("Send", mock.MatchedBy(func(out *models.Notification) bool {
+			return out.Message == "*Hi Ann*" && out.ParseMode == models.ParseModeMarkdown
+		})).
+		Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.NoError(t, err)
+	notifier.AssertExpectations(t)
+	assert.Empty(t, n.Message, "stored notification must not be modified by rendering")
+}
+
+func TestNotificationService_ProcessNotification_SendErrorKeepsPending(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	n := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending}
+
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", n).Return(nil)
+	notifier.On("Send", n).Return(errors.New("smtp down"))
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+	repo.On("ReleaseNotification", mock.Anything, "id-1").Return(nil, nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to send notification")
+	// Захват снимается, чтобы воркер мог повторить попытку
+	repo.AssertCalled(t, "ReleaseNotification", mock.Anything, "id-1")
+	// Статус failed выставляется только после исчерпания попыток в воркере
+	repo.AssertNotCalled(t, "UpdateNotificationStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_ProcessNotification_RecordsMetrics(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	// Отдельный канал, чтобы счетчики не зависели от других тестов
+	notifier := &testsutils.MockNotifier{Channel: "metrics"}
+
+	n := &models.Notification{ID: "id-1", Channel: "metrics", Status: models.StatusPending, SendAt: time.Now().Add(-time.Second)}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", mock.Anything).Return(nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+	repo.On("ReleaseNotification", mock.Anything, "id-1").Return(nil, nil)
+	repo.On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).Return(n, nil)
+	notifier.On("Send", mock.Anything).Return(errors.New("provider down")).Once()
+	notifier.On("Send", mock.Anything).Return(nil).Once()
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	sent := testutil.ToFloat64(metrics.NotificationsSent.WithLabelValues("metrics"))
+	failedSends := sampleCount(t, metrics.SendDuration.WithLabelValues("metrics", metrics.ResultError))
+	lag := sampleCount(t, metrics.QueueLag.WithLabelValues("metrics"))
+
+	require.Error(t, service.ProcessNotification(context.Background(), n))
+	require.NoError(t, service.ProcessNotification(context.Background(), n))
+
+	assert.Equal(t, sent+1, testutil.ToFloat64(metrics.NotificationsSent.WithLabelValues("metrics")))
+	assert.Equal(t, failedSends+1, sampleCount(t, metrics.SendDuration.WithLabelValues("metrics", metrics.ResultError)))
+	// Отставание от send_at учитывается только для доставленных
+	assert.Equal(t, lag+1, sampleCount(t, metrics.QueueLag.WithLabelValues("metrics")))
+}
+
+// sampleCount возвращает число наблюдений гистограммы
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var m dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestNotificationService_ProcessNotification_SkipsWhenClaimedByAnotherWorker(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	// Кэш еще не знает, что уведомление уже отправляется другим воркером
+	n := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending, Version: 2}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 2, sendLease).Return(nil, models.ErrNotPending)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.ErrorIs(t, err, models.ErrNotPending)
+	notifier.AssertNotCalled(t, "Send", mock.Anything)
+	repo.AssertNotCalled(t, "ReleaseNotification", mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_RecoverStuck(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	stuck := &models.Notification{ID: "id-1", Status: models.StatusFailed, LastError: stuckSendError}
+
+	repo.On("RecoverStuckNotifications", mock.Anything, stuckSendError, mock.Anything).Return([]*models.Notification{stuck}, nil)
+	queue.
+		On("PublishDeadLetter", mock.Anything, mock.MatchedBy(func(dl models.DeadLetter) bool {
+			return dl.Notification.ID == "id-1" && dl.Error == stuckSendError
+		})).
+		Return(nil)
+	cache.On("Set", mock.Anything, "id-1", stuck).Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	recovered, err := service.RecoverStuck(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	repo.AssertExpectations(t)
+	queue.AssertExpectations(t)
+	cache.AssertExpectations(t)
+}
+
+func TestNotificationService_ProcessNotification_UsesPreferredContact(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	telegram := &testsutils.MockNotifier{Channel: "telegram"}
+
+	// Канал уже переключен на резервный после исчерпания попыток на email
+	n := &models.Notification{
+		ID:       "id-1",
+		UserID:   "user-1",
+		Message:  "hi",
+		Channel:  "telegram",
+		Channels: []string{"email", "telegram"},
+		Status:   models.StatusPending,
+	}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", n).Return(nil)
+	repo.On("GetPreferences", mock.Anything, "user-1").Return(&models.UserPreferences{
+		UserID:   "user-1",
+		Contacts: map[string]string{"email": "ann@example.com", "telegram": "12345"},
+	}, nil)
+	repo.On("ClaimNotification", mock.Anything, "id-1", 0, sendLease).Return(n, nil)
+	repo.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.Attempt")).Return(nil)
+	repo.On("UpdateNotificationStatus", mock.Anything, "id-1", models.StatusSent, mock.Anything).Return(n, nil)
+	telegram.
+		On("Send", mock.MatchedBy(func(out *models.Notification) bool {
+			return out.UserID == "12345" && out.Channel == "telegram"
+		})).
+		Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{telegram}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.NoError(t, err)
+	telegram.AssertExpectations(t)
+	assert.Equal(t, "telegram", n.Channel, "stored channel records the delivering channel")
+}
+
+func TestNotificationService_FailNotification_SwitchesChannel(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        *models.Notification
+		prefs    *models.UserPreferences
+		wantNext string
+	}{
+		{
+			name: "explicit chain",
+			n: &models.Notification{
+				ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusPending,
+				Channels: []string{"email", "webhook", "telegram"},
+			},
+			// webhook не зарегистрирован и пропускается
+			wantNext: "telegram",
+		},
+		{
+			name: "chain from preferences",
+			n:    &models.Notification{ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusPending},
+			prefs: &models.UserPreferences{
+				UserID:   "user-1",
+				Contacts: map[string]string{"email": "ann@example.com", "telegram": "12345"},
+				Channels: []string{"telegram"},
+			},
+			wantNext: "telegram",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			queue := new(testsutils.MockQueue)
+			notifiers := []Notifier{
+				&testsutils.MockNotifier{Channel: "email"},
+				&testsutils.MockNotifier{Channel: "telegram"},
+			}
+
+			if tt.prefs != nil {
+				repo.On("GetPreferences", mock.Anything, "user-1").Return(tt.prefs, nil)
+			}
+			repo.
+				On("SwitchChannel", mock.Anything, mock.MatchedBy(func(n *models.Notification) bool {
+					return n.Channel == tt.wantNext && n.Channels[0] == "email" && n.LastError == "smtp down"
+				})).
+				Return(nil)
+			// В кэш попадает состояние из базы с актуальным счетчиком попыток
+			current := &models.Notification{ID: "id-1", Channel: tt.wantNext, Status: models.StatusPending, Attempts: 3, Revision: 5}
+			repo.On("GetByID", mock.Anything, "id-1").Return(current, nil)
+			cache.On("Set", mock.Anything, "id-1", current).Return(nil)
+
+			service := NewNotificationService(repo, cache, queue, notifiers, nil)
+
+			err := service.FailNotification(context.Background(), tt.n, 3, errors.New("smtp down"))
+
+			require.NoError(t, err)
+			repo.AssertExpectations(t)
+			repo.AssertNotCalled(t, "MarkNotificationFailed", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			queue.AssertNotCalled(t, "PublishDeadLetter", mock.Anything, mock.Anything)
+			cache.AssertExpectations(t)
+			assert.Equal(t, "email", tt.n.Channel, "original notification must not be modified")
+		})
+	}
+}
+
+func TestNotificationService_FailNotification_SkipsChannelsWithoutTemplate(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifiers := []Notifier{
+		&testsutils.MockNotifier{Channel: "email"},
+		&testsutils.MockNotifier{Channel: "telegram"},
+	}
+
+	n := &models.Notification{
+		ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusPending,
+		Channels:   []string{"email", "telegram"},
+		TemplateID: "tpl-1", TemplateVersion: 1, Variables: map[string]string{"name": "Анна"},
+	}
+
+	// Шаблон только для email: в telegram уведомление не переключается
+	repo.On("GetTemplate", mock.Anything, "tpl-1", 1).
+		Return(&models.Template{ID: "tpl-1", Version: 1, Channel: "email", Body: "Привет, {{.name}}"}, nil)
+	failed := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusFailed, Attempts: 3, LastError: "smtp down"}
+	repo.On("MarkNotificationFailed", mock.Anything, "id-1", "smtp down", mock.Anything).Return(failed, nil)
+	queue.On("PublishDeadLetter", mock.Anything, mock.Anything).Return(nil)
+	cache.On("Set", mock.Anything, "id-1", failed).Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, notifiers, nil)
+
+	err := service.FailNotification(context.Background(), n, 3, errors.New("smtp down"))
+
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "SwitchChannel", mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_ProcessNotification_DefersInQuietHours(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+	notifier := &testsutils.MockNotifier{Channel: "email"}
+
+	n := &models.Notification{ID: "id-1", UserID: "user-1", Channel: "email", Status: models.StatusPending}
+
+	// Тихие часы покрывают текущий момент: с прошлого часа до следующего
+	now := time.Now().UTC()
+	quiet := &models.QuietHours{
+		Start: now.Add(-time.Hour).Format("15:04"),
+		End:   now.Add(time.Hour).Format("15:04"),
+	}
+
+	cache.On("Get", mock.Anything, "id-1").Return(n, nil)
+	cache.On("Set", mock.Anything, "id-1", mock.Anything).Return(nil)
+	repo.On("GetPreferences", mock.Anything, "user-1").Return(&models.UserPreferences{
+		UserID:     "user-1",
+		Contacts:   map[string]string{"email": "ann@example.com"},
+		QuietHours: quiet,
+	}, nil)
+	repo.
+		On("RescheduleNotification", mock.Anything, mock.MatchedBy(func(deferred *models.Notification) bool {
+			return deferred.ID == "id-1" && deferred.SendAt.After(now)
+		})).
+		Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, []Notifier{notifier}, nil)
+
+	err := service.ProcessNotification(context.Background(), n)
+
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+	notifier.AssertNotCalled(t, "Send", mock.Anything)
+}
+
+func TestNotificationService_FailNotification(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	n := &models.Notification{ID: "id-1", Channel: "email", Status: models.StatusPending}
+
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	failed := &models.Notification{
+		ID:        "id-1",
+		Channel:   "email",
+		Status:    models.StatusFailed,
+		Attempts:  5,
+		LastError: "smtp down",
+	}
+	repo.On("MarkNotificationFailed", mock.Anything, "id-1", "smtp down", mock.Anything).Return(failed, nil)
+	queue.
+		On("PublishDeadLetter", mock.Anything, mock.MatchedBy(func(dl models.DeadLetter) bool {
+			return dl.Notification.ID == "id-1" &&
+				dl.Notification.Status == models.StatusFailed &&
+				dl.Notification.Attempts == 5 &&
+				dl.Attempts == 5 &&
+				dl.Error == "smtp down"
+		})).
+		Return(nil)
+	cache.On("Set", mock.Anything, "id-1", failed).Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	err := service.FailNotification(context.Background(), n, 5, errors.New("smtp down"))
+
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+	queue.AssertExpectations(t)
+	assert.Equal(t, models.StatusPending, n.Status, "original notification must not be modified")
+}
+
+func TestNotificationService_FailNotification_AlreadyFinished(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	repo.On("GetPreferences", mock.Anything, mock.Anything).Return(nil, models.ErrPreferencesNotFound)
+	repo.On("MarkNotificationFailed", mock.Anything, "id-1", "smtp down", mock.Anything).Return(nil, models.ErrNotPending)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	err := service.FailNotification(context.Background(), &models.Notification{ID: "id-1", Channel: "email"}, 5, errors.New("smtp down"))
+
+	require.NoError(t, err)
+	queue.AssertNotCalled(t, "PublishDeadLetter", mock.Anything, mock.Anything)
+	cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestNotificationService_Replay(t *testing.T) {
+	tests := []struct {
+		name       string
+		requeueErr error
+		wantErr    error
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:       "not failed",
+			requeueErr: models.ErrNotFailed,
+			wantErr:    models.ErrNotFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			cache := new(testsutils.MockCache)
+			queue := new(testsutils.MockQueue)
+
+			requeued := &models.Notification{ID: "id-1", Status: models.StatusPending}
+			if tt.requeueErr != nil {
+				repo.On("RequeueNotification", mock.Anything, "id-1").Return(nil, tt.requeueErr)
+			} else {
+				repo.On("RequeueNotification", mock.Anything, "id-1").Return(requeued, nil)
+				cache.On("Set", mock.Anything, "id-1", requeued).Return(nil)
+				queue.On("AckDeadLetters", mock.Anything, []string{"id-1"}).Return(nil)
+			}
+
+			service := NewNotificationService(repo, cache, queue, nil, nil)
+
+			n, err := service.Replay(context.Background(), "id-1")
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, n)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, models.StatusPending, n.Status)
+			}
+
+			// Публикация происходит через outbox, а не напрямую; запись очереди недоставленных
+			// убирается только после успешного replay
+			queue.AssertNotCalled(t, "PublishWithDelay")
+			queue.AssertExpectations(t)
+			if tt.wantErr != nil {
+				queue.AssertNotCalled(t, "AckDeadLetters", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestNotificationService_ReplayAllFailed(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	cache := new(testsutils.MockCache)
+	queue := new(testsutils.MockQueue)
+
+	failed := []*models.Notification{
+		{ID: "id-1", Status: models.StatusFailed},
+		{ID: "id-2", Status: models.StatusFailed},
+	}
+
+	repo.On("GetFailedNotifications", mock.Anything, defaultFailedLimit).Return(failed, nil)
+	repo.On("RequeueNotification", mock.Anything, "id-1").Return(&models.Notification{ID: "id-1", Status: models.StatusPending}, nil)
+	repo.On("RequeueNotification", mock.Anything, "id-2").Return(nil, models.ErrNotFailed)
+	cache.On("Set", mock.Anything, "id-1", mock.Anything).Return(nil)
+	queue.On("AckDeadLetters", mock.Anything, []string{"id-1"}).Return(nil)
+
+	service := NewNotificationService(repo, cache, queue, nil, nil)
+
+	replayed, err := service.ReplayAllFailed(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	repo.AssertNumberOfCalls(t, "GetFailedNotifications", 1)
+	queue.AssertNumberOfCalls(t, "AckDeadLetters", 1)
+}
+
 func TestNotificationService_ProcessNotificationData_InvalidJSON(t *testing.T) {
 	service := NewNotificationService(
 		new(testsutils.MockRepository),
 		new(testsutils.MockCache),
 		new(testsutils.MockQueue),
 		nil,
+		nil,
 	)
 
 	err := service.ProcessNotificationData(context.Background(), []byte("{"))
@@ -427,6 +1455,36 @@ func TestNotificationService_validateRequest(t *testing.T) {
 			},
 			wantErr: "send_at must be at least 1 minute in the future",
 		},
+		{
+			name: "channel chain without channel",
+			req: &models.CreateNotificationRequest{
+				UserID:   "1",
+				Message:  "hello",
+				Channels: []string{"telegram", "email"},
+				SendAt:   time.Now().Add(2 * time.Minute),
+			},
+		},
+		{
+			name: "channel is not first in chain",
+			req: &models.CreateNotificationRequest{
+				UserID:   "1",
+				Message:  "hello",
+				Channel:  "email",
+				Channels: []string{"telegram", "email"},
+				SendAt:   time.Now().Add(2 * time.Minute),
+			},
+			wantErr: "channel must be the first element of channels",
+		},
+		{
+			name: "duplicate channel in chain",
+			req: &models.CreateNotificationRequest{
+				UserID:   "1",
+				Message:  "hello",
+				Channels: []string{"email", "email"},
+				SendAt:   time.Now().Add(2 * time.Minute),
+			},
+			wantErr: "duplicate channel in channels: email",
+		},
 	}
 
 	for _, tt := range tests {
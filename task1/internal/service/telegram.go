@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// telegramTokenBytes - длина токена привязки до кодирования в hex. Telegram принимает
+// в параметре start до 64 символов
+const telegramTokenBytes = 16
+
+// telegramService выдает токены привязки чатов Telegram. Пользователь передает токен боту
+// командой /start, после чего бот знает его чат, а уведомления в канал telegram идут в этот чат.
+type telegramService struct {
+	repo        TelegramRepository
+	linkTTL     time.Duration
+	botUsername string
+}
+
+// NewTelegramService создает сервис, токены которого действуют linkTTL. Если botUsername
+// не пуст, в ответ добавляется ссылка, открывающая бота с токеном.
+func NewTelegramService(repo TelegramRepository, linkTTL time.Duration, botUsername string) TelegramService {
+	return &telegramService{repo: repo, linkTTL: linkTTL, botUsername: botUsername}
+}
+
+func (s *telegramService) CreateLink(ctx context.Context, userID string) (*models.TelegramLink, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("user_id is required")
+	}
+
+	raw := make([]byte, telegramTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate link token: %w", err)
+	}
+
+	link := &models.TelegramLink{
+		Token:     hex.EncodeToString(raw),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(s.linkTTL),
+	}
+	if err := s.repo.CreateTelegramLink(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to create telegram link: %w", err)
+	}
+	if s.botUsername != "" {
+		link.URL = fmt.Sprintf("https://t.me/%s?start=%s", s.botUsername, link.Token)
+	}
+	return link, nil
+}
+
+func (s *telegramService) LinkChat(ctx context.Context, token string, chatID int64) (string, error) {
+	if token == "" {
+		return "", models.ErrTelegramLinkInvalid
+	}
+	userID, err := s.repo.LinkTelegramChat(ctx, token, chatID, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("failed to link telegram chat: %w", err)
+	}
+	return userID, nil
+}
+
+func (s *telegramService) ChatUser(ctx context.Context, chatID int64) (string, error) {
+	userID, err := s.repo.GetTelegramChatUser(ctx, chatID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get telegram chat user: %w", err)
+	}
+	return userID, nil
+}
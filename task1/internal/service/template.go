@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+)
+
+// templateService реализует управление шаблонами сообщений: каждое изменение
+// создает новую версию, а уведомления ссылаются на конкретную версию.
+type templateService struct {
+	repo TemplateRepository
+}
+
+func NewTemplateService(repo TemplateRepository) TemplateService {
+	return &templateService{repo: repo}
+}
+
+func (s *templateService) Create(ctx context.Context, req *models.TemplateRequest) (*models.Template, error) {
+	if err := validateTemplate(req); err != nil {
+		return nil, err
+	}
+
+	t := newTemplate(uuid.New().String(), req)
+	t.Version = 1
+	if err := s.repo.CreateTemplate(ctx, t); err != nil {
+		return nil, fmt.Errorf("failed to create template: %w", err)
+	}
+	return t, nil
+}
+
+func (s *templateService) Update(ctx context.Context, id string, req *models.TemplateRequest) (*models.Template, error) {
+	if err := validateTemplate(req); err != nil {
+		return nil, err
+	}
+
+	t := newTemplate(id, req)
+	if err := s.repo.CreateTemplateVersion(ctx, t); err != nil {
+		return nil, fmt.Errorf("failed to update template: %w", err)
+	}
+	return t, nil
+}
+
+func (s *templateService) Get(ctx context.Context, id string, version int) (*models.Template, error) {
+	t, err := s.repo.GetTemplate(ctx, id, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return t, nil
+}
+
+func (s *templateService) List(ctx context.Context) ([]*models.Template, error) {
+	templates, err := s.repo.ListTemplates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+func (s *templateService) Delete(ctx context.Context, id string) error {
+	if err := s.repo.DeleteTemplate(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+func (s *templateService) Preview(ctx context.Context, id string, req *models.PreviewTemplateRequest) (*models.RenderedMessage, error) {
+	t, err := s.Get(ctx, id, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	return renderTemplate(t, req.Variables)
+}
+
+func newTemplate(id string, req *models.TemplateRequest) *models.Template {
+	return &models.Template{
+		ID:        id,
+		Name:      req.Name,
+		Channel:   req.Channel,
+		Subject:   req.Subject,
+		Body:      req.Body,
+		ParseMode: req.ParseMode,
+		CreatedAt: time.Now(),
+	}
+}
+
+func validateTemplate(req *models.TemplateRequest) error {
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.Channel == "" {
+		return fmt.Errorf("channel is required")
+	}
+	if req.Body == "" {
+		return fmt.Errorf("body is required")
+	}
+
+	if err := validateParseMode(req.ParseMode); err != nil {
+		return err
+	}
+
+	// Проверяем синтаксис, подставляя шаблон без переменных
+	if _, _, err := parseTemplate(&models.Template{Subject: req.Subject, Body: req.Body, ParseMode: req.ParseMode}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// executor - общий интерфейс text/template и html/template
+type executor interface {
+	Execute(wr io.Writer, data any) error
+}
+
+// parseTemplate разбирает тему и тело шаблона. Для HTML используется html/template,
+// чтобы значения переменных экранировались.
+func parseTemplate(t *models.Template) (subject, body executor, err error) {
+	subj, err := template.New("subject").Option("missingkey=error").Parse(t.Subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+
+	if t.ParseMode == models.ParseModeHTML {
+		b, err := htmltemplate.New("body").Option("missingkey=error").Parse(t.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid body template: %w", err)
+		}
+		return subj, b, nil
+	}
+
+	b, err := template.New("body").Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	return subj, b, nil
+}
+
+// renderTemplate подставляет переменные в шаблон.
+func renderTemplate(t *models.Template, variables map[string]string) (*models.RenderedMessage, error) {
+	subject, body, err := parseTemplate(t)
+	if err != nil {
+		return nil, err
+	}
+	if variables == nil {
+		variables = map[string]string{}
+	}
+
+	var subjectBuf, bodyBuf bytes.Buffer
+	if err := subject.Execute(&subjectBuf, variables); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := body.Execute(&bodyBuf, variables); err != nil {
+		return nil, fmt.Errorf("failed to render body: %w", err)
+	}
+
+	return &models.RenderedMessage{
+		Subject:   subjectBuf.String(),
+		Body:      bodyBuf.String(),
+		ParseMode: t.ParseMode,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  models.Template
+		variables map[string]string
+		want      models.RenderedMessage
+		wantErr   string
+	}{
+		{
+			name:      "email with subject",
+			template:  models.Template{Subject: "Hello, {{.name}}", Body: "Your order {{.order}} is ready"},
+			variables: map[string]string{"name": "Ann", "order": "42"},
+			want:      models.RenderedMessage{Subject: "Hello, Ann", Body: "Your order 42 is ready"},
+		},
+		{
+			name:      "html escapes variables",
+			template:  models.Template{Body: "<b>{{.name}}</b>", ParseMode: models.ParseModeHTML},
+			variables: map[string]string{"name": "<script>"},
+			want:      models.RenderedMessage{Body: "<b>&lt;script&gt;</b>", ParseMode: models.ParseModeHTML},
+		},
+		{
+			name:      "markdown is not escaped",
+			template:  models.Template{Body: "*{{.name}}*", ParseMode: models.ParseModeMarkdown},
+			variables: map[string]string{"name": "<Ann>"},
+			want:      models.RenderedMessage{Body: "*<Ann>*", ParseMode: models.ParseModeMarkdown},
+		},
+		{
+			name:     "missing variable",
+			template: models.Template{Body: "Hello, {{.name}}"},
+			wantErr:  "failed to render body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := renderTemplate(&tt.template, tt.variables)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *rendered)
+		})
+	}
+}
+
+func TestTemplateService_Create(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     models.TemplateRequest
+		wantErr string
+	}{
+		{
+			name: "success",
+			req:  models.TemplateRequest{Name: "digest", Channel: "email", Subject: "Digest", Body: "Hi {{.name}}"},
+		},
+		{
+			name:    "invalid parse mode",
+			req:     models.TemplateRequest{Name: "digest", Channel: "telegram", Body: "Hi", ParseMode: "BBCode"},
+			wantErr: "unsupported parse_mode",
+		},
+		{
+			name:    "invalid syntax",
+			req:     models.TemplateRequest{Name: "digest", Channel: "telegram", Body: "Hi {{.name"},
+			wantErr: "invalid body template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(testsutils.MockRepository)
+			if tt.wantErr == "" {
+				repo.On("CreateTemplate", mock.Anything, mock.AnythingOfType("*models.Template")).Return(nil)
+			}
+
+			service := NewTemplateService(repo)
+
+			tpl, err := service.Create(context.Background(), &tt.req)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				repo.AssertNotCalled(t, "CreateTemplate", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, tpl.ID)
+			assert.Equal(t, 1, tpl.Version)
+		})
+	}
+}
+
+func TestTemplateService_Preview(t *testing.T) {
+	repo := new(testsutils.MockRepository)
+	repo.On("GetTemplate", mock.Anything, "tpl-1", 2).Return(&models.Template{
+		ID:      "tpl-1",
+		Version: 2,
+		Subject: "Reminder",
+		Body:    "Meeting at {{.time}}",
+	}, nil)
+
+	service := NewTemplateService(repo)
+
+	rendered, err := service.Preview(context.Background(), "tpl-1", &models.PreviewTemplateRequest{
+		Version:   2,
+		Variables: map[string]string{"time": "10:00"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Reminder", rendered.Subject)
+	assert.Equal(t, "Meeting at 10:00", rendered.Body)
+}
@@ -0,0 +1,267 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+const (
+	// listLimit - сколько ближайших уведомлений показывает /list
+	listLimit = 10
+	// listMessageLength - длина текста уведомления в ответе на /list
+	listMessageLength = 60
+	// pollRetryDelay - пауза перед повтором getUpdates после ошибки
+	pollRetryDelay = 3 * time.Second
+	// commandTimeout ограничивает обработку одной команды
+	commandTimeout = 10 * time.Second
+)
+
+const (
+	helpText = "Команды:\n" +
+		"/start <токен> - привязать этот чат к пользователю\n" +
+		"/list - ближайшие запланированные уведомления\n" +
+		"/cancel <id> - отменить уведомление"
+	startWithoutTokenText = "Чтобы получать уведомления в этот чат, откройте ссылку привязки из приложения.\n\n" + helpText
+	invalidTokenText      = "Ссылка привязки недействительна или устарела. Запросите новую в приложении."
+	notLinkedText         = "Чат не привязан к пользователю. Откройте ссылку привязки из приложения."
+	noUpcomingText        = "Запланированных уведомлений нет."
+	cancelUsageText       = "Укажите ID уведомления: /cancel <id>"
+	notFoundText          = "Уведомление не найдено."
+	internalErrorText     = "Не удалось выполнить команду, попробуйте позже."
+)
+
+// Bot обрабатывает команды, которые пользователи отправляют боту:
+// /start <токен> привязывает чат к пользователю по токену из POST /users/:id/telegram/link,
+// /list показывает ближайшие ожидающие уведомления, /cancel <id> отменяет уведомление
+// через NotificationService.Delete. Обновления читаются через long polling (getUpdates),
+// поэтому бот должен работать в одном экземпляре сервиса.
+type Bot struct {
+	api           *tgbotapi.BotAPI
+	links         service.TelegramService
+	notifications service.NotificationService
+	pollTimeout   time.Duration
+
+	// ctx прерывает запросы к Bot API, в том числе ожидающий getUpdates, при остановке
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBot подключается к Bot API по адресу cfg.APIEndpoint, его можно заменить
+// локальным сервером с тем же протоколом.
+func NewBot(cfg config.TelegramConfig, links service.TelegramService, notifications service.NotificationService) (*Bot, error) {
+	if cfg.BotToken == "" {
+		return nil, fmt.Errorf("telegram bot token is required for bot commands")
+	}
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &contextClient{ctx: ctx, client: &http.Client{Timeout: cfg.PollTimeout + 10*time.Second}}
+	api, err := tgbotapi.NewBotAPIWithClient(cfg.BotToken, endpoint, client)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
+	}
+
+	return &Bot{
+		api:           api,
+		links:         links,
+		notifications: notifications,
+		pollTimeout:   cfg.PollTimeout,
+		ctx:           ctx,
+		cancel:        cancel,
+	}, nil
+}
+
+// Start запускает чтение обновлений в отдельной горутине.
+func (b *Bot) Start() {
+	zlog.Logger.Info().Str("bot", b.api.Self.UserName).Dur("poll_timeout", b.pollTimeout).Msg("Starting telegram bot")
+
+	b.wg.Add(1)
+	go b.run()
+}
+
+// Stop прерывает long polling и дожидается обработки текущих команд.
+func (b *Bot) Stop() {
+	zlog.Logger.Info().Msg("Stopping telegram bot...")
+	b.cancel()
+	b.wg.Wait()
+	zlog.Logger.Info().Msg("Telegram bot stopped")
+}
+
+func (b *Bot) run() {
+	defer b.wg.Done()
+
+	offset := 0
+	for {
+		updates, err := b.api.GetUpdates(tgbotapi.UpdateConfig{
+			Offset:         offset,
+			Timeout:        int(b.pollTimeout.Seconds()),
+			AllowedUpdates: []string{"message"},
+		})
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Failed to get telegram updates")
+			select {
+			case <-time.After(pollRetryDelay):
+				continue
+			case <-b.ctx.Done():
+				return
+			}
+		}
+
+		for _, update := range updates {
+			if update.UpdateID >= offset {
+				offset = update.UpdateID + 1
+			}
+			if update.Message != nil {
+				b.handleMessage(update.Message)
+			}
+		}
+	}
+}
+
+func (b *Bot) handleMessage(msg *tgbotapi.Message) {
+	ctx, cancel := context.WithTimeout(b.ctx, commandTimeout)
+	defer cancel()
+
+	chatID := msg.Chat.ID
+	args := strings.TrimSpace(msg.CommandArguments())
+
+	var reply string
+	switch msg.Command() {
+	case "start":
+		reply = b.start(ctx, chatID, args)
+	case "list":
+		reply = b.list(ctx, chatID)
+	case "cancel":
+		reply = b.cancelNotification(ctx, chatID, args)
+	default:
+		reply = helpText
+	}
+
+	zlog.Logger.Info().Int64("chat_id", chatID).Str("command", msg.Command()).Msg("Telegram command handled")
+	if _, err := b.api.Send(tgbotapi.NewMessage(chatID, reply)); err != nil && b.ctx.Err() == nil {
+		zlog.Logger.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to reply to telegram command")
+	}
+}
+
+func (b *Bot) start(ctx context.Context, chatID int64, token string) string {
+	if token == "" {
+		return startWithoutTokenText
+	}
+
+	userID, err := b.links.LinkChat(ctx, token, chatID)
+	if errors.Is(err, models.ErrTelegramLinkInvalid) {
+		return invalidTokenText
+	}
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to link telegram chat")
+		return internalErrorText
+	}
+	return fmt.Sprintf("Чат привязан к пользователю %s, уведомления будут приходить сюда.\n\n%s", userID, helpText)
+}
+
+func (b *Bot) list(ctx context.Context, chatID int64) string {
+	userID, reply := b.chatUser(ctx, chatID)
+	if userID == "" {
+		return reply
+	}
+
+	page, err := b.notifications.List(ctx, &models.ListNotificationsRequest{
+		UserID: userID,
+		Status: []string{models.StatusPending},
+		Sort:   models.SortBySendAt,
+		Limit:  listLimit,
+	})
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("user_id", userID).Msg("Failed to list notifications for telegram")
+		return internalErrorText
+	}
+	if len(page.Notifications) == 0 {
+		return noUpcomingText
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Запланированные уведомления:")
+	for _, n := range page.Notifications {
+		fmt.Fprintf(&sb, "\n\n%s UTC, %s\n%s\n/cancel %s",
+			n.SendAt.UTC().Format("2006-01-02 15:04"), n.Channel, preview(n.Message), n.ID)
+	}
+	return sb.String()
+}
+
+func (b *Bot) cancelNotification(ctx context.Context, chatID int64, id string) string {
+	if id == "" {
+		return cancelUsageText
+	}
+	userID, reply := b.chatUser(ctx, chatID)
+	if userID == "" {
+		return reply
+	}
+
+	// Чужое уведомление для пользователя не отличается от несуществующего
+	n, err := b.notifications.GetByID(ctx, id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("Failed to get notification for telegram")
+		return internalErrorText
+	}
+	if n == nil || n.UserID != userID {
+		return notFoundText
+	}
+
+	if err := b.notifications.Delete(ctx, id); err != nil {
+		zlog.Logger.Warn().Err(err).Str("notification_id", id).Msg("Failed to cancel notification from telegram")
+		return fmt.Sprintf("Не удалось отменить уведомление: %v", err)
+	}
+	return fmt.Sprintf("Уведомление %s отменено.", id)
+}
+
+// chatUser возвращает пользователя чата или пустую строку и ответ, который нужно отправить
+func (b *Bot) chatUser(ctx context.Context, chatID int64) (string, string) {
+	userID, err := b.links.ChatUser(ctx, chatID)
+	if errors.Is(err, models.ErrTelegramChatNotLinked) {
+		return "", notLinkedText
+	}
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int64("chat_id", chatID).Msg("Failed to get telegram chat user")
+		return "", internalErrorText
+	}
+	return userID, ""
+}
+
+// preview сокращает текст уведомления до listMessageLength символов
+func preview(message string) string {
+	runes := []rune(strings.Join(strings.Fields(message), " "))
+	if len(runes) <= listMessageLength {
+		return string(runes)
+	}
+	return string(runes[:listMessageLength]) + "…"
+}
+
+// contextClient выполняет запросы к Bot API в контексте бота, чтобы Stop не ждал
+// окончания long polling
+type contextClient struct {
+	ctx    context.Context
+	client *http.Client
+}
+
+func (c *contextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
@@ -0,0 +1,183 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/memory"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "123:TEST"
+
+type reply struct {
+	chatID int64
+	text   string
+}
+
+// fakeBotAPI - локальный сервер с методами Bot API, которые использует бот:
+// getMe, getUpdates и sendMessage. Сообщения пользователей добавляются через send.
+type fakeBotAPI struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	updates []map[string]interface{}
+	nextID  int
+	replies chan reply
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	f := &fakeBotAPI{replies: make(chan reply, 10), nextID: 1}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeBotAPI) endpoint() string {
+	return f.URL + "/bot%s/%s"
+}
+
+// send добавляет сообщение text из чата chatID в очередь обновлений
+func (f *fakeBotAPI) send(chatID int64, text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	message := map[string]interface{}{
+		"message_id": f.nextID,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+		"text":       text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message["entities"] = []map[string]interface{}{{"type": "bot_command", "offset": 0, "length": len(command)}}
+	}
+	f.updates = append(f.updates, map[string]interface{}{"update_id": f.nextID, "message": message})
+	f.nextID++
+}
+
+func (f *fakeBotAPI) handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	switch {
+	case r.URL.Path == "/bot"+testToken+"/getMe":
+		result = map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Notifier", "username": "notifier_bot"}
+	case r.URL.Path == "/bot"+testToken+"/getUpdates":
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		f.mu.Lock()
+		var pending []map[string]interface{}
+		for _, u := range f.updates {
+			if u["update_id"].(int) >= offset {
+				pending = append(pending, u)
+			}
+		}
+		f.mu.Unlock()
+		if len(pending) == 0 {
+			// Короткая пауза вместо long polling
+			time.Sleep(20 * time.Millisecond)
+			pending = []map[string]interface{}{}
+		}
+		result = pending
+	case r.URL.Path == "/bot"+testToken+"/sendMessage":
+		chatID, _ := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+		f.replies <- reply{chatID: chatID, text: r.FormValue("text")}
+		result = map[string]interface{}{"message_id": 1, "date": 0, "chat": map[string]interface{}{"id": chatID, "type": "private"}}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+// command отправляет команду боту и ждет ответа
+func (f *fakeBotAPI) command(t *testing.T, chatID int64, text string) string {
+	t.Helper()
+	f.send(chatID, text)
+	select {
+	case r := <-f.replies:
+		assert.Equal(t, chatID, r.chatID)
+		return r.text
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reply to %q", text)
+		return ""
+	}
+}
+
+func TestBot_LinkListCancel(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeBotAPI(t)
+
+	repo := memory.NewRepository()
+	queue := memory.NewQueue(nil)
+	defer queue.Close()
+	notifications := service.NewNotificationService(repo, memory.NewCache(nil, time.Hour, time.Hour), queue,
+		[]service.Notifier{memory.NewRecordingNotifier("telegram")}, nil)
+	links := service.NewTelegramService(repo, time.Minute, "notifier_bot")
+
+	own, err := notifications.Create(ctx, &models.CreateNotificationRequest{
+		UserID: "user-1", Message: "Заказ готов", Channel: "telegram", SendAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	foreign, err := notifications.Create(ctx, &models.CreateNotificationRequest{
+		UserID: "user-2", Message: "Чужое", Channel: "telegram", SendAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	link, err := links.CreateLink(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://t.me/notifier_bot?start="+link.Token, link.URL)
+
+	bot, err := NewBot(config.TelegramConfig{
+		BotToken:    testToken,
+		APIEndpoint: api.endpoint(),
+		PollTimeout: time.Second,
+	}, links, notifications)
+	require.NoError(t, err)
+	bot.Start()
+	defer bot.Stop()
+
+	const chatID = 100
+
+	assert.Equal(t, notLinkedText, api.command(t, chatID, "/list"))
+
+	assert.Contains(t, api.command(t, chatID, "/start "+link.Token), "user-1")
+	prefs, err := repo.GetPreferences(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "100", prefs.Contacts["telegram"])
+
+	// Токен одноразовый
+	assert.Equal(t, invalidTokenText, api.command(t, 200, "/start "+link.Token))
+
+	list := api.command(t, chatID, "/list")
+	assert.Contains(t, list, "/cancel "+own.ID)
+	assert.Contains(t, list, "Заказ готов")
+	assert.NotContains(t, list, foreign.ID)
+
+	assert.Equal(t, notFoundText, api.command(t, chatID, "/cancel "+foreign.ID))
+	assert.Equal(t, cancelUsageText, api.command(t, chatID, "/cancel"))
+
+	assert.Contains(t, api.command(t, chatID, "/cancel "+own.ID), "отменено")
+	n, err := notifications.GetByID(ctx, own.ID)
+	require.NoError(t, err)
+	assert.Nil(t, n)
+
+	assert.Equal(t, noUpcomingText, api.command(t, chatID, "/list"))
+	assert.Equal(t, helpText, api.command(t, chatID, "hello"))
+}
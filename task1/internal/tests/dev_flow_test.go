@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/memory"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/WB_project_3/task1/internal/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDevMode_CreateDelaySend проходит путь create -> outbox -> отложенная очередь -> отправка
+// на реализациях из памяти, без внешних сервисов. Задержкой очереди управляют поддельные часы.
+func TestDevMode_CreateDelaySend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clock := memory.NewFakeClock(time.Now())
+	repo := memory.NewRepository()
+	queue := memory.NewQueue(clock)
+	defer queue.Close()
+	email := memory.NewRecordingNotifier("email")
+
+	svc := service.NewNotificationService(repo, memory.NewCache(clock, time.Hour, time.Hour), queue, []service.Notifier{email}, nil)
+
+	w := worker.NewWorker(svc, 1, worker.NewRateLimiter(config.RateLimitConfig{}))
+	require.NoError(t, w.Start(ctx, "notifications_queue"))
+	defer w.Stop()
+
+	n, err := svc.Create(ctx, &models.CreateNotificationRequest{
+		UserID:  "user@example.com",
+		Message: "hello",
+		Channel: "email",
+		SendAt:  time.Now().Add(2 * time.Minute),
+	})
+	require.NoError(t, err)
+
+	// Окно relay захватывает уведомление сразу, дальше его задерживает очередь
+	dispatched, err := svc.DispatchOutbox(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, dispatched)
+	assert.Equal(t, 0, repo.OutboxLen())
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, email.Sent())
+	assert.Equal(t, 1, queue.Len())
+
+	clock.Advance(2 * time.Minute)
+	sent, err := email.WaitSent(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, n.ID, sent[0].ID)
+	assert.Equal(t, "hello", sent[0].Message)
+
+	require.Eventually(t, func() bool {
+		current, err := repo.GetByID(ctx, n.ID)
+		return err == nil && current.Status == models.StatusSent && queue.Unacked() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	attempts, err := svc.ListAttempts(ctx, n.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Empty(t, attempts[0].Error)
+}
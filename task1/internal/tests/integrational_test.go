@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
@@ -55,11 +57,17 @@ func runMigrations(t *testing.T, dsn string) {
 
 	defer db.Close()
 
-	migration, err := os.ReadFile("../../migrations/001_init_notifications.sql")
+	files, err := filepath.Glob("../../migrations/*.sql")
 	require.NoError(t, err)
+	sort.Strings(files)
 
-	_, err = db.Exec(string(migration))
-	require.NoError(t, err)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		_, err = db.Exec(string(migration))
+		require.NoError(t, err)
+	}
 }
 
 func TestNotificationRepository_CreateAndGet(t *testing.T) {
@@ -116,3 +124,25 @@ func TestNotificationRepository_CreateAndGet(t *testing.T) {
 		result.Message,
 	)
 }
+
+func TestNotificationRepository_Migrate(t *testing.T) {
+	container, dsn := setupPostgres(t)
+	defer container.Terminate(context.Background())
+
+	repo, err := repository.NewNotificationRepositoryWithDB(dsn, nil, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	ctx := context.Background()
+	files, err := filepath.Glob("../../migrations/*.sql")
+	require.NoError(t, err)
+
+	// Миграции идемпотентны, поэтому первый запуск поверх runMigrations применяет все
+	applied, err := repo.Migrate(ctx, "../../migrations")
+	require.NoError(t, err)
+	assert.Len(t, applied, len(files))
+
+	applied, err = repo.Migrate(ctx, "../../migrations")
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"github.com/pozedorum/WB_project_3/task1/internal/memory"
+	"github.com/pozedorum/WB_project_3/task1/internal/models"
+	repository "github.com/pozedorum/WB_project_3/task1/internal/repository/postgres"
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/WB_project_3/task1/internal/worker"
+)
+
+// Две реплики потребителя не получают одно сообщение, а отложенное приходит не раньше срока
+func TestPostgresQueue_DeliversOnceAcrossConsumers(t *testing.T) {
+	container, dsn := setupPostgres(t)
+	defer container.Terminate(context.Background())
+
+	repo, err := repository.NewNotificationRepositoryWithDB(dsn, nil, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const total = 20
+	publisher := repo.Queue(50*time.Millisecond, time.Minute, 4)
+	for i := 0; i < total; i++ {
+		require.NoError(t, publisher.PublishWithDelay(ctx, "notifications", []byte(`{"id":"now"}`), 0))
+	}
+	require.NoError(t, publisher.PublishWithDelay(ctx, "notifications", []byte(`{"id":"later"}`), time.Second))
+	published := time.Now()
+
+	var mu sync.Mutex
+	received := 0
+	var laterAt time.Time
+	done := make(chan struct{})
+
+	for r := 0; r < 2; r++ {
+		q := repo.Queue(50*time.Millisecond, time.Minute, 4)
+		defer q.Close()
+		messages, err := q.Consume(ctx, "notifications")
+		require.NoError(t, err)
+
+		go func(messages <-chan models.Delivery) {
+			for msg := range messages {
+				assert.NoError(t, msg.Ack())
+				mu.Lock()
+				received++
+				// Тело - base64 от JSON, как в RabbitMQ; JSONB переформатирует JSON, сравниваем по содержимому
+				body, err := base64.StdEncoding.DecodeString(string(msg.Body))
+				assert.NoError(t, err)
+				if strings.Contains(string(body), "later") {
+					laterAt = time.Now()
+				}
+				if received == total+1 {
+					close(done)
+				}
+				mu.Unlock()
+			}
+		}(messages)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("not all messages were delivered")
+	}
+
+	// Ждем лишних доставок
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, total+1, received)
+	assert.GreaterOrEqual(t, laterAt.Sub(published), time.Second-100*time.Millisecond)
+}
+
+func TestPostgresQueue_NackRequeues(t *testing.T) {
+	container, dsn := setupPostgres(t)
+	defer container.Terminate(context.Background())
+
+	repo, err := repository.NewNotificationRepositoryWithDB(dsn, nil, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q := repo.Queue(50*time.Millisecond, time.Minute, 1)
+	defer q.Close()
+	require.NoError(t, q.PublishWithDelay(ctx, "notifications", []byte(`{"id":"n-1"}`), 0))
+
+	messages, err := q.Consume(ctx, "notifications")
+	require.NoError(t, err)
+
+	first := <-messages
+	require.NoError(t, first.Nack(true))
+	assert.Error(t, first.Ack(), "settled delivery must not be acknowledged twice")
+
+	second := <-messages
+	assert.Equal(t, string(first.Body), string(second.Body))
+	require.NoError(t, second.Ack())
+}
+
+// Payload outbox проходит через очередь в PostgreSQL до воркера и отправляется
+func TestPostgresQueue_WorkerSendsOutboxPayload(t *testing.T) {
+	container, dsn := setupPostgres(t)
+	defer container.Terminate(context.Background())
+
+	repo, err := repository.NewNotificationRepositoryWithDB(dsn, nil, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	q := repo.Queue(50*time.Millisecond, time.Minute, 4)
+	defer q.Close()
+	email := memory.NewRecordingNotifier("email")
+	svc := service.NewNotificationService(repo, memory.NewCache(memory.RealClock{}, time.Hour, time.Hour), q,
+		[]service.Notifier{email}, nil)
+
+	w := worker.NewWorker(svc, 1, worker.NewRateLimiter(config.RateLimitConfig{}))
+	require.NoError(t, w.Start(ctx, "notifications"))
+	defer w.Stop()
+
+	// Создаем напрямую в репозитории: сервис не принимает send_at ближе минуты
+	now := time.Now()
+	n := &models.Notification{ID: "pg-queue-1", UserID: "user@example.com", Message: "hello", Channel: "email",
+		Status: models.StatusPending, SendAt: now, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateNotification(ctx, n))
+
+	dispatched, err := svc.DispatchOutbox(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, dispatched)
+
+	sent, err := email.WaitSent(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, n.ID, sent[0].ID)
+	assert.Equal(t, "hello", sent[0].Message)
+
+	require.Eventually(t, func() bool {
+		current, err := repo.GetByID(ctx, n.ID)
+		return err == nil && current != nil && current.Status == models.StatusSent
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -29,24 +29,255 @@ func (m *MockRepository) GetByID(ctx context.Context, id string) (*models.Notifi
 	return notification, args.Error(1)
 }
 
-func (m *MockRepository) UpdateNotificationStatus(ctx context.Context, id, status string) error {
-	args := m.Called(ctx, id, status)
+func (m *MockRepository) UpdateNotificationStatus(ctx context.Context, id, status string, next models.NextOccurrenceFunc) (*models.Notification, error) {
+	args := m.Called(ctx, id, status, next)
+
+	var notification *models.Notification
+	if args.Get(0) != nil {
+		notification = args.Get(0).(*models.Notification)
+	}
+
+	return notification, args.Error(1)
+}
+
+func (m *MockRepository) ClaimNotification(ctx context.Context, id string, version int, lease time.Duration) (*models.Notification, error) {
+	args := m.Called(ctx, id, version, lease)
+
+	var notification *models.Notification
+	if args.Get(0) != nil {
+		notification = args.Get(0).(*models.Notification)
+	}
+
+	return notification, args.Error(1)
+}
+
+func (m *MockRepository) ReleaseNotification(ctx context.Context, id string) (*models.Notification, error) {
+	args := m.Called(ctx, id)
+
+	var notification *models.Notification
+	if args.Get(0) != nil {
+		notification = args.Get(0).(*models.Notification)
+	}
+
+	return notification, args.Error(1)
+}
+
+func (m *MockRepository) RecoverStuckNotifications(ctx context.Context, lastErr string, next models.NextOccurrenceFunc) ([]*models.Notification, error) {
+	args := m.Called(ctx, lastErr, next)
+
+	var notifications []*models.Notification
+	if args.Get(0) != nil {
+		notifications = args.Get(0).([]*models.Notification)
+	}
+
+	return notifications, args.Error(1)
+}
+
+func (m *MockRepository) CreateBatch(ctx context.Context, b *models.Batch, notifications []*models.Notification) error {
+	args := m.Called(ctx, b, notifications)
 	return args.Error(0)
 }
 
+func (m *MockRepository) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	args := m.Called(ctx, id)
+
+	var batch *models.Batch
+	if args.Get(0) != nil {
+		batch = args.Get(0).(*models.Batch)
+	}
+
+	return batch, args.Error(1)
+}
+
 func (m *MockRepository) DeleteNotification(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockRepository) DeleteSeries(ctx context.Context, seriesID string) ([]string, error) {
+	args := m.Called(ctx, seriesID)
+
+	var ids []string
+	if args.Get(0) != nil {
+		ids = args.Get(0).([]string)
+	}
+
+	return ids, args.Error(1)
+}
+
+func (m *MockRepository) GetTemplate(ctx context.Context, id string, version int) (*models.Template, error) {
+	args := m.Called(ctx, id, version)
+
+	var template *models.Template
+	if args.Get(0) != nil {
+		template = args.Get(0).(*models.Template)
+	}
+
+	return template, args.Error(1)
+}
+
+func (m *MockRepository) CreateTemplate(ctx context.Context, t *models.Template) error {
+	args := m.Called(ctx, t)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreateTemplateVersion(ctx context.Context, t *models.Template) error {
+	args := m.Called(ctx, t)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListTemplates(ctx context.Context) ([]*models.Template, error) {
+	args := m.Called(ctx)
+
+	var templates []*models.Template
+	if args.Get(0) != nil {
+		templates = args.Get(0).([]*models.Template)
+	}
+
+	return templates, args.Error(1)
+}
+
+func (m *MockRepository) DeleteTemplate(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetByIdempotencyKey(ctx context.Context, userID, key string) (*models.Notification, error) {
+	args := m.Called(ctx, userID, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Notification), args.Error(1)
+}
+
+func (m *MockRepository) UpdateNotification(ctx context.Context, n *models.Notification, expectedVersion int) error {
+	args := m.Called(ctx, n, expectedVersion)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RescheduleNotification(ctx context.Context, n *models.Notification) error {
+	args := m.Called(ctx, n)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SwitchChannel(ctx context.Context, n *models.Notification) error {
+	args := m.Called(ctx, n)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RecordAttempt(ctx context.Context, a *models.Attempt) error {
+	args := m.Called(ctx, a)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListAttempts(ctx context.Context, notificationID string) ([]*models.Attempt, error) {
+	args := m.Called(ctx, notificationID)
+
+	var attempts []*models.Attempt
+	if args.Get(0) != nil {
+		attempts = args.Get(0).([]*models.Attempt)
+	}
+
+	return attempts, args.Error(1)
+}
+
+func (m *MockRepository) GetAttachmentContents(ctx context.Context, notificationID string) (map[string][]byte, error) {
+	args := m.Called(ctx, notificationID)
+
+	var contents map[string][]byte
+	if args.Get(0) != nil {
+		contents = args.Get(0).(map[string][]byte)
+	}
+
+	return contents, args.Error(1)
+}
+
+func (m *MockRepository) GetPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserPreferences), args.Error(1)
+}
+
+func (m *MockRepository) SavePreferences(ctx context.Context, p *models.UserPreferences) error {
+	args := m.Called(ctx, p)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeletePreferences(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ClaimOutboxBatch(ctx context.Context, limit int, dueBefore time.Time, lease time.Duration) ([]models.OutboxMessage, error) {
+	args := m.Called(ctx, limit, dueBefore, lease)
+
+	var messages []models.OutboxMessage
+	if args.Get(0) != nil {
+		messages = args.Get(0).([]models.OutboxMessage)
+	}
+
+	return messages, args.Error(1)
+}
+
+func (m *MockRepository) MarkOutboxDispatched(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) MarkNotificationFailed(ctx context.Context, id string, lastErr string, next models.NextOccurrenceFunc) (*models.Notification, error) {
+	args := m.Called(ctx, id, lastErr, next)
+
+	var notification *models.Notification
+	if args.Get(0) != nil {
+		notification = args.Get(0).(*models.Notification)
+	}
+
+	return notification, args.Error(1)
+}
+
+func (m *MockRepository) ListNotifications(ctx context.Context, filter models.NotificationFilter) ([]*models.Notification, error) {
+	args := m.Called(ctx, filter)
+
+	var notifications []*models.Notification
+	if args.Get(0) != nil {
+		notifications = args.Get(0).([]*models.Notification)
+	}
+
+	return notifications, args.Error(1)
+}
+
+func (m *MockRepository) GetFailedNotifications(ctx context.Context, limit int) ([]*models.Notification, error) {
+	args := m.Called(ctx, limit)
+
+	var notifications []*models.Notification
+	if args.Get(0) != nil {
+		notifications = args.Get(0).([]*models.Notification)
+	}
+
+	return notifications, args.Error(1)
+}
+
+func (m *MockRepository) RequeueNotification(ctx context.Context, id string) (*models.Notification, error) {
+	args := m.Called(ctx, id)
+
+	var notification *models.Notification
+	if args.Get(0) != nil {
+		notification = args.Get(0).(*models.Notification)
+	}
+
+	return notification, args.Error(1)
+}
+
 //=============================================================
 
 type MockCache struct {
 	mock.Mock
 }
 
-func (m *MockCache) Set(ctx context.Context, key string, value interface{}) error {
-	args := m.Called(ctx, key, value)
+func (m *MockCache) Set(ctx context.Context, id string, n *models.Notification) error {
+	args := m.Called(ctx, id, n)
 	return args.Error(0)
 }
 
@@ -61,6 +292,16 @@ func (m *MockCache) Get(ctx context.Context, key string) (*models.Notification,
 	return notification, args.Error(1)
 }
 
+func (m *MockCache) Tombstone(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockCache) Delete(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
 func (m *MockCache) Ping(ctx context.Context) (string, error) {
 	args := m.Called(ctx)
 	return args.String(0), args.Error(1)
@@ -82,12 +323,22 @@ func (m *MockQueue) PublishWithDelay(ctx context.Context, queueName string, mess
 	return args.Error(0)
 }
 
-func (m *MockQueue) Consume(ctx context.Context, queueName string) (<-chan []byte, error) {
+func (m *MockQueue) PublishDeadLetter(ctx context.Context, dl models.DeadLetter) error {
+	args := m.Called(ctx, dl)
+	return args.Error(0)
+}
+
+func (m *MockQueue) AckDeadLetters(ctx context.Context, notificationIDs []string) error {
+	args := m.Called(ctx, notificationIDs)
+	return args.Error(0)
+}
+
+func (m *MockQueue) Consume(ctx context.Context, queueName string) (<-chan models.Delivery, error) {
 	args := m.Called(ctx, queueName)
 
-	var ch <-chan []byte
+	var ch <-chan models.Delivery
 	if args.Get(0) != nil {
-		ch = args.Get(0).(<-chan []byte)
+		ch = args.Get(0).(<-chan models.Delivery)
 	}
 
 	return ch, args.Error(1)
@@ -100,6 +351,33 @@ func (m *MockQueue) Close() error {
 
 //=============================================================
 
+type MockStatusEvents struct {
+	mock.Mock
+}
+
+func (m *MockStatusEvents) Publish(ctx context.Context, event models.StatusEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockStatusEvents) Subscribe(ctx context.Context) (<-chan models.StatusEvent, error) {
+	args := m.Called(ctx)
+
+	var ch <-chan models.StatusEvent
+	if args.Get(0) != nil {
+		ch = args.Get(0).(<-chan models.StatusEvent)
+	}
+
+	return ch, args.Error(1)
+}
+
+func (m *MockStatusEvents) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+//=============================================================
+
 type MockNotifier struct {
 	mock.Mock
 	Channel string
@@ -141,9 +419,9 @@ func (m *MockService) Delete(ctx context.Context, id string) error {
 	return args.Error(0)
 }
 
-func (m *MockService) Consume(ctx context.Context, queue string) (<-chan []byte, error) {
+func (m *MockService) Consume(ctx context.Context, queue string) (<-chan models.Delivery, error) {
 	args := m.Called(ctx, queue)
-	return args.Get(0).(<-chan []byte), args.Error(1)
+	return args.Get(0).(<-chan models.Delivery), args.Error(1)
 }
 
 func (m *MockService) ProcessNotificationData(ctx context.Context, data []byte) error {
@@ -155,3 +433,96 @@ func (m *MockService) ProcessNotification(ctx context.Context, n *models.Notific
 	args := m.Called(ctx, n)
 	return args.Error(0)
 }
+
+func (m *MockService) DispatchOutbox(ctx context.Context, batchSize int, window time.Duration) (int, error) {
+	args := m.Called(ctx, batchSize, window)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockService) FailNotification(ctx context.Context, n *models.Notification, attempts int, cause error) error {
+	args := m.Called(ctx, n, attempts, cause)
+	return args.Error(0)
+}
+
+func (m *MockService) RecoverStuck(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockService) CreateBatch(ctx context.Context, req *models.CreateBatchRequest) (*models.Batch, error) {
+	args := m.Called(ctx, req)
+
+	var batch *models.Batch
+	if args.Get(0) != nil {
+		batch = args.Get(0).(*models.Batch)
+	}
+
+	return batch, args.Error(1)
+}
+
+func (m *MockService) GetBatch(ctx context.Context, id string) (*models.Batch, error) {
+	args := m.Called(ctx, id)
+
+	var batch *models.Batch
+	if args.Get(0) != nil {
+		batch = args.Get(0).(*models.Batch)
+	}
+
+	return batch, args.Error(1)
+}
+
+func (m *MockService) ListAttempts(ctx context.Context, id string) ([]*models.Attempt, error) {
+	args := m.Called(ctx, id)
+
+	var attempts []*models.Attempt
+	if args.Get(0) != nil {
+		attempts = args.Get(0).([]*models.Attempt)
+	}
+
+	return attempts, args.Error(1)
+}
+
+func (m *MockService) List(ctx context.Context, req *models.ListNotificationsRequest) (*models.NotificationPage, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.NotificationPage), args.Error(1)
+}
+
+func (m *MockService) Update(ctx context.Context, id string, req *models.UpdateNotificationRequest) (*models.Notification, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Notification), args.Error(1)
+}
+
+func (m *MockService) ListFailed(ctx context.Context, limit int) ([]*models.Notification, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Notification), args.Error(1)
+}
+
+func (m *MockService) Replay(ctx context.Context, id string) (*models.Notification, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Notification), args.Error(1)
+}
+
+func (m *MockService) ReplayAllFailed(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockService) StreamStatus(ctx context.Context, req *models.StatusStreamRequest) (<-chan models.StatusEvent, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(<-chan models.StatusEvent), args.Error(1)
+}
@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
+	"golang.org/x/time/rate"
+)
+
+// recipientIdleTTL - через сколько простоя bucket получателя удаляется. К этому моменту
+// он гарантированно полон, поэтому удаление не ослабляет ограничение.
+const recipientIdleTTL = 10 * time.Minute
+
+// RateLimiter ограничивает частоту отправок token bucket'ами на канал и на получателя в канале.
+// Каналы без настроенного ограничения не ограничиваются.
+type RateLimiter struct {
+	channels     map[string]*rate.Limiter
+	perRecipient map[string]config.RateLimit
+
+	mu         sync.Mutex
+	recipients map[string]*recipientBucket // ключ channel + ":" + recipient
+	lastSweep  time.Time
+}
+
+type recipientBucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	channels := make(map[string]*rate.Limiter)
+	for channel, limit := range cfg.Channels {
+		if limit.PerSecond > 0 {
+			channels[channel] = newLimiter(limit)
+		}
+	}
+
+	return &RateLimiter{
+		channels:     channels,
+		perRecipient: cfg.PerRecipient,
+		recipients:   make(map[string]*recipientBucket),
+		lastSweep:    time.Now(),
+	}
+}
+
+// Reserve резервирует отправку получателю через канал и возвращает, сколько нужно подождать
+// перед ней. Для nil ограничителя задержка всегда нулевая.
+func (l *RateLimiter) Reserve(channel, recipient string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := time.Now()
+
+	var delay time.Duration
+	if limiter := l.recipientLimiter(channel, recipient, now); limiter != nil {
+		delay = limiter.ReserveN(now, 1).DelayFrom(now)
+	}
+	// Токен канала берется на момент, когда освободится получатель, чтобы ожидание
+	// одного получателя не занимало пропускную способность канала
+	if limiter, ok := l.channels[channel]; ok {
+		at := now.Add(delay)
+		if d := delay + limiter.ReserveN(at, 1).DelayFrom(at); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+func (l *RateLimiter) recipientLimiter(channel, recipient string, now time.Time) *rate.Limiter {
+	limit, ok := l.perRecipient[channel]
+	if !ok || limit.PerSecond <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for key, bucket := range l.recipients {
+			if now.Sub(bucket.lastUsed) > recipientIdleTTL {
+				delete(l.recipients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	key := channel + ":" + recipient
+	bucket, ok := l.recipients[key]
+	if !ok {
+		bucket = &recipientBucket{limiter: newLimiter(limit)}
+		l.recipients[key] = bucket
+	}
+	bucket.lastUsed = now
+	return bucket.limiter
+}
+
+func newLimiter(limit config.RateLimit) *rate.Limiter {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(limit.PerSecond), burst)
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// LeaseReaper периодически находит уведомления, зависшие в статусе sending после падения
+// воркера, и переводит их в failed.
+type LeaseReaper struct {
+	service      service.NotificationService
+	interval     time.Duration
+	wg           sync.WaitGroup
+	shutdownChan chan struct{}
+}
+
+func NewLeaseReaper(service service.NotificationService, interval time.Duration) *LeaseReaper {
+	return &LeaseReaper{
+		service:      service,
+		interval:     interval,
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+// Start запускает проверку аренды в отдельной горутине.
+func (r *LeaseReaper) Start(ctx context.Context) {
+	zlog.Logger.Info().Dur("interval", r.interval).Msg("Starting lease reaper")
+
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+func (r *LeaseReaper) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.shutdownChan:
+			zlog.Logger.Info().Msg("Lease reaper received shutdown signal")
+			return
+		case <-ctx.Done():
+			zlog.Logger.Info().Msg("Lease reaper context cancelled")
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+func (r *LeaseReaper) reap(ctx context.Context) {
+	n, err := r.service.RecoverStuck(ctx)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to recover stuck notifications")
+		return
+	}
+	if n > 0 {
+		zlog.Logger.Warn().Int("count", n).Msg("Recovered stuck notifications")
+	}
+}
+
+// Stop останавливает reaper gracefully
+func (r *LeaseReaper) Stop() {
+	zlog.Logger.Info().Msg("Stopping lease reaper...")
+	close(r.shutdownChan)
+	r.wg.Wait()
+	zlog.Logger.Info().Msg("Lease reaper stopped")
+}
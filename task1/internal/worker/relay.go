@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/WB_project_3/task1/internal/service"
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// OutboxRelay периодически переносит записи outbox из PostgreSQL в очередь.
+// В очередь попадают только уведомления, время отправки которых наступает в пределах window.
+type OutboxRelay struct {
+	service      service.NotificationService
+	interval     time.Duration
+	window       time.Duration
+	batchSize    int
+	wg           sync.WaitGroup
+	shutdownChan chan struct{}
+}
+
+func NewOutboxRelay(service service.NotificationService, interval, window time.Duration, batchSize int) *OutboxRelay {
+	return &OutboxRelay{
+		service:      service,
+		interval:     interval,
+		window:       window,
+		batchSize:    batchSize,
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+// Start запускает цикл опроса outbox в отдельной горутине.
+func (r *OutboxRelay) Start(ctx context.Context) {
+	zlog.Logger.Info().Dur("interval", r.interval).Dur("window", r.window).Int("batch_size", r.batchSize).Msg("Starting outbox relay")
+
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.shutdownChan:
+			zlog.Logger.Info().Msg("Outbox relay received shutdown signal")
+			return
+		case <-ctx.Done():
+			zlog.Logger.Info().Msg("Outbox relay context cancelled")
+			return
+		case <-ticker.C:
+			r.drain(ctx)
+		}
+	}
+}
+
+// drain публикует пачки до тех пор, пока outbox не опустеет
+func (r *OutboxRelay) drain(ctx context.Context) {
+	for {
+		n, err := r.service.DispatchOutbox(ctx, r.batchSize, r.window)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("Failed to dispatch outbox")
+			return
+		}
+		if n > 0 {
+			zlog.Logger.Info().Int("count", n).Msg("Outbox messages dispatched")
+		}
+		if n < r.batchSize {
+			return
+		}
+
+		select {
+		case <-r.shutdownChan:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// Stop останавливает relay gracefully
+func (r *OutboxRelay) Stop() {
+	zlog.Logger.Info().Msg("Stopping outbox relay...")
+	close(r.shutdownChan)
+	r.wg.Wait()
+	zlog.Logger.Info().Msg("Outbox relay stopped")
+}
@@ -4,27 +4,56 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pozedorum/WB_project_3/task1/internal/metrics"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/service"
 	"github.com/pozedorum/wbf/zlog"
 )
 
+// errRequeue означает, что сообщение нужно вернуть в очередь для повторной обработки.
+var errRequeue = errors.New("message should be requeued")
+
+// errInterrupted возвращается, если ожидание перед отправкой прервано остановкой воркера.
+var errInterrupted = errors.New("processing interrupted")
+
+// maxRateLimitDelays - сколько раз подряд провайдер может ограничить отправку, прежде чем
+// ограничение начнет расходовать попытки.
+const maxRateLimitDelays = 10
+
 // Worker обрабатывает сообщения из очереди и инициирует отправку уведомлений.
 type Worker struct {
 	service      service.NotificationService
+	limiter      *RateLimiter
 	wg           sync.WaitGroup
 	shutdownChan chan struct{}
 	semaphore    chan struct{}
+
+	// Состояние для GetStatus и проверки готовности
+	queue     string
+	startedAt time.Time
+	running   atomic.Bool
+	inFlight  atomic.Int64
+	processed atomic.Int64
+	failed    atomic.Int64
 }
 
-func NewWorker(service service.NotificationService) *Worker {
+// NewWorker создает воркер, обрабатывающий одновременно не больше concurrency сообщений.
+// Отправки ограничиваются limiter'ом, nil отключает ограничение.
+func NewWorker(service service.NotificationService, concurrency int, limiter *RateLimiter) *Worker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
 	return &Worker{
 		service:      service,
+		limiter:      limiter,
 		shutdownChan: make(chan struct{}),
-		semaphore:    make(chan struct{}, 10),
+		semaphore:    make(chan struct{}, concurrency),
 	}
 }
 
@@ -37,6 +66,10 @@ func (w *Worker) Start(ctx context.Context, queueName string) error {
 		return err
 	}
 
+	w.queue = queueName
+	w.startedAt = time.Now()
+	w.running.Store(true)
+
 	w.wg.Add(1)
 	go w.processMessages(ctx, messages)
 
@@ -44,8 +77,10 @@ func (w *Worker) Start(ctx context.Context, queueName string) error {
 	return nil
 }
 
-func (w *Worker) processMessages(ctx context.Context, messages <-chan []byte) {
+func (w *Worker) processMessages(ctx context.Context, messages <-chan models.Delivery) {
 	defer w.wg.Done()
+	// Новые сообщения больше не читаются, воркер перестает быть готовым
+	defer w.running.Store(false)
 
 	for {
 		select {
@@ -62,24 +97,53 @@ func (w *Worker) processMessages(ctx context.Context, messages <-chan []byte) {
 				zlog.Logger.Info().Msg("Messages channel closed")
 				return
 			}
-			// не очень понимаю как правильно это реализовать,
-			// в текущей реализации будут теряться сообщения при их большом количестве
+
+			// Ждем свободный слот: пока все заняты, новые сообщения остаются у брокера
 			select {
 			case w.semaphore <- struct{}{}:
-				w.wg.Add(1)
-				go func() {
-					defer func() { <-w.semaphore }()
-					defer w.wg.Done()
-					w.processSingleMessage(ctx, msg)
-				}()
-			default:
-				zlog.Logger.Warn().Msg("Worker busy, skipping message")
+			case <-w.shutdownChan:
+				nack(msg, true)
+				zlog.Logger.Info().Msg("Worker received shutdown signal")
+				return
+			case <-ctx.Done():
+				nack(msg, true)
+				zlog.Logger.Info().Msg("Worker context cancelled")
+				return
 			}
+
+			w.wg.Add(1)
+			go func() {
+				defer func() { <-w.semaphore }()
+				defer w.wg.Done()
+				w.handleDelivery(ctx, msg)
+			}()
 		}
 	}
 }
 
-func (w *Worker) processSingleMessage(ctx context.Context, messageData []byte) {
+// handleDelivery обрабатывает сообщение и подтверждает его у брокера только после завершения обработки.
+func (w *Worker) handleDelivery(ctx context.Context, msg models.Delivery) {
+	w.inFlight.Add(1)
+	metrics.WorkerInFlight.Inc()
+	defer func() {
+		w.inFlight.Add(-1)
+		metrics.WorkerInFlight.Dec()
+	}()
+
+	err := w.processSingleMessage(ctx, msg.Body)
+	switch {
+	case err == nil:
+		w.processed.Add(1)
+		ack(msg)
+	case w.interrupted(ctx), errors.Is(err, errRequeue):
+		// Обработка прервана или не удалось сохранить результат, возвращаем сообщение в очередь
+		nack(msg, true)
+	default:
+		nack(msg, false)
+	}
+}
+
+func (w *Worker) processSingleMessage(ctx context.Context, messageData []byte) error {
 	// Логируем получение сообщения
 	zlog.Logger.Debug().Str("message", string(messageData)).Msg("Received raw message from queue")
 
@@ -88,7 +152,7 @@ func (w *Worker) processSingleMessage(ctx context.Context, messageData []byte) {
 	n, err := base64.StdEncoding.Decode(decodedData, messageData)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Msg("Failed to decode base64 message")
-		return
+		return err
 	}
 	decodedData = decodedData[:n] // Обрезаем до фактической длины
 
@@ -98,7 +162,7 @@ func (w *Worker) processSingleMessage(ctx context.Context, messageData []byte) {
 	var notification models.Notification
 	if err := json.Unmarshal(decodedData, &notification); err != nil {
 		zlog.Logger.Error().Err(err).Msg("Failed to unmarshal JSON message")
-		return
+		return err
 	}
 
 	zlog.Logger.Info().
@@ -108,20 +172,35 @@ func (w *Worker) processSingleMessage(ctx context.Context, messageData []byte) {
 
 	// Обрабатываем уведомление с retry логикой
 	if err := w.processWithRetry(ctx, &notification); err != nil {
+		if w.interrupted(ctx) {
+			return err
+		}
+
 		zlog.Logger.Error().
 			Err(err).
 			Str("notification_id", notification.ID).
 			Msg("Failed to process notification after retries")
-	} else {
-		zlog.Logger.Info().
-			Str("notification_id", notification.ID).
-			Msg("Successfully processed notification")
+
+		// Попытки на текущем канале исчерпаны: FailNotification переключает уведомление на следующий
+		// канал цепочки или помечает его failed и публикует в очередь недоставленных.
+		// Если сохранить результат не удалось, сообщение возвращается в очередь
+		w.failed.Add(1)
+		if failErr := w.service.FailNotification(ctx, &notification, models.ConsumerStrategy.Attempts, err); failErr != nil {
+			return fmt.Errorf("%w: %v", errRequeue, failErr)
+		}
+		return nil
 	}
+
+	zlog.Logger.Info().
+		Str("notification_id", notification.ID).
+		Msg("Successfully processed notification")
+	return nil
 }
 
 func (w *Worker) processWithRetry(ctx context.Context, notification *models.Notification) error {
 	retryStrategy := models.ConsumerStrategy
 	var lastErr error
+	rateLimitDelays := 0
 
 	for attempt := 1; attempt <= retryStrategy.Attempts; attempt++ {
 		select {
@@ -130,11 +209,41 @@ func (w *Worker) processWithRetry(ctx context.Context, notification *models.Noti
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			// Ожидание ограничителя не расходует попытки
+			if err := w.wait(ctx, w.limiter.Reserve(notification.Channel, notification.UserID)); err != nil {
+				return err
+			}
+
 			// Пытаемся обработать уведомление
 			err := w.service.ProcessNotification(ctx, notification)
 			if err == nil {
 				return nil // Успех!
 			}
+			if errors.Is(err, models.ErrNotPending) {
+				// Уведомление отменено или уже обработано, повторять нечего
+				zlog.Logger.Info().Str("notification_id", notification.ID).Msg("Notification is no longer pending, skipping")
+				return nil
+			}
+			if errors.Is(err, models.ErrStaleVersion) {
+				// Уведомление изменено, актуальную версию доставит новое сообщение
+				zlog.Logger.Info().Str("notification_id", notification.ID).Msg("Notification message is stale, skipping")
+				return nil
+			}
+
+			var limited *models.RateLimitError
+			if errors.As(err, &limited) && rateLimitDelays < maxRateLimitDelays {
+				// Провайдер ограничил отправку: повторяем ту же попытку после паузы
+				rateLimitDelays++
+				attempt--
+				zlog.Logger.Info().
+					Str("notification_id", notification.ID).
+					Dur("retry_after", limited.RetryAfter).
+					Msg("Notification send rate limited, delaying")
+				if err := w.wait(ctx, limited.RetryAfter); err != nil {
+					return err
+				}
+				continue
+			}
 
 			lastErr = err
 			zlog.Logger.Warn().
@@ -146,6 +255,7 @@ func (w *Worker) processWithRetry(ctx context.Context, notification *models.Noti
 
 			// Если это не последняя попытка, ждем перед повторной
 			if attempt < retryStrategy.Attempts {
+				metrics.SendRetries.WithLabelValues(notification.Channel).Inc()
 				delay := calculateBackoff(attempt, retryStrategy.Delay)
 				zlog.Logger.Info().
 					Str("notification_id", notification.ID).
@@ -169,6 +279,24 @@ func (w *Worker) processWithRetry(ctx context.Context, notification *models.Noti
 	return lastErr
 }
 
+// wait приостанавливает обработку на delay. Остановка воркера прерывает ожидание.
+func (w *Worker) wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-w.shutdownChan:
+		return errInterrupted
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // calculateBackoff вычисляет время задержки с экспоненциальным откатом
 func calculateBackoff(attempt int, baseDelay time.Duration) time.Duration {
 	// Экспоненциальный backoff с максимальным ограничением
@@ -182,6 +310,34 @@ func calculateBackoff(attempt int, baseDelay time.Duration) time.Duration {
 	return backoff
 }
 
+// interrupted сообщает, что обработка была прервана остановкой воркера или отменой контекста
+func (w *Worker) interrupted(ctx context.Context) bool {
+	select {
+	case <-w.shutdownChan:
+		return true
+	default:
+		return ctx.Err() != nil
+	}
+}
+
+func ack(msg models.Delivery) {
+	if msg.Ack == nil {
+		return
+	}
+	if err := msg.Ack(); err != nil {
+		zlog.Logger.Error().Err(err).Msg("Failed to ack message")
+	}
+}
+
+func nack(msg models.Delivery, requeue bool) {
+	if msg.Nack == nil {
+		return
+	}
+	if err := msg.Nack(requeue); err != nil {
+		zlog.Logger.Error().Err(err).Bool("requeue", requeue).Msg("Failed to nack message")
+	}
+}
+
 // Stop останавливает worker gracefully
 func (w *Worker) Stop() {
 	zlog.Logger.Info().Msg("Stopping worker gracefully...")
@@ -190,13 +346,26 @@ func (w *Worker) Stop() {
 	zlog.Logger.Info().Msg("Worker stopped successfully")
 }
 
-// GetStatus возвращает статус worker (можно использовать для health checks)
+// Ready сообщает, что воркер запущен и читает сообщения из очереди.
+func (w *Worker) Ready() bool {
+	return w.running.Load()
+}
+
+// GetStatus возвращает состояние воркера для health check. processed - сообщения,
+// обработанные успешно, failed - уведомления, попытки отправки которых исчерпаны.
 func (w *Worker) GetStatus() map[string]interface{} {
-	return map[string]interface{}{
-		"active":     true,
-		"goroutines": "1", // Базовая реализация
-		"queue":      "notifications",
-		"started_at": time.Now().Format(time.RFC3339),
-		"processed":  "0", // Можно добавить счетчики при необходимости
+	ready := w.Ready()
+	status := map[string]interface{}{
+		"active":      ready,
+		"concurrency": cap(w.semaphore),
+		"in_flight":   w.inFlight.Load(),
+		"processed":   w.processed.Load(),
+		"failed":      w.failed.Load(),
+	}
+	// queue и startedAt записываются в Start до установки running
+	if ready {
+		status["queue"] = w.queue
+		status["started_at"] = w.startedAt.Format(time.RFC3339)
 	}
+	return status
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/pozedorum/WB_project_3/task1/internal/config"
 	"github.com/pozedorum/WB_project_3/task1/internal/models"
 	"github.com/pozedorum/WB_project_3/task1/internal/testsutils"
 
@@ -39,7 +40,7 @@ func TestCalculateBackoff(t *testing.T) {
 func TestWorker_ProcessWithRetry(t *testing.T) {
 	service := new(testsutils.MockService)
 
-	worker := NewWorker(service)
+	worker := NewWorker(service, 1, nil)
 
 	n := &models.Notification{
 		ID: "id-1",
@@ -62,29 +63,67 @@ func TestWorker_ProcessWithRetry(t *testing.T) {
 	service.AssertExpectations(t)
 }
 
+func TestWorker_ProcessWithRetry_SkipsNotPending(t *testing.T) {
+	service := new(testsutils.MockService)
+	worker := NewWorker(service, 1, nil)
+
+	n := &models.Notification{ID: "id-1"}
+
+	service.
+		On("ProcessNotification", mock.Anything, n).
+		Return(models.ErrNotPending).
+		Once()
+
+	err := worker.processWithRetry(context.Background(), n)
+
+	require.NoError(t, err)
+	service.AssertNumberOfCalls(t, "ProcessNotification", 1)
+}
+
+func TestWorker_ProcessWithRetry_SkipsStaleVersion(t *testing.T) {
+	service := new(testsutils.MockService)
+	worker := NewWorker(service, 1, nil)
+
+	n := &models.Notification{ID: "id-1", Version: 1}
+
+	service.
+		On("ProcessNotification", mock.Anything, n).
+		Return(models.ErrStaleVersion).
+		Once()
+
+	err := worker.processWithRetry(context.Background(), n)
+
+	require.NoError(t, err)
+	service.AssertNumberOfCalls(t, "ProcessNotification", 1)
+	service.AssertNotCalled(t, "FailNotification", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestWorker_ProcessSingleMessage_InvalidBase64(t *testing.T) {
-	worker := NewWorker(new(testsutils.MockService))
+	worker := NewWorker(new(testsutils.MockService), 1, nil)
 
-	worker.processSingleMessage(
+	err := worker.processSingleMessage(
 		context.Background(),
 		[]byte("!!!invalid base64!!!"),
 	)
+
+	require.Error(t, err)
 }
 
 func TestWorker_ProcessSingleMessage_InvalidJSON(t *testing.T) {
 	service := new(testsutils.MockService)
-	worker := NewWorker(service)
+	worker := NewWorker(service, 1, nil)
 
 	encoded := []byte(base64.StdEncoding.EncodeToString([]byte("not json")))
 
-	worker.processSingleMessage(context.Background(), encoded)
+	err := worker.processSingleMessage(context.Background(), encoded)
 
+	require.Error(t, err)
 	service.AssertNotCalled(t, "ProcessNotification")
 }
 
 func TestWorker_ProcessSingleMessage_Success(t *testing.T) {
 	service := new(testsutils.MockService)
-	worker := NewWorker(service)
+	worker := NewWorker(service, 1, nil)
 
 	notification := models.Notification{
 		ID:      "id-1",
@@ -102,7 +141,182 @@ func TestWorker_ProcessSingleMessage_Success(t *testing.T) {
 		On("ProcessNotification", mock.Anything, mock.AnythingOfType("*models.Notification")).
 		Return(nil)
 
-	worker.processSingleMessage(context.Background(), encoded)
+	err = worker.processSingleMessage(context.Background(), encoded)
 
+	require.NoError(t, err)
 	service.AssertExpectations(t)
 }
+
+// recordingDelivery создает сообщение, которое запоминает результат подтверждения
+func recordingDelivery(body []byte, results chan<- string) models.Delivery {
+	return models.Delivery{
+		Body: body,
+		Ack: func() error {
+			results <- "ack"
+			return nil
+		},
+		Nack: func(requeue bool) error {
+			results <- fmt.Sprintf("nack:%t", requeue)
+			return nil
+		},
+	}
+}
+
+func TestWorker_HandleDelivery_NackWithoutRequeueOnInvalidMessage(t *testing.T) {
+	worker := NewWorker(new(testsutils.MockService), 1, nil)
+	results := make(chan string, 1)
+
+	worker.handleDelivery(context.Background(), recordingDelivery([]byte("!!!invalid base64!!!"), results))
+
+	assert.Equal(t, "nack:false", <-results)
+}
+
+func TestWorker_BlocksInsteadOfDroppingWhenBusy(t *testing.T) {
+	service := new(testsutils.MockService)
+	worker := NewWorker(service, 1, nil)
+
+	release := make(chan struct{})
+	service.
+		On("ProcessNotification", mock.Anything, mock.AnythingOfType("*models.Notification")).
+		Run(func(args mock.Arguments) { <-release }).
+		Return(nil)
+
+	data, err := json.Marshal(models.Notification{ID: "id-1"})
+	require.NoError(t, err)
+	encoded := []byte(base64.StdEncoding.EncodeToString(data))
+
+	const total = 3
+	messages := make(chan models.Delivery)
+	results := make(chan string, total)
+
+	worker.wg.Add(1)
+	go worker.processMessages(context.Background(), messages)
+
+	// Первое сообщение занимает единственный слот, второе уже не может быть принято
+	messages <- recordingDelivery(encoded, results)
+	messages <- recordingDelivery(encoded, results)
+	select {
+	case messages <- recordingDelivery(encoded, results):
+		t.Fatal("worker accepted message while busy")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	messages <- recordingDelivery(encoded, results)
+
+	for i := 0; i < total; i++ {
+		select {
+		case res := <-results:
+			assert.Equal(t, "ack", res)
+		case <-time.After(time.Second):
+			t.Fatal("message was not acknowledged")
+		}
+	}
+
+	close(messages)
+	worker.wg.Wait()
+	service.AssertNumberOfCalls(t, "ProcessNotification", total)
+}
+
+func TestWorker_GetStatus(t *testing.T) {
+	service := new(testsutils.MockService)
+	worker := NewWorker(service, 2, nil)
+
+	messages := make(chan models.Delivery)
+	service.On("Consume", mock.Anything, "notifications_queue").Return((<-chan models.Delivery)(messages), nil)
+	service.On("ProcessNotification", mock.Anything, mock.AnythingOfType("*models.Notification")).Return(nil)
+
+	assert.False(t, worker.Ready())
+
+	require.NoError(t, worker.Start(context.Background(), "notifications_queue"))
+	assert.True(t, worker.Ready())
+
+	data, err := json.Marshal(models.Notification{ID: "id-1"})
+	require.NoError(t, err)
+	results := make(chan string, 1)
+	messages <- recordingDelivery([]byte(base64.StdEncoding.EncodeToString(data)), results)
+	assert.Equal(t, "ack", <-results)
+
+	status := worker.GetStatus()
+	assert.Equal(t, true, status["active"])
+	assert.Equal(t, "notifications_queue", status["queue"])
+	assert.Equal(t, 2, status["concurrency"])
+	assert.Equal(t, int64(1), status["processed"])
+
+	// Закрытый канал сообщений означает, что воркер больше не готов
+	close(messages)
+	worker.wg.Wait()
+	assert.False(t, worker.Ready())
+}
+
+func TestOutboxRelay_DrainsUntilBatchIsNotFull(t *testing.T) {
+	service := new(testsutils.MockService)
+	relay := NewOutboxRelay(service, time.Second, 10*time.Second, 10)
+
+	service.On("DispatchOutbox", mock.Anything, 10, 10*time.Second).Return(10, nil).Once()
+	service.On("DispatchOutbox", mock.Anything, 10, 10*time.Second).Return(3, nil).Once()
+
+	relay.drain(context.Background())
+
+	service.AssertExpectations(t)
+	service.AssertNumberOfCalls(t, "DispatchOutbox", 2)
+}
+
+func TestLeaseReaper_RecoversStuckNotifications(t *testing.T) {
+	service := new(testsutils.MockService)
+	reaper := NewLeaseReaper(service, time.Second)
+
+	service.On("RecoverStuck", mock.Anything).Return(2, nil).Once()
+
+	reaper.reap(context.Background())
+
+	service.AssertExpectations(t)
+}
+
+func TestWorker_ProcessWithRetry_RateLimitDoesNotConsumeAttempts(t *testing.T) {
+	service := new(testsutils.MockService)
+	worker := NewWorker(service, 1, nil)
+
+	n := &models.Notification{ID: "id-1"}
+	limited := &models.RateLimitError{RetryAfter: time.Millisecond, Err: errors.New("429")}
+
+	// Ограничений больше, чем попыток: ни одна попытка не должна быть израсходована
+	service.
+		On("ProcessNotification", mock.Anything, n).
+		Return(limited).
+		Times(models.ConsumerStrategy.Attempts + 1)
+	service.
+		On("ProcessNotification", mock.Anything, n).
+		Return(nil).
+		Once()
+
+	err := worker.processWithRetry(context.Background(), n)
+
+	require.NoError(t, err)
+	service.AssertNumberOfCalls(t, "ProcessNotification", models.ConsumerStrategy.Attempts+2)
+}
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Channels: map[string]config.RateLimit{
+			"email": {PerSecond: 1, Burst: 2},
+		},
+		PerRecipient: map[string]config.RateLimit{
+			"telegram": {PerSecond: 1, Burst: 1},
+		},
+	})
+
+	// Ограничение получателя не затрагивает других получателей
+	assert.Zero(t, limiter.Reserve("telegram", "user-1"))
+	assert.Positive(t, limiter.Reserve("telegram", "user-1"))
+	assert.Zero(t, limiter.Reserve("telegram", "user-2"))
+
+	// Ограничение канала общее для всех получателей
+	assert.Zero(t, limiter.Reserve("email", "user-1"))
+	assert.Zero(t, limiter.Reserve("email", "user-2"))
+	assert.Positive(t, limiter.Reserve("email", "user-3"))
+
+	// Канал без ограничений и nil ограничитель не задерживают отправку
+	assert.Zero(t, limiter.Reserve("webhook", "user-1"))
+	assert.Zero(t, (*RateLimiter)(nil).Reserve("telegram", "user-1"))
+}
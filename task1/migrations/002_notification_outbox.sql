@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS
+ notification_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    notification_id VARCHAR(36) NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL,
+    send_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    dispatched_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox(send_at) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_notification_id ON notification_outbox(notification_id);
@@ -0,0 +1,5 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS series_id VARCHAR(36);
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS recurrence JSONB;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS occurrence INT NOT NULL DEFAULT 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_series_occurrence ON notifications(series_id, occurrence) WHERE series_id IS NOT NULL;
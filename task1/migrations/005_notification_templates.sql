@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS
+ notification_templates (
+    id VARCHAR(36) NOT NULL,
+    version INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    channel VARCHAR(50) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    parse_mode VARCHAR(20) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP,
+    PRIMARY KEY (id, version)
+);
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS template_id VARCHAR(36);
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS template_version INT;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS variables JSONB;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS
+ user_preferences (
+    user_id VARCHAR(255) PRIMARY KEY,
+    contacts JSONB NOT NULL,
+    channels JSONB,
+    timezone VARCHAR(64) NOT NULL DEFAULT '',
+    quiet_start VARCHAR(5),
+    quiet_end VARCHAR(5),
+    updated_at TIMESTAMP NOT NULL
+);
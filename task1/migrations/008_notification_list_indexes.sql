@@ -0,0 +1,3 @@
+-- Индексы для keyset-пагинации GET /notify: сортировка по (send_at, id) и (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_send_at ON notifications(user_id, send_at, id);
+CREATE INDEX IF NOT EXISTS idx_notifications_created_at ON notifications(created_at, id);
@@ -0,0 +1,4 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_user_idempotency_key
+    ON notifications(user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
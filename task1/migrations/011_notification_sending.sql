@@ -0,0 +1,9 @@
+-- Статус sending: уведомление захвачено воркером до окончания отправки
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_status_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'canceled'));
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_sending_lease
+    ON notifications(claimed_until) WHERE status = 'sending';
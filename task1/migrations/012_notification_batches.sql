@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notification_batches (
+    id VARCHAR(36) PRIMARY KEY,
+    total INT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS batch_id VARCHAR(36)
+    REFERENCES notification_batches(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_batch_id ON notifications(batch_id) WHERE batch_id IS NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS notification_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    notification_id VARCHAR(36) NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    channel VARCHAR(50) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_attempts_notification
+    ON notification_attempts(notification_id, started_at);
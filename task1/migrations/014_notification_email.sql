@@ -0,0 +1,4 @@
+-- Тема, разметка и вложения письма, заданные при создании уведомления
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS subject TEXT;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS parse_mode VARCHAR(20);
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS attachments JSONB;
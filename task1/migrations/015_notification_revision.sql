@@ -0,0 +1,14 @@
+-- Ревизия увеличивается при каждом UPDATE, кэш не принимает записи с меньшей ревизией
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION notifications_bump_revision() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.revision := OLD.revision + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notifications_revision ON notifications;
+CREATE TRIGGER notifications_revision
+    BEFORE UPDATE ON notifications
+    FOR EACH ROW EXECUTE FUNCTION notifications_bump_revision();
@@ -0,0 +1,17 @@
+-- Очередь сообщений для QUEUE_BACKEND=postgres. Сообщение доступно с deliver_at,
+-- захваченное потребителем скрыто до locked_until и удаляется после подтверждения
+CREATE TABLE IF NOT EXISTS notification_queue (
+    id BIGSERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    deliver_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_queue_deliver_at ON notification_queue(deliver_at);
+
+CREATE TABLE IF NOT EXISTS notification_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
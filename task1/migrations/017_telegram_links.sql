@@ -0,0 +1,14 @@
+-- Одноразовые токены для команды боту /start <token> и привязанные через них чаты
+CREATE TABLE IF NOT EXISTS telegram_link_tokens (
+    token VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS telegram_chats (
+    chat_id BIGINT PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    linked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_telegram_chats_user_id ON telegram_chats(user_id);
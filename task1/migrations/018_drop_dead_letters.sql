@@ -0,0 +1,3 @@
+-- Недоставленные уведомления хранятся только как строки notifications со статусом failed,
+-- отдельная таблица не очищалась при replay и расходилась с ними
+DROP TABLE IF EXISTS notification_dead_letters;
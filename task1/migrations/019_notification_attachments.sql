@@ -0,0 +1,30 @@
+-- Содержимое вложений хранится отдельно: в notifications.attachments, outbox, очереди и кэше
+-- остаются только ссылки на записи этой таблицы
+CREATE TABLE IF NOT EXISTS notification_attachments (
+    id VARCHAR(36) PRIMARY KEY,
+    notification_id VARCHAR(36) NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    content BYTEA NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_attachments_notification
+    ON notification_attachments(notification_id);
+
+-- Переносим содержимое уже сохраненных вложений, в уведомлении вместо него остается id
+CREATE TEMPORARY TABLE attachment_moves ON COMMIT DROP AS
+SELECT n.id AS notification_id, a.position, gen_random_uuid()::text AS attachment_id,
+    decode(a.value->>'content', 'base64') AS content
+FROM notifications n, jsonb_array_elements(n.attachments) WITH ORDINALITY AS a(value, position)
+WHERE a.value->>'content' IS NOT NULL;
+
+INSERT INTO notification_attachments (id, notification_id, content)
+SELECT attachment_id, notification_id, content FROM attachment_moves;
+
+UPDATE notifications n SET attachments = (
+    SELECT jsonb_agg(
+        CASE WHEN m.attachment_id IS NULL THEN a.value
+        ELSE (a.value - 'content') || jsonb_build_object('id', m.attachment_id) END
+        ORDER BY a.position)
+    FROM jsonb_array_elements(n.attachments) WITH ORDINALITY AS a(value, position)
+    LEFT JOIN attachment_moves m ON m.notification_id = n.id AND m.position = a.position
+)
+WHERE n.id IN (SELECT notification_id FROM attachment_moves);
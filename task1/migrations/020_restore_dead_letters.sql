@@ -0,0 +1,11 @@
+-- Очередь недоставленных для QUEUE_BACKEND=postgres, удаленная миграцией 018. Записи
+-- уведомления удаляются при его replay, поэтому у записи есть notification_id
+CREATE TABLE IF NOT EXISTS notification_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    notification_id VARCHAR(36) NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_dead_letters_notification
+    ON notification_dead_letters(notification_id);
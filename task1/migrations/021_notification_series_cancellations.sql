@@ -0,0 +1,6 @@
+-- Отмененные серии. Повтор, который отправлялся в момент отмены, завершается как обычно,
+-- но следующий повтор для серии из этой таблицы не создается
+CREATE TABLE IF NOT EXISTS notification_canceled_series (
+    series_id VARCHAR(36) PRIMARY KEY,
+    canceled_at TIMESTAMP NOT NULL
+);
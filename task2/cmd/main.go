@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -41,6 +42,22 @@ func main() {
 	}()
 
 	shortURLService := service.New(pgRepo)
+
+	// Фоновая очистка истекших ссылок
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	var purgeWG sync.WaitGroup
+	if cfg.Purge.Interval > 0 {
+		purgeWG.Add(1)
+		go func() {
+			defer purgeWG.Done()
+			shortURLService.RunPurge(purgeCtx, cfg.Purge.Interval, cfg.Purge.Retention)
+		}()
+	}
+	defer func() {
+		stopPurge()
+		purgeWG.Wait()
+	}()
+
 	server := server.New(shortURLService)
 	router := ginext.New()
 	router.LoadHTMLGlob("internal/frontend/templates/*.html")
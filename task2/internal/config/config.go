@@ -15,6 +15,7 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig
 	Retry    RetryConfig
+	Purge    PurgeConfig
 }
 
 type ServerConfig struct {
@@ -48,6 +49,13 @@ type RetryConfig struct {
 	WorkerCount int
 }
 
+// PurgeConfig задает очистку истекших ссылок. Ссылка удаляется через Retention после
+// истечения срока или последнего разрешенного перехода, Interval <= 0 отключает очистку
+type PurgeConfig struct {
+	Interval  time.Duration
+	Retention time.Duration
+}
+
 func Load() *Config {
 	// Загрузка .env файла
 	if err := godotenv.Load(); err != nil {
@@ -77,6 +85,10 @@ func Load() *Config {
 			BaseDelay:   getEnvAsDuration("BASE_DELAY", 1*time.Second),
 			WorkerCount: getEnvAsInt("WORKER_COUNT", 5),
 		},
+		Purge: PurgeConfig{
+			Interval:  getEnvAsDuration("PURGE_INTERVAL", 10*time.Minute),
+			Retention: getEnvAsDuration("PURGE_RETENTION", 24*time.Hour),
+		},
 	}
 }
 
@@ -14,6 +14,9 @@ type ShortURL struct {
 	OriginalURL string    `json:"original_url" db:"original_url"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	ClicksCount int       `json:"clicks_count" db:"clicks_count"`
+	// Необязательные ограничения: после ExpiresAt или MaxClicks переходов ссылка перестает работать
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	MaxClicks *int       `json:"max_clicks,omitempty" db:"max_clicks"`
 }
 
 // Модель информации о клике
@@ -89,6 +92,8 @@ var (
 var (
 	ErrShortURLNotFound   = errors.New("short URL not found")
 	ErrDuplicateShortCode = errors.New("duplicate short code")
+	ErrShortURLExpired    = errors.New("short URL expired")
+	ErrInvalidLinkLimits  = errors.New("invalid link limits")
 )
 
 const (
@@ -98,5 +103,6 @@ const (
 	StatusBadRequest          = 400
 	StatusNotFound            = 404
 	StatisConflict            = 409
+	StatusGone                = 410
 	StatusInternalServerError = 500
 )
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/pozedorum/WB_project_3/task2/internal/models"
 	"github.com/pozedorum/WB_project_3/task2/internal/utils"
@@ -31,11 +32,11 @@ func NewShortURLRepository(db *dbpg.DB) *ShortURLRepository {
 
 // Создание и обновление
 func (sr *ShortURLRepository) CreateShortURL(ctx context.Context, n *models.ShortURL) error {
-	createQuery := `INSERT INTO short_urls (short_code, original_url, created_at, clicks_count) 
-		VALUES ($1, $2, $3, $4)`
+	createQuery := `INSERT INTO short_urls (short_code, original_url, created_at, clicks_count, expires_at, max_clicks) 
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
 	_, err := sr.db.ExecWithRetry(ctx, models.StandardStrategy, createQuery,
-		n.ShortCode, n.OriginalURL, n.CreatedAt, n.ClicksCount)
+		n.ShortCode, n.OriginalURL, n.CreatedAt, n.ClicksCount, n.ExpiresAt, n.MaxClicks)
 
 	if err != nil {
 		zlog.Logger.Error().Err(err).Str("short_code", n.ShortCode).Msg("Failed to create url in database")
@@ -46,7 +47,11 @@ func (sr *ShortURLRepository) CreateShortURL(ctx context.Context, n *models.Shor
 	return err
 }
 
-func (sr *ShortURLRepository) RegisterClick(ctx context.Context, click *models.ClickAnalyticsEntry) error {
+// RegisterClick засчитывает переход и возвращает оригинальный URL. Счетчик увеличивается
+// только у действующей ссылки, строка блокируется до конца транзакции, поэтому
+// параллельные переходы не превышают max_clicks. Для истекшей или исчерпанной ссылки
+// возвращается models.ErrShortURLExpired.
+func (sr *ShortURLRepository) RegisterClick(ctx context.Context, click *models.ClickAnalyticsEntry) (string, error) {
 	// Парсим User-Agent для детальной аналитики
 	userAgentInfo := utils.ParseUserAgent(click.UserAgent)
 
@@ -54,52 +59,55 @@ func (sr *ShortURLRepository) RegisterClick(ctx context.Context, click *models.C
 	tx, err := sr.db.Master.BeginTx(ctx, nil)
 	if err != nil {
 		zlog.Logger.Error().Err(err).Msg("Failed to begin transaction")
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return "", fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer func() {
-		if err := tx.Rollback(); err != nil {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
 			zlog.Logger.Error().Err(err).Msg("Failed to end transaction")
 		}
 	}()
-	// Запрос для вставки данных о клике
-	// ВАЖНО: Используем только базовые поля, которые есть в таблице из миграции 001
-	query := `INSERT INTO url_clicks 
-        (short_url_id, user_agent,ip_address, created_at) 
-        SELECT id, $2, $3, $4
-        FROM short_urls WHERE short_code = $1
-        RETURNING short_url_id`
 
-	var shortURLID int
-	err = tx.QueryRowContext(ctx, query,
-		click.ShortCode,
-		click.UserAgent,
-		click.IPAddress,
-		click.CreatedAt,
-	).Scan(&shortURLID)
-	// Обрабатываем ошибку
+	// Последний разрешенный переход отмечается в exhausted_at, от него отсчитывается очистка
+	claimQuery := `UPDATE short_urls SET clicks_count = clicks_count + 1,
+			exhausted_at = CASE WHEN max_clicks IS NOT NULL AND clicks_count + 1 >= max_clicks
+				THEN $2 ELSE exhausted_at END
+		WHERE short_code = $1
+			AND (expires_at IS NULL OR expires_at > $2)
+			AND (max_clicks IS NULL OR clicks_count < max_clicks)
+		RETURNING id, original_url`
+
+	var (
+		shortURLID  int
+		originalURL string
+	)
+	err = tx.QueryRowContext(ctx, claimQuery, click.ShortCode, click.CreatedAt).Scan(&shortURLID, &originalURL)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			zlog.Logger.Warn().Str("short_code", click.ShortCode).Msg("Attempted to register click for non-existent short code")
-			return models.ErrShortURLNotFound
+			return "", sr.inactiveShortURLError(ctx, tx, click.ShortCode)
 		}
-		zlog.Logger.Error().Err(err).Str("short_code", click.ShortCode).Msg("Failed to insert click analytics")
-		return fmt.Errorf("database error on click insert: %w", err)
+		zlog.Logger.Error().Err(err).Str("short_code", click.ShortCode).Msg("Failed to update click count")
+		return "", fmt.Errorf("database error on count update: %w", err)
 	}
 
-	// Обновляем счетчик кликов
-	_, err = tx.ExecContext(ctx,
-		"UPDATE short_urls SET clicks_count = clicks_count + 1 WHERE id = $1",
+	// Запрос для вставки данных о клике
+	// ВАЖНО: Используем только базовые поля, которые есть в таблице из миграции 001
+	_, err = tx.ExecContext(ctx, `INSERT INTO url_clicks 
+        (short_url_id, user_agent, ip_address, created_at) 
+        VALUES ($1, $2, $3, $4)`,
 		shortURLID,
+		click.UserAgent,
+		click.IPAddress,
+		click.CreatedAt,
 	)
 	if err != nil {
-		zlog.Logger.Error().Err(err).Int("url_id", shortURLID).Msg("Failed to update click count")
-		return fmt.Errorf("database error on count update: %w", err)
+		zlog.Logger.Error().Err(err).Str("short_code", click.ShortCode).Msg("Failed to insert click analytics")
+		return "", fmt.Errorf("database error on click insert: %w", err)
 	}
 
 	// Коммитим транзакцию
 	if err := tx.Commit(); err != nil {
 		zlog.Logger.Error().Err(err).Msg("Failed to commit transaction for click registration")
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	// Логируем аналитику (данные есть в userAgentInfo, но не сохраняем в БД)
@@ -111,7 +119,44 @@ func (sr *ShortURLRepository) RegisterClick(ctx context.Context, click *models.C
 		Str("device", userAgentInfo.Device).
 		Msg("Click registered successfully")
 
-	return nil
+	return originalURL, nil
+}
+
+// inactiveShortURLError отличает несуществующий код от истекшего или исчерпанного
+func (sr *ShortURLRepository) inactiveShortURLError(ctx context.Context, tx *sql.Tx, shortCode string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM short_urls WHERE short_code = $1)", shortCode,
+	).Scan(&exists)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("short_code", shortCode).Msg("Failed to check short code existence")
+		return fmt.Errorf("database error: %w", err)
+	}
+	if !exists {
+		zlog.Logger.Warn().Str("short_code", shortCode).Msg("Attempted to register click for non-existent short code")
+		return models.ErrShortURLNotFound
+	}
+	zlog.Logger.Info().Str("short_code", shortCode).Msg("Attempted to register click for expired short code")
+	return models.ErrShortURLExpired
+}
+
+// DeleteExpiredShortURLs удаляет пачку ссылок, истекших или исчерпанных раньше before,
+// вместе с их переходами (url_clicks удаляются каскадно). Возвращает число удаленных ссылок.
+func (sr *ShortURLRepository) DeleteExpiredShortURLs(ctx context.Context, before time.Time, limit int) (int64, error) {
+	deleteQuery := `DELETE FROM short_urls WHERE id IN (
+			SELECT id FROM short_urls WHERE expires_at < $1 OR exhausted_at < $1 LIMIT $2
+		)`
+
+	res, err := sr.db.ExecWithRetry(ctx, models.StandardStrategy, deleteQuery, before, limit)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Time("before", before).Msg("Failed to delete expired short URLs")
+		return 0, fmt.Errorf("delete failed: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected failed: %w", err)
+	}
+	return deleted, nil
 }
 
 // Чтение
@@ -120,7 +165,7 @@ func (sr *ShortURLRepository) GetOriginalURLIfExists(ctx context.Context, shortC
 	var shortURL models.ShortURL
 
 	err := sr.db.Master.QueryRowContext(ctx,
-		`SELECT id, short_code, original_url, created_at, clicks_count 
+		`SELECT id, short_code, original_url, created_at, clicks_count, expires_at, max_clicks 
 		 FROM short_urls WHERE short_code = $1`,
 		shortCode,
 	).Scan(
@@ -129,6 +174,8 @@ func (sr *ShortURLRepository) GetOriginalURLIfExists(ctx context.Context, shortC
 		&shortURL.OriginalURL,
 		&shortURL.CreatedAt,
 		&shortURL.ClicksCount,
+		&shortURL.ExpiresAt,
+		&shortURL.MaxClicks,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -15,6 +15,9 @@ func (ss *ShortURLServer) Shorten(c *ginext.Context) {
 	var request struct {
 		URL        string `json:"url" binding:"required,url"`
 		CustomCode string `json:"custom_code,omitempty" binding:"omitempty,alphanum,min=1,max=6"`
+		// Необязательные ограничения ссылки: момент истечения (RFC 3339) и лимит переходов
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		MaxClicks *int       `json:"max_clicks,omitempty"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		zlog.Logger.Error().Err(err).Msg("Failed to bind JSON for create short URL")
@@ -29,8 +32,13 @@ func (ss *ShortURLServer) Shorten(c *ginext.Context) {
 		Msg("creating short URL")
 
 	// Создаем короткую ссылку с учетом кастомного кода
-	su, err := ss.service.CreateShortURL(c.Request.Context(), request.URL, request.CustomCode)
+	su, err := ss.service.CreateShortURL(c.Request.Context(), request.URL, request.CustomCode, request.ExpiresAt, request.MaxClicks)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidLinkLimits) {
+			zlog.Logger.Warn().Err(err).Msg("Invalid link limits")
+			c.JSON(models.StatusBadRequest, ginext.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
 		if errors.Is(err, models.ErrDuplicateShortCode) {
 			zlog.Logger.Warn().
 				Str("custom_code", request.CustomCode).
@@ -50,11 +58,15 @@ func (ss *ShortURLServer) Shorten(c *ginext.Context) {
 	}
 
 	response := struct {
-		ShortURL    string `json:"short_url"`
-		OriginalURL string `json:"original_url"`
+		ShortURL    string     `json:"short_url"`
+		OriginalURL string     `json:"original_url"`
+		ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+		MaxClicks   *int       `json:"max_clicks,omitempty"`
 	}{
 		ShortURL:    "/s/" + su.ShortCode,
 		OriginalURL: su.OriginalURL,
+		ExpiresAt:   su.ExpiresAt,
+		MaxClicks:   su.MaxClicks,
 	}
 
 	zlog.Logger.Info().
@@ -86,6 +98,11 @@ func (ss *ShortURLServer) Redirect(c *ginext.Context) {
 			c.JSON(models.StatusBadRequest, ginext.H{"error": "short URL not found"})
 			return
 		}
+		if errors.Is(err, models.ErrShortURLExpired) {
+			zlog.Logger.Info().Str("short_code", shortCode).Msg("short URL expired")
+			c.JSON(models.StatusGone, ginext.H{"error": "short URL expired"})
+			return
+		}
 		zlog.Logger.Error().Err(err).Str("short_code", shortCode).Msg("Failed to redirect")
 		c.JSON(models.StatusBadRequest, ginext.H{"error": "Internal server error"})
 		return
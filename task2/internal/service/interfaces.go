@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/pozedorum/WB_project_3/task2/internal/models"
 )
@@ -11,5 +12,7 @@ type Repository interface {
 	CreateShortURL(ctx context.Context, n *models.ShortURL) error
 	GetOriginalURLIfExists(ctx context.Context, shortCode string) (*models.ShortURL, error)
 	GetStatisticsByShortCode(ctx context.Context, shortCode string, period string, groupBy string) (*models.AnalyticsResponse, error)
-	RegisterClick(ctx context.Context, click *models.ClickAnalyticsEntry) error
+	// RegisterClick атомарно засчитывает переход по действующей ссылке и возвращает оригинальный URL
+	RegisterClick(ctx context.Context, click *models.ClickAnalyticsEntry) (string, error)
+	DeleteExpiredShortURLs(ctx context.Context, before time.Time, limit int) (int64, error)
 }
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/pozedorum/wbf/zlog"
+)
+
+// purgeBatchSize - сколько ссылок удаляется одним запросом, чтобы не держать долгие блокировки
+const purgeBatchSize = 1000
+
+// PurgeExpired удаляет ссылки, которые истекли или исчерпали лимит переходов раньше,
+// чем retention назад, вместе с их аналитикой. Возвращает число удаленных ссылок.
+func (s *ShortURLService) PurgeExpired(ctx context.Context, retention time.Duration) (int64, error) {
+	before := time.Now().Add(-retention)
+
+	var total int64
+	for {
+		deleted, err := s.repo.DeleteExpiredShortURLs(ctx, before, purgeBatchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// RunPurge вызывает PurgeExpired каждые interval, пока не отменен ctx.
+func (s *ShortURLService) RunPurge(ctx context.Context, interval, retention time.Duration) {
+	zlog.Logger.Info().Dur("interval", interval).Dur("retention", retention).Msg("Starting expired links purge")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Logger.Info().Msg("Expired links purge stopped")
+			return
+		case <-ticker.C:
+			deleted, err := s.PurgeExpired(ctx, retention)
+			if err != nil {
+				if ctx.Err() == nil {
+					zlog.Logger.Error().Err(err).Int64("deleted", deleted).Msg("Failed to purge expired links")
+				}
+				continue
+			}
+			if deleted > 0 {
+				zlog.Logger.Info().Int64("deleted", deleted).Msg("Expired links purged")
+			}
+		}
+	}
+}
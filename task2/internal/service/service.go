@@ -26,10 +26,27 @@ func New(repo Repository) *ShortURLService {
 	return &ShortURLService{repo: repo}
 }
 
-func (s *ShortURLService) CreateShortURL(ctx context.Context, originalURL string, customCode string) (*models.ShortURL, error) {
+// CreateShortURL создает ссылку. expiresAt и maxClicks необязательны: ссылка перестает
+// работать после expiresAt или после maxClicks переходов. Существующая ссылка
+// переиспользуется, только если она действует и ее ограничения совпадают с запрошенными.
+func (s *ShortURLService) CreateShortURL(ctx context.Context, originalURL string, customCode string, expiresAt *time.Time, maxClicks *int) (*models.ShortURL, error) {
 	if err := validateURL(originalURL); err != nil {
 		return nil, err
 	}
+	if err := validateLimits(expiresAt, maxClicks); err != nil {
+		return nil, err
+	}
+	if expiresAt != nil {
+		// PostgreSQL хранит время с точностью до микросекунд, иначе повторный запрос не совпадет с сохраненной ссылкой
+		truncated := expiresAt.Truncate(time.Microsecond)
+		expiresAt = &truncated
+	}
+
+	requested := &models.ShortURL{
+		OriginalURL: originalURL,
+		ExpiresAt:   expiresAt,
+		MaxClicks:   maxClicks,
+	}
 
 	var shortCode string
 
@@ -37,8 +54,8 @@ func (s *ShortURLService) CreateShortURL(ctx context.Context, originalURL string
 		shortCode = customCode
 		existingURL, err := s.repo.GetOriginalURLIfExists(ctx, shortCode)
 		if err == nil {
-			if existingURL.OriginalURL != originalURL {
-				// Кастомный код уже существует и связан с другим URL
+			if !reusable(existingURL, requested) {
+				// Кастомный код уже занят другим URL или ссылкой с другими ограничениями
 				return nil, models.ErrDuplicateShortCode
 			} else {
 				// Кастомный код существует и связан с правильным URL
@@ -51,16 +68,12 @@ func (s *ShortURLService) CreateShortURL(ctx context.Context, originalURL string
 
 	} else {
 		shortCode = utils.GenerateShortURL(originalURL)
-		uniqueShortCode, ok, err := s.ensureUniqueShortCode(ctx, originalURL, shortCode)
+		uniqueShortCode, existingURL, err := s.ensureUniqueShortCode(ctx, requested, shortCode)
 		if err != nil {
 			return nil, err
 		}
-		if ok {
-			shortURL, err := s.repo.GetOriginalURLIfExists(ctx, shortCode)
-			if err != nil {
-				return nil, err
-			}
-			return shortURL, nil
+		if existingURL != nil {
+			return existingURL, nil
 		}
 		shortCode = uniqueShortCode
 	}
@@ -70,6 +83,8 @@ func (s *ShortURLService) CreateShortURL(ctx context.Context, originalURL string
 		OriginalURL: originalURL,
 		CreatedAt:   time.Now(),
 		ClicksCount: 0,
+		ExpiresAt:   expiresAt,
+		MaxClicks:   maxClicks,
 	}
 
 	if err := s.repo.CreateShortURL(ctx, shortURL); err != nil {
@@ -86,30 +101,26 @@ func (s *ShortURLService) CreateShortURL(ctx context.Context, originalURL string
 	return shortURL, nil
 }
 
+// Redirect засчитывает переход и возвращает оригинальный URL. Проверка срока и лимита
+// переходов выполняется вместе с записью клика, поэтому лимит не превышается
+// при параллельных запросах. Для истекшей ссылки возвращается models.ErrShortURLExpired.
 func (s *ShortURLService) Redirect(ctx context.Context, shortCode string, userAgent, ip string) (string, error) {
-	// Получаем полную информацию атомарно
-	shortURL, err := s.repo.GetOriginalURLIfExists(ctx, shortCode)
+	clickStruct := models.ClickAnalyticsEntry{
+		ShortCode: shortCode,
+		UserAgent: userAgent,
+		IPAddress: ip,
+		CreatedAt: time.Now(),
+	}
+	originalURL, err := s.repo.RegisterClick(ctx, &clickStruct)
 	if err != nil {
-		if errors.Is(err, models.ErrShortURLNotFound) {
-			return "", models.ErrShortURLNotFound
+		if errors.Is(err, models.ErrShortURLNotFound) || errors.Is(err, models.ErrShortURLExpired) {
+			return "", err
 		}
-		return "", err
+		return "", fmt.Errorf("failed to register click: %w", err)
 	}
 
-	// Запись аналитики (асинхронно или в горутине чтобы не блокировать редирект)
-	go func() {
-		clickStruct := models.ClickAnalyticsEntry{
-			ShortCode: shortCode,
-			UserAgent: userAgent,
-			IPAddress: ip,
-			CreatedAt: time.Now(),
-		}
-		if err := s.repo.RegisterClick(context.Background(), &clickStruct); err != nil {
-			zlog.Logger.Error().Err(err).Str("short_code", shortCode).Msg("Failed to register click")
-		}
-	}()
-	zlog.Logger.Info().Str("short_code", shortCode).Str("original_url", shortURL.OriginalURL).Msg("serive layer")
-	return shortURL.OriginalURL, nil
+	zlog.Logger.Info().Str("short_code", shortCode).Str("original_url", originalURL).Msg("serive layer")
+	return originalURL, nil
 }
 
 func (s *ShortURLService) GetStatByShortCode(ctx context.Context, shortCode string, period string, groupBy string) (*models.AnalyticsResponse, error) {
@@ -125,24 +136,27 @@ func (s *ShortURLService) GetStatByShortCode(ctx context.Context, shortCode stri
 	return s.repo.GetStatisticsByShortCode(ctx, shortCode, period, groupBy)
 }
 
-func (s *ShortURLService) ensureUniqueShortCode(ctx context.Context, originalURL, baseShortCode string) (string, bool, error) {
+// ensureUniqueShortCode возвращает свободный код либо существующую ссылку, которую можно переиспользовать
+func (s *ShortURLService) ensureUniqueShortCode(ctx context.Context, requested *models.ShortURL, baseShortCode string) (string, *models.ShortURL, error) {
+	originalURL := requested.OriginalURL
+
 	// 1. Атомарно проверяем существование и получаем данные
 	existingShortURL, err := s.repo.GetOriginalURLIfExists(ctx, baseShortCode)
 	if err != nil {
 		if errors.Is(err, models.ErrShortURLNotFound) {
 			// Код свободен - возвращаем как есть
-			return baseShortCode, false, nil
+			return baseShortCode, nil, nil
 		}
-		return "", false, fmt.Errorf("failed to check short code existence: %w", err)
+		return "", nil, fmt.Errorf("failed to check short code existence: %w", err)
 	}
 
-	// 2. Если URL совпадает - возвращаем существующий код
-	if existingShortURL.OriginalURL == originalURL {
+	// 2. Если URL и ограничения совпадают - возвращаем существующую ссылку
+	if reusable(existingShortURL, requested) {
 		zlog.Logger.Info().Str("short_code", baseShortCode).Msg("Returning existing short code for same URL")
-		return baseShortCode, true, nil
+		return baseShortCode, existingShortURL, nil
 	}
 
-	// 3. Разные URL с одинаковым хэшем - коллизия!
+	// 3. Разные URL с одинаковым хэшем или та же ссылка с другими ограничениями - коллизия!
 	zlog.Logger.Warn().
 		Str("base_short_code", baseShortCode).
 		Str("existing_url", existingShortURL.OriginalURL).
@@ -162,21 +176,50 @@ func (s *ShortURLService) ensureUniqueShortCode(ctx context.Context, originalURL
 					Str("new_short_code", saltedShortCode).
 					Int("attempt", attempt).
 					Msg("Generated unique short code after collision")
-				return saltedShortCode, false, nil
+				return saltedShortCode, nil, nil
 			}
-			return "", false, fmt.Errorf("failed to check salted short code: %w", err)
+			return "", nil, fmt.Errorf("failed to check salted short code: %w", err)
 		}
 
-		// Если нашли существующий URL - проверяем совпадение
-		if existingSaltedURL.OriginalURL == originalURL {
+		// Если нашли подходящую существующую ссылку - возвращаем ее
+		if reusable(existingSaltedURL, requested) {
 			zlog.Logger.Info().
 				Str("short_code", saltedShortCode).
 				Msg("Found existing short code for the same URL")
-			return saltedShortCode, false, nil
+			return saltedShortCode, existingSaltedURL, nil
 		}
 	}
 
-	return "", false, fmt.Errorf("failed to generate unique short code after %d attempts for URL: %s", attemptsCount, originalURL)
+	return "", nil, fmt.Errorf("failed to generate unique short code after %d attempts for URL: %s", attemptsCount, originalURL)
+}
+
+// reusable сообщает, можно ли вернуть existing вместо создания ссылки requested:
+// URL и ограничения совпадают, а сама ссылка еще действует
+func reusable(existing, requested *models.ShortURL) bool {
+	if existing.OriginalURL != requested.OriginalURL {
+		return false
+	}
+	if !sameTime(existing.ExpiresAt, requested.ExpiresAt) || !sameInt(existing.MaxClicks, requested.MaxClicks) {
+		return false
+	}
+	if existing.ExpiresAt != nil && !existing.ExpiresAt.After(time.Now()) {
+		return false
+	}
+	return existing.MaxClicks == nil || existing.ClicksCount < *existing.MaxClicks
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 func validateURL(rawURL string) error {
@@ -199,3 +242,13 @@ func validateURL(rawURL string) error {
 
 	return nil
 }
+
+func validateLimits(expiresAt *time.Time, maxClicks *int) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", models.ErrInvalidLinkLimits)
+	}
+	if maxClicks != nil && *maxClicks <= 0 {
+		return fmt.Errorf("%w: max_clicks must be positive", models.ErrInvalidLinkLimits)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS max_clicks INTEGER NULL CHECK (max_clicks > 0);
+-- Момент последнего разрешенного перехода по ссылке с лимитом кликов
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS exhausted_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX IF NOT EXISTS idx_short_urls_expires_at ON short_urls(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_short_urls_exhausted_at ON short_urls(exhausted_at) WHERE exhausted_at IS NOT NULL;